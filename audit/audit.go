@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/downloader"
+	"github.com/stevedenman/gitmoo-goog/photos"
+	"github.com/stevedenman/gitmoo-goog/restore"
+)
+
+//Options defines audit options
+var Options struct {
+	//BackupFolder is the backup folder
+	BackupFolder string
+	//DryRun only lists the files Clean would remove
+	DryRun bool
+	//Similarity is the number of bits perceptual hashes of similar photos can differ by
+	Similarity int
+}
+
+//Report is the outcome of an audit
+type Report struct {
+	//Months are the number of media files by creation month (YYYY-MM), "unknown" without a sidecar
+	Months map[string]int
+	//Media is the number of media files
+	Media int
+	//Sidecars is the number of metadata sidecars
+	Sidecars int
+	//Size is the size of the media files
+	Size uint64
+	//MissingSidecars are the media files without a sidecar
+	MissingSidecars []string
+	//OrphanSidecars are the sidecars without a media file
+	OrphanSidecars []string
+	//Empty are the zero-byte files
+	Empty []string
+	//Partial are the leftovers of interrupted downloads (.part and .tmp files)
+	Partial []string
+}
+
+//month returns the creation month in the sidecar json, or "unknown"
+func month(sidecar string) string {
+	item := readSidecar(sidecar)
+	if item == nil || item.MediaMetadata == nil || len(item.MediaMetadata.CreationTime) < 7 {
+		return "unknown"
+	}
+	return item.MediaMetadata.CreationTime[:7]
+}
+
+func readSidecar(path string) *photos.MediaItem {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	item := &photos.MediaItem{}
+	if json.Unmarshal(data, item) != nil {
+		return nil
+	}
+	return item
+}
+
+//Audit scans the backup folder, without API access
+func Audit() (*Report, error) {
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	r := &Report{Months: make(map[string]int)}
+	media := make(map[string]string)
+	sidecars := make(map[string]string)
+	albums := filepath.Join(folder, downloader.AlbumsFolder)
+	quarantine := filepath.Join(folder, downloader.QuarantineFolder)
+	state := filepath.Join(folder, downloader.StateFolder)
+	journal := filepath.Join(folder, restore.JournalName)
+	htmlReport := filepath.Join(folder, downloader.HTMLReportName)
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == albums || path == quarantine || path == state {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == journal || path == htmlReport {
+			return nil
+		}
+		if info.Size() == 0 {
+			r.Empty = append(r.Empty, path)
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		switch {
+		case ext == ".part" || ext == ".tmp":
+			r.Partial = append(r.Partial, path)
+		case ext == downloader.ParityExtension:
+			//parity files protect the files of their folder
+		case ext == ".json":
+			r.Sidecars++
+			sidecars[base] = path
+		case strings.HasSuffix(path, downloader.MotionSuffix):
+			//motion videos belong to the photo next to them
+		default:
+			r.Media++
+			r.Size += uint64(info.Size())
+			media[base] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for base, path := range media {
+		sidecar, ok := sidecars[base]
+		if !ok {
+			r.MissingSidecars = append(r.MissingSidecars, path)
+			r.Months["unknown"]++
+			continue
+		}
+		r.Months[month(sidecar)]++
+	}
+	for base, path := range sidecars {
+		if _, ok := media[base]; !ok {
+			r.OrphanSidecars = append(r.OrphanSidecars, path)
+		}
+	}
+	sort.Strings(r.MissingSidecars)
+	sort.Strings(r.OrphanSidecars)
+	return r, nil
+}
+
+//Log writes the report to the log
+func (r *Report) Log() {
+	log.Printf("Media: %v (%v), Sidecars: %v", r.Media, humanize.Bytes(r.Size), r.Sidecars)
+	months := make([]string, 0, len(r.Months))
+	for m := range r.Months {
+		months = append(months, m)
+	}
+	sort.Strings(months)
+	for _, m := range months {
+		log.Printf("%v: %v", m, r.Months[m])
+	}
+	logFiles("Media without sidecar", r.MissingSidecars)
+	logFiles("Sidecar without media", r.OrphanSidecars)
+	logFiles("Empty file", r.Empty)
+	logFiles("Partial download", r.Partial)
+}
+
+func logFiles(problem string, files []string) {
+	for _, f := range files {
+		log.Printf("%v: %v", problem, f)
+	}
+	if len(files) > 0 {
+		log.Printf("%v: %v files", problem, len(files))
+	}
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//staleAge is the age of partial and temp files left by crashed runs, younger ones may still be in use
+const staleAge = time.Hour
+
+//Clean removes orphaned sidecars, stale partial and temp files and empty folders from the backup
+//folder, or only lists them with Options.DryRun
+func Clean() error {
+	r, err := Audit()
+	if err != nil {
+		return err
+	}
+	files := append([]string{}, r.OrphanSidecars...)
+	for _, path := range r.Partial {
+		info, err := os.Stat(path)
+		if err == nil && time.Since(info.ModTime()) > staleAge {
+			files = append(files, path)
+		}
+	}
+	removed := 0
+	for _, path := range files {
+		if remove(path) {
+			removed++
+		}
+	}
+	dirs, err := emptyFolders()
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if remove(dir) {
+			removed++
+		}
+	}
+	if Options.DryRun {
+		log.Printf("%v files and folders would be removed", len(files)+len(dirs))
+	} else {
+		log.Printf("Removed %v files and folders", removed)
+	}
+	return nil
+}
+
+//remove deletes path, or logs it with Options.DryRun
+func remove(path string) bool {
+	if Options.DryRun {
+		log.Printf("Would remove '%v'", path)
+		return false
+	}
+	err := os.Remove(path)
+	if err != nil {
+		log.Printf("Unable to remove '%v': %v", path, err)
+		return false
+	}
+	log.Printf("Removed '%v'", path)
+	return true
+}
+
+//emptyFolders returns the empty folders of the backup folder, and the ones containing only
+//empty folders, deepest first
+func emptyFolders() ([]string, error) {
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	var dirs []string
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != folder {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return len(dirs[i]) > len(dirs[j])
+	})
+	empty := make(map[string]bool)
+	var result []string
+	for _, dir := range dirs {
+		if dir == filepath.Join(folder, downloader.AlbumsFolder) || dir == filepath.Join(folder, downloader.QuarantineFolder) || dir == filepath.Join(folder, downloader.StateFolder) {
+			continue
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		isEmpty := true
+		for _, e := range entries {
+			if !e.IsDir() || !empty[filepath.Join(dir, e.Name())] {
+				isEmpty = false
+				break
+			}
+		}
+		if isEmpty {
+			empty[dir] = true
+			result = append(result, dir)
+		}
+	}
+	return result, nil
+}
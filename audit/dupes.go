@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//DupeGroup are byte-identical media files
+type DupeGroup struct {
+	SHA256 string
+	//Size of one file
+	Size  int64
+	Files []string
+}
+
+//Savings is the space freed by keeping a single file of the group
+func (g *DupeGroup) Savings() uint64 {
+	return uint64(g.Size) * uint64(len(g.Files)-1)
+}
+
+//DupesReport lists the byte-identical media files of the archive
+type DupesReport struct {
+	Groups []*DupeGroup
+	//Hashed is the number of files that were not in the hash index
+	Hashed int
+}
+
+//Savings is the space freed by keeping a single file of every group
+func (r *DupesReport) Savings() uint64 {
+	total := uint64(0)
+	for _, g := range r.Groups {
+		total += g.Savings()
+	}
+	return total
+}
+
+//Log prints the groups, the largest savings first
+func (r *DupesReport) Log() {
+	for _, g := range r.Groups {
+		log.Printf("%v identical files of %v:", len(g.Files), humanize.Bytes(uint64(g.Size)))
+		for _, f := range g.Files {
+			log.Printf("  %v", f)
+		}
+	}
+	log.Printf("Duplicate groups: %v, potential savings: %v (%v files hashed)", len(r.Groups), humanize.Bytes(r.Savings()), r.Hashed)
+}
+
+//hashFile returns the SHA-256 of a file
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+//Dupes finds the byte-identical media files of the archive, offline. the hashes computed during
+//the downloads are used, the other files are hashed and added to the hash index
+func Dupes() (*DupesReport, error) {
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	downloader.Options.BackupFolder = folder
+	index, err := downloader.LoadHashIndex()
+	if err != nil {
+		return nil, err
+	}
+	byFile := make(map[string]downloader.HashEntry)
+	for _, entry := range index {
+		byFile[entry.File] = entry
+	}
+	skip := map[string]bool{
+		filepath.Join(folder, downloader.AlbumsFolder):     true,
+		filepath.Join(folder, downloader.QuarantineFolder): true,
+		filepath.Join(folder, downloader.StateFolder):      true,
+	}
+	report := &DupesReport{}
+	groups := make(map[string]*DupeGroup)
+	changed := false
+	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skip[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == ".json" || ext == ".part" || ext == ".tmp" || ext == downloader.ParityExtension || strings.HasSuffix(path, downloader.MotionSuffix) || info.Size() == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entry, ok := byFile[rel]
+		if !ok || entry.Size != info.Size() {
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			report.Hashed++
+			entry = downloader.HashEntry{File: rel, Size: info.Size(), SHA256: sum}
+			if item := readSidecar(strings.TrimSuffix(path, filepath.Ext(path)) + ".json"); item != nil && item.ID != "" {
+				index[item.ID] = entry
+				changed = true
+			}
+		}
+		g := groups[entry.SHA256]
+		if g == nil {
+			g = &DupeGroup{SHA256: entry.SHA256, Size: entry.Size}
+			groups[entry.SHA256] = g
+		}
+		g.Files = append(g.Files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		err = downloader.SaveHashIndex(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range groups {
+		if len(g.Files) > 1 {
+			sort.Strings(g.Files)
+			report.Groups = append(report.Groups, g)
+		}
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Savings() != report.Groups[j].Savings() {
+			return report.Groups[i].Savings() > report.Groups[j].Savings()
+		}
+		return report.Groups[i].Files[0] < report.Groups[j].Files[0]
+	})
+	return report, nil
+}
@@ -0,0 +1,178 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//PreviewSuffix is added to the backup folder name for the preview of Reorganize
+const PreviewSuffix = "-preview"
+
+//base returns the name shared by the files of an item: the media, the sidecar, the motion video...
+func base(path string) string {
+	if strings.HasSuffix(path, downloader.MotionSuffix) {
+		return strings.TrimSuffix(path, downloader.MotionSuffix)
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+//Reorganize renames the files of the archive to the layout of downloader.Options.Layout, using
+//the sidecars. with Options.DryRun the new layout is hard linked in a preview folder next to
+//the backup folder instead, leaving the archive unchanged
+func Reorganize() error {
+	err := downloader.CheckLayout()
+	if err != nil {
+		return err
+	}
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	folder, err = filepath.Abs(folder)
+	if err != nil {
+		return err
+	}
+	downloader.Options.BackupFolder = folder
+	preview := folder + PreviewSuffix
+	albums := filepath.Join(folder, downloader.AlbumsFolder)
+	quarantine := filepath.Join(folder, downloader.QuarantineFolder)
+	state := filepath.Join(folder, downloader.StateFolder)
+	partner := ""
+	if downloader.Options.PartnerFolder != "" {
+		partner = filepath.Join(folder, downloader.Options.PartnerFolder)
+	}
+
+	groups := make(map[string][]string)
+	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == albums || path == quarantine || path == state {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		b := base(path)
+		groups[b] = append(groups[b], path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	renamed := make(map[string]string)
+	moved, conflicts := 0, 0
+	for b, files := range groups {
+		item := readSidecar(b + ".json")
+		if item == nil || item.ID == "" || item.MediaMetadata == nil {
+			continue
+		}
+		root := folder
+		if partner != "" && strings.HasPrefix(b, partner+string(filepath.Separator)) {
+			root = partner
+		}
+		_, jsonName := downloader.ItemFileNames(root, item)
+		newBase := strings.TrimSuffix(jsonName, ".json")
+		if newBase == b {
+			continue
+		}
+		for _, path := range files {
+			target := newBase + path[len(b):]
+			if Options.DryRun {
+				rel, _ := filepath.Rel(folder, target)
+				target = filepath.Join(preview, rel)
+			}
+			if _, err := os.Stat(target); err == nil {
+				log.Printf("Not moving '%v': '%v' already exists", path, target)
+				conflicts++
+				continue
+			}
+			err = downloader.MkdirAll(filepath.Dir(target))
+			if err != nil {
+				return err
+			}
+			if Options.DryRun {
+				err = os.Link(path, target)
+			} else {
+				err = os.Rename(path, target)
+			}
+			if err != nil {
+				return fmt.Errorf("Unable to move '%v': %v", path, err)
+			}
+			oldRel, _ := filepath.Rel(folder, path)
+			newRel, _ := filepath.Rel(folder, newBase+path[len(b):])
+			renamed[filepath.ToSlash(oldRel)] = filepath.ToSlash(newRel)
+			moved++
+		}
+	}
+	if Options.DryRun {
+		log.Printf("Linked %v files in the new layout in '%v' (%v conflicts), the archive is unchanged", moved, preview, conflicts)
+		return nil
+	}
+	err = updateManifests(renamed)
+	if err != nil {
+		return err
+	}
+	err = updateHashes(renamed)
+	if err != nil {
+		return err
+	}
+	dirs, err := emptyFolders()
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		remove(dir)
+	}
+	log.Printf("Moved %v files to the new layout (%v conflicts)", moved, conflicts)
+	return nil
+}
+
+//updateHashes renames the files of the hash index
+func updateHashes(renamed map[string]string) error {
+	index, err := downloader.LoadHashIndex()
+	if err != nil || len(index) == 0 {
+		return err
+	}
+	for id, entry := range index {
+		if file, ok := renamed[entry.File]; ok {
+			entry.File = file
+			index[id] = entry
+		}
+	}
+	return downloader.SaveHashIndex(index)
+}
+
+//updateManifests renames the files of the album manifests
+func updateManifests(renamed map[string]string) error {
+	manifests, err := downloader.ReadManifests()
+	if err != nil {
+		return err
+	}
+	for _, m := range manifests {
+		changed := false
+		for i, item := range m.Items {
+			if file, ok := renamed[item.File]; ok {
+				m.Items[i].File = file
+				changed = true
+			}
+		}
+		if file, ok := renamed[m.CoverFile]; ok {
+			m.CoverFile = file
+			changed = true
+		}
+		if changed {
+			err = downloader.WriteManifest(m)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package audit
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//SheetsSuffix is added to the backup folder name for the folder of the contact sheets
+const SheetsSuffix = "-sheets"
+
+//browserImages are the extensions of the photos a browser displays
+var browserImages = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true, ".bmp": true}
+
+//sheetItem is a tile of a contact sheet
+type sheetItem struct {
+	Name string
+	Time string
+	//Src is the image shown, relative to the sheet, empty when it can not be shown
+	Src string
+	//Video is true when Src is a video, without a thumbnail
+	Video bool
+	//Missing is true when the sidecar has no media file
+	Missing bool
+}
+
+//sheet is the contact sheet of a month
+type sheet struct {
+	Month   string
+	Items   []sheetItem
+	Missing int
+}
+
+//SheetsReport lists the contact sheets written by Sheets
+type SheetsReport struct {
+	//Folder is where the sheets were written
+	Folder string
+	//Months are the number of items by creation month (YYYY-MM), "unknown" without a sidecar
+	Months map[string]int
+	//Missing are the sidecars without a media file
+	Missing int
+}
+
+var sheetTemplate = template.Must(template.New("sheet").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Month}}</title>
+<style>
+body{font-family:sans-serif;margin:1em}
+.grid{display:flex;flex-wrap:wrap;gap:4px}
+.tile{width:160px;height:180px;overflow:hidden;font-size:11px;text-align:center}
+.tile img,.tile video,.tile .none{width:160px;height:160px;object-fit:cover;background:#eee;display:block}
+.missing .none{background:#f88}
+</style></head><body>
+<p><a href="index.html">All months</a></p>
+<h1>{{.Month}}</h1>
+<p>{{len .Items}} items{{if .Missing}}, {{.Missing}} missing their media file{{end}}</p>
+<div class="grid">
+{{range .Items}}<div class="tile{{if .Missing}} missing{{end}}" title="{{.Name}} {{.Time}}">{{if .Missing}}<div class="none">missing</div>{{else if .Video}}<video src="{{.Src}}" preload="metadata" muted></video>{{else if .Src}}<a href="{{.Src}}"><img src="{{.Src}}" loading="lazy" alt=""></a>{{else}}<div class="none">{{.Name}}</div>{{end}}{{.Name}}</div>
+{{end}}</div>
+</body></html>
+`))
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Contact sheets</title>
+<style>body{font-family:sans-serif;margin:1em}</style></head><body>
+<h1>Contact sheets</h1>
+<ul>
+{{range .}}<li><a href="{{.Month}}.html">{{.Month}}</a>: {{len .Items}} items{{if .Missing}}, {{.Missing}} missing{{end}}</li>
+{{end}}</ul>
+</body></html>
+`))
+
+//sheetLink returns the path of file relative to the sheets folder, for a link of a sheet
+func sheetLink(sheets string, file string) string {
+	rel, err := filepath.Rel(sheets, file)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+//Sheets writes a contact sheet (an HTML page of the items) for every creation month of the
+//archive to the [folder]-sheets folder, offline. the thumbnails of downloader.Options.Thumbnails
+//are shown when they exist, otherwise the media files
+func Sheets() (*SheetsReport, error) {
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return nil, err
+	}
+	downloader.Options.BackupFolder = folder
+	thumbnails := ""
+	if downloader.Options.Thumbnails != "" {
+		thumbnails, err = filepath.Abs(downloader.Options.Thumbnails)
+		if err != nil {
+			return nil, err
+		}
+		downloader.Options.Thumbnails = thumbnails
+	}
+	sheets := folder + SheetsSuffix
+	skip := map[string]bool{
+		filepath.Join(folder, downloader.AlbumsFolder):     true,
+		filepath.Join(folder, downloader.QuarantineFolder): true,
+		filepath.Join(folder, downloader.StateFolder):      true,
+		thumbnails: true,
+	}
+	media := make(map[string]string)
+	sidecars := make(map[string]string)
+	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skip[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		b := strings.TrimSuffix(path, filepath.Ext(path))
+		switch {
+		case ext == ".part" || ext == ".tmp" || ext == downloader.ParityExtension || strings.HasSuffix(path, downloader.MotionSuffix):
+		case ext == ".json":
+			sidecars[b] = path
+		default:
+			media[b] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &SheetsReport{Folder: sheets, Months: make(map[string]int)}
+	months := make(map[string]*sheet)
+	add := func(month string, t sheetItem) {
+		s := months[month]
+		if s == nil {
+			s = &sheet{Month: month}
+			months[month] = s
+		}
+		s.Items = append(s.Items, t)
+		if t.Missing {
+			s.Missing++
+			r.Missing++
+		}
+		r.Months[month]++
+	}
+	for b, sidecar := range sidecars {
+		item := readSidecar(sidecar)
+		if item == nil || item.ID == "" {
+			continue
+		}
+		month, created := "unknown", ""
+		if item.MediaMetadata != nil && len(item.MediaMetadata.CreationTime) >= 7 {
+			month, created = item.MediaMetadata.CreationTime[:7], item.MediaMetadata.CreationTime
+		}
+		path, ok := media[b]
+		if !ok {
+			add(month, sheetItem{Name: filepath.Base(b), Time: created, Missing: true})
+			continue
+		}
+		add(month, tile(sheets, path, created))
+	}
+	for b, path := range media {
+		if _, ok := sidecars[b]; !ok {
+			add("unknown", tile(sheets, path, ""))
+		}
+	}
+
+	err = downloader.MkdirAll(sheets)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*sheet, 0, len(months))
+	for _, s := range months {
+		sort.Slice(s.Items, func(i, j int) bool {
+			if s.Items[i].Time != s.Items[j].Time {
+				return s.Items[i].Time < s.Items[j].Time
+			}
+			return s.Items[i].Name < s.Items[j].Name
+		})
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Month < list[j].Month })
+	for _, s := range list {
+		err = writePage(filepath.Join(sheets, s.Month+".html"), sheetTemplate, s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = writePage(filepath.Join(sheets, "index.html"), indexTemplate, list)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//tile returns the tile of the media file path, showing its thumbnail when there is one
+func tile(sheets string, path string, created string) sheetItem {
+	t := sheetItem{Name: filepath.Base(path), Time: created}
+	if downloader.Options.Thumbnails != "" {
+		thumbnail := downloader.ThumbnailName(path)
+		if _, err := os.Stat(thumbnail); err == nil {
+			t.Src = sheetLink(sheets, thumbnail)
+			return t
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case browserImages[ext]:
+		t.Src = sheetLink(sheets, path)
+	case ext == ".mp4" || ext == ".webm" || ext == ".m4v":
+		t.Src = sheetLink(sheets, path)
+		t.Video = true
+	}
+	return t
+}
+
+//writePage writes the page of the template t
+func writePage(fileName string, t *template.Template, data interface{}) error {
+	var b strings.Builder
+	err := t.Execute(&b, data)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(fileName, []byte(b.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to write '%v': %v", fileName, err)
+	}
+	return nil
+}
+
+//Log writes the number of items of every sheet to the log
+func (r *SheetsReport) Log() {
+	months := make([]string, 0, len(r.Months))
+	for m := range r.Months {
+		months = append(months, m)
+	}
+	sort.Strings(months)
+	for _, m := range months {
+		log.Printf("%v: %v items", m, r.Months[m])
+	}
+	log.Printf("Wrote %v contact sheets to '%v', %v items are missing their media file", len(months), r.Folder, r.Missing)
+}
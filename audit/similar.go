@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"image"
+	//decoders of the photos that can be compared
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//perceptualName is the state file of the perceptual hashes of the photos, by file relative to the backup folder
+const perceptualName = "perceptual.json"
+
+//DefaultSimilarity is the default of Options.Similarity
+const DefaultSimilarity = 6
+
+//perceptualEntry is the perceptual hash of a photo
+type perceptualEntry struct {
+	Size int64  `json:"size"`
+	Hash uint64 `json:"hash"`
+}
+
+//SimilarReport lists the groups of visually near-identical photos
+type SimilarReport struct {
+	Groups [][]string
+	//Hashed is the number of photos that were decoded, the others were in the state file
+	Hashed int
+}
+
+//Log prints the groups
+func (r *SimilarReport) Log() {
+	for _, g := range r.Groups {
+		log.Printf("%v similar photos:", len(g))
+		for _, f := range g {
+			log.Printf("  %v", f)
+		}
+	}
+	log.Printf("Similar groups: %v (%v photos decoded)", len(r.Groups), r.Hashed)
+}
+
+//isComparable checks if path is a photo with a decoder
+func isComparable(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".jfif", ".jpe", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+//differenceHash returns the dHash of a photo: its 9x8 gray thumbnail, one bit per pixel
+//brighter than its right neighbour. resizing, recompression and small edits change few bits
+func differenceHash(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, err
+	}
+	const width, height, samples = 9, 8, 6
+	b := img.Bounds()
+	var gray [height][width]uint32
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum := uint32(0)
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					px := b.Min.X + (x*samples+sx)*b.Dx()/(width*samples)
+					py := b.Min.Y + (y*samples+sy)*b.Dy()/(height*samples)
+					r, g, bl, _ := img.At(px, py).RGBA()
+					sum += (299*r + 587*g + 114*bl) / 1000 >> 8
+				}
+			}
+			gray[y][x] = sum
+		}
+	}
+	hash := uint64(0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+//Similar finds the visually near-identical photos of the archive (burst shots, edited copies...),
+//offline. photos whose perceptual hashes differ by at most Options.Similarity bits are grouped.
+//the hashes are kept in the state folder, only new or changed photos are decoded
+func Similar() (*SimilarReport, error) {
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	downloader.Options.BackupFolder = folder
+	maxDistance := Options.Similarity
+	if maxDistance <= 0 {
+		maxDistance = DefaultSimilarity
+	}
+	cache := make(map[string]perceptualEntry)
+	err := downloader.ReadState(perceptualName, &cache)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", perceptualName, err)
+		cache = make(map[string]perceptualEntry)
+	}
+	skip := map[string]bool{
+		filepath.Join(folder, downloader.AlbumsFolder):     true,
+		filepath.Join(folder, downloader.QuarantineFolder): true,
+		filepath.Join(folder, downloader.StateFolder):      true,
+	}
+	report := &SimilarReport{}
+	seen := make(map[string]perceptualEntry)
+	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skip[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isComparable(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entry, ok := cache[rel]
+		if !ok || entry.Size != info.Size() {
+			hash, err := differenceHash(path)
+			if err != nil {
+				log.Printf("Unable to decode '%v': %v", path, err)
+				return nil
+			}
+			report.Hashed++
+			entry = perceptualEntry{Size: info.Size(), Hash: hash}
+		}
+		seen[rel] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = downloader.WriteState(perceptualName, seen)
+	if err != nil {
+		return nil, err
+	}
+	report.Groups = groupSimilar(seen, maxDistance)
+	return report, nil
+}
+
+//groupSimilar groups the files whose hashes differ by at most maxDistance bits. the hashes are
+//split in maxDistance+1 bands: two hashes that close have at least one identical band, so only
+//the files sharing a band are compared
+func groupSimilar(hashes map[string]perceptualEntry, maxDistance int) [][]string {
+	files := make([]string, 0, len(hashes))
+	for f := range hashes {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	parent := make([]int, len(files))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(int) int
+	root = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	bands := maxDistance + 1
+	if bands > 64 {
+		bands = 64
+	}
+	width := 64 / bands
+	for band := 0; band < bands; band++ {
+		shift := uint(band * width)
+		mask := uint64(1)<<uint(width) - 1
+		buckets := make(map[uint64][]int)
+		for i, f := range files {
+			key := hashes[f].Hash >> shift & mask
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, bucket := range buckets {
+			for a := 0; a < len(bucket); a++ {
+				for b := a + 1; b < len(bucket); b++ {
+					i, j := bucket[a], bucket[b]
+					if bits.OnesCount64(hashes[files[i]].Hash^hashes[files[j]].Hash) <= maxDistance {
+						parent[root(i)] = root(j)
+					}
+				}
+			}
+		}
+	}
+	byRoot := make(map[int][]string)
+	for i, f := range files {
+		byRoot[root(i)] = append(byRoot[root(i)], f)
+	}
+	groups := make([][]string, 0)
+	for _, g := range byRoot {
+		if len(g) > 1 {
+			sort.Strings(g)
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+	return groups
+}
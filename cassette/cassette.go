@@ -0,0 +1,225 @@
+//Package cassette records HTTP interactions to a folder and replays them offline, for
+//deterministic end to end runs without credentials or network access
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//IndexName is the file listing the interactions of a cassette folder
+const IndexName = "interactions.jsonl"
+
+//Interaction is a recorded request and its response
+type Interaction struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	//Range is the Range header of the request, media is requested in parts
+	Range string `json:"range,omitempty"`
+	//RequestHash is the SHA-1 of the request body, API searches differ only by their body
+	RequestHash string      `json:"requestHash,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	//Length is the content length of the response, -1 if unknown
+	Length int64 `json:"length"`
+	//Body is the file of the response body, in the cassette folder
+	Body string `json:"body"`
+}
+
+func (i *Interaction) key() string {
+	return i.Method + " " + i.URL + " " + i.Range + " " + i.RequestHash
+}
+
+//Cassette records or replays the interactions of its transports
+type Cassette struct {
+	folder string
+	replay bool
+
+	mu    sync.Mutex
+	index *os.File
+	//count numbers the recorded bodies
+	count int
+	//tapes are the recorded interactions by request, replayed in order
+	tapes map[string][]*Interaction
+}
+
+//Record starts recording to folder, replacing a previous recording
+func Record(folder string) (*Cassette, error) {
+	err := os.MkdirAll(folder, 0700)
+	if err != nil {
+		return nil, err
+	}
+	index, err := os.Create(filepath.Join(folder, IndexName))
+	if err != nil {
+		return nil, err
+	}
+	return &Cassette{folder: folder, index: index}, nil
+}
+
+//Replay loads the interactions recorded in folder
+func Replay(folder string) (*Cassette, error) {
+	index, err := os.Open(filepath.Join(folder, IndexName))
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+	c := &Cassette{folder: folder, replay: true, tapes: make(map[string][]*Interaction)}
+	scanner := bufio.NewScanner(index)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		i := &Interaction{}
+		err = json.Unmarshal(scanner.Bytes(), i)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse %v: %v", IndexName, err)
+		}
+		c.tapes[i.key()] = append(c.tapes[i.key()], i)
+	}
+	return c, scanner.Err()
+}
+
+//Close stops recording
+func (c *Cassette) Close() error {
+	if c.index == nil {
+		return nil
+	}
+	return c.index.Close()
+}
+
+//Transport returns a transport recording the interactions of inner (nil for http.DefaultTransport),
+//or replaying them when the cassette was opened with Replay
+func (c *Cassette) Transport(inner http.RoundTripper) http.RoundTripper {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	return &transport{cassette: c, inner: inner}
+}
+
+type transport struct {
+	cassette *Cassette
+	inner    http.RoundTripper
+}
+
+//request returns the interaction of req, without its response
+func request(req *http.Request) (*Interaction, error) {
+	i := &Interaction{Method: req.Method, URL: req.URL.String(), Range: req.Header.Get("Range")}
+	if req.Body == nil || req.Body == http.NoBody {
+		return i, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if len(body) > 0 {
+		sum := sha1.Sum(body)
+		i.RequestHash = hex.EncodeToString(sum[:])
+	}
+	return i, nil
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i, err := request(req)
+	if err != nil {
+		return nil, err
+	}
+	if t.cassette.replay {
+		return t.cassette.play(req, i)
+	}
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.cassette.record(resp, i)
+}
+
+//record saves the response body while it is read, and the interaction when it is closed
+func (c *Cassette) record(resp *http.Response, i *Interaction) (*http.Response, error) {
+	c.mu.Lock()
+	c.count++
+	i.Body = fmt.Sprintf("%06d.body", c.count)
+	c.mu.Unlock()
+	file, err := os.Create(filepath.Join(c.folder, i.Body))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	i.Status = resp.StatusCode
+	i.Header = resp.Header.Clone()
+	i.Header.Del("Set-Cookie")
+	i.Length = resp.ContentLength
+	resp.Body = &recording{cassette: c, interaction: i, body: resp.Body, file: file}
+	return resp, nil
+}
+
+//recording is a response body copied to the cassette
+type recording struct {
+	cassette    *Cassette
+	interaction *Interaction
+	body        io.ReadCloser
+	file        *os.File
+	once        sync.Once
+}
+
+func (r *recording) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.file.Write(p[:n])
+	}
+	return n, err
+}
+
+func (r *recording) Close() error {
+	err := r.body.Close()
+	r.once.Do(func() {
+		r.file.Close()
+		data, jsonErr := json.Marshal(r.interaction)
+		if jsonErr != nil {
+			return
+		}
+		r.cassette.mu.Lock()
+		r.cassette.index.Write(append(data, '\n'))
+		r.cassette.mu.Unlock()
+	})
+	return err
+}
+
+//play returns the next recorded response of the request, the last one is repeated
+func (c *Cassette) play(req *http.Request, i *Interaction) (*http.Response, error) {
+	c.mu.Lock()
+	tape := c.tapes[i.key()]
+	if len(tape) == 0 {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("cassette: no recorded response for %v %v", i.Method, i.URL)
+	}
+	recorded := tape[0]
+	if len(tape) > 1 {
+		c.tapes[i.key()] = tape[1:]
+	}
+	c.mu.Unlock()
+	body, err := os.Open(filepath.Join(c.folder, recorded.Body))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%v %v", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          body,
+		ContentLength: recorded.Length,
+		Request:       req,
+	}, nil
+}
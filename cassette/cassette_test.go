@@ -0,0 +1,85 @@
+package cassette
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//replayClient returns a client of the API replaying the cassette in folder
+func replayClient(t *testing.T, folder string) *photos.Client {
+	tape, err := Replay(folder)
+	if err != nil {
+		t.Fatalf("Unable to load cassette: %v", err)
+	}
+	return photos.New(&http.Client{Transport: tape.Transport(nil)})
+}
+
+//ids returns the IDs of items
+func ids(items []*photos.MediaItem) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.ID)
+	}
+	return out
+}
+
+var libraryIDs = []string{"REPLAYITEM0001", "REPLAYITEM0002", "REPLAYITEM0003"}
+
+func TestReplayList(t *testing.T) {
+	client := replayClient(t, "testdata/library")
+	var items []*photos.MediaItem
+	pageToken := ""
+	for pages := 1; ; pages++ {
+		resp, err := client.ListMediaItems(2, pageToken)
+		if err != nil {
+			t.Fatalf("page %v: %v", pages, err)
+		}
+		items = append(items, resp.MediaItems...)
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			if pages != 2 {
+				t.Errorf("%v pages, want 2", pages)
+			}
+			break
+		}
+	}
+	if !reflect.DeepEqual(ids(items), libraryIDs) {
+		t.Fatalf("listed %v, want %v", ids(items), libraryIDs)
+	}
+	metadata := items[0].MediaMetadata
+	if metadata.CreationTime != "2019-01-01T10:00:00Z" || metadata.Width != 4032 || metadata.Photo.CameraModel != "Pixel 3" {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+}
+
+func TestReplaySearch(t *testing.T) {
+	client := replayClient(t, "testdata/library")
+	var items []*photos.MediaItem
+	req := &photos.SearchMediaItemsRequest{PageSize: 2}
+	for {
+		resp, err := client.SearchMediaItems(req)
+		if err != nil {
+			t.Fatalf("page token '%v': %v", req.PageToken, err)
+		}
+		items = append(items, resp.MediaItems...)
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if !reflect.DeepEqual(ids(items), libraryIDs) {
+		t.Fatalf("found %v, want %v", ids(items), libraryIDs)
+	}
+}
+
+func TestReplayNotRecorded(t *testing.T) {
+	client := replayClient(t, "testdata/library")
+	_, err := client.SearchMediaItems(&photos.SearchMediaItemsRequest{PageSize: 3})
+	if err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Fatalf("search not recorded: got %v, want no recorded response", err)
+	}
+}
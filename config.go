@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+//configured are the flags set by the config file, to set them back to their default when they
+//are removed from it
+var configured = make(map[string]bool)
+
+//reloadPending is set by SIGHUP, the config file is read again before the next run
+var reloadPending atomic.Bool
+
+//readConfig reads a config file of flags, one per line: the name of the flag and its value,
+//such as 'throttle = 5' or 'max-rate 1MB', or only the name of a boolean flag. empty lines and
+//lines starting with # are ignored
+func readConfig(fileName string) (map[string]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value := line, "true"
+		if i := strings.IndexAny(line, "= \t"); i >= 0 {
+			name, value = line[:i], strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line[i:]), "="))
+		}
+		name = strings.TrimLeft(name, "-")
+		if flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("Unknown option '%v' on line %v of '%v'", name, n, fileName)
+		}
+		if name == "config" {
+			return nil, fmt.Errorf("'%v' can not include another config file, line %v", fileName, n)
+		}
+		values[name] = strings.Trim(value, `"`)
+	}
+	return values, scanner.Err()
+}
+
+//resetter is a flag.Value cleared before it is set again, such as lists appending to their value
+type resetter interface {
+	reset()
+}
+
+//applyConfig sets the flags of the config file not given on the command line, which take
+//precedence. flags removed from the file since the last time are set back to their default
+func applyConfig(fileName string) error {
+	values, err := readConfig(fileName)
+	if err != nil {
+		return err
+	}
+	cmdline := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		if !configured[f.Name] {
+			cmdline[f.Name] = true
+		}
+	})
+	for name := range configured {
+		if _, ok := values[name]; !ok {
+			f := flag.Lookup(name)
+			if r, ok := f.Value.(resetter); ok {
+				r.reset()
+				//an empty default is the value of reset, such as an empty list
+				if f.DefValue == "" {
+					delete(configured, name)
+					continue
+				}
+			}
+			err = f.Value.Set(f.DefValue)
+			if err != nil {
+				return err
+			}
+			delete(configured, name)
+		}
+	}
+	for name, value := range values {
+		if cmdline[name] {
+			continue
+		}
+		f := flag.Lookup(name)
+		if r, ok := f.Value.(resetter); ok {
+			r.reset()
+		}
+		err = flag.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("Invalid value '%v' of '%v' in '%v': %v", value, name, fileName, err)
+		}
+		configured[name] = true
+	}
+	return nil
+}
+
+//reloadConfig reads the config file again if SIGHUP was received since the last run
+func reloadConfig() {
+	if options.configFile == "" || !reloadPending.Swap(false) {
+		return
+	}
+	log.Printf("Reloading the configuration '%v'", options.configFile)
+	err := applyConfig(options.configFile)
+	if err != nil {
+		log.Printf("Unable to reload the configuration: %v", err)
+	}
+}
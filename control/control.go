@@ -0,0 +1,184 @@
+package control
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+//serviceName is the name of the service in control.proto
+const serviceName = "gitmoo.control.Control"
+
+//daemon is the state of the daemon shared with the service
+var daemon = struct {
+	sync.Mutex
+	running bool
+}{}
+
+//starts are the Start requests, a request is kept until the daemon takes it
+var starts = make(chan struct{}, 1)
+
+//SetRunning records whether a run is in progress
+func SetRunning(running bool) {
+	daemon.Lock()
+	daemon.running = running
+	daemon.Unlock()
+}
+
+//Starts returns the Start requests, the daemon waits on it between runs
+func Starts() <-chan struct{} {
+	return starts
+}
+
+//Server is the Control service of control.proto
+type Server interface {
+	Start(context.Context, *Request) (*Status, error)
+	Pause(context.Context, *Request) (*Status, error)
+	Resume(context.Context, *Request) (*Status, error)
+	GetStatus(context.Context, *Request) (*Status, error)
+	Progress(*ProgressRequest, grpc.ServerStream) error
+}
+
+//service implements Server over the downloader
+type service struct{}
+
+//status returns the status of the daemon with message
+func status(message string) *Status {
+	daemon.Lock()
+	running := daemon.running
+	daemon.Unlock()
+	s := downloader.Stats()
+	return &Status{
+		Running:    running,
+		Paused:     downloader.Paused(),
+		Processed:  int64(s.Total),
+		Downloaded: int64(s.Downloaded),
+		Skipped:    int64(s.Skipped),
+		Errors:     int64(s.Errors),
+		Bytes:      s.TotalSize,
+		Expected:   int64(s.Expected),
+		Started:    s.Started.Unix(),
+		Message:    message,
+	}
+}
+
+func (service) Start(ctx context.Context, req *Request) (*Status, error) {
+	daemon.Lock()
+	running := daemon.running
+	daemon.Unlock()
+	if running {
+		return status("A run is in progress"), nil
+	}
+	select {
+	case starts <- struct{}{}:
+		log.Println("Starting a run, requested by the control service")
+	default:
+	}
+	return status("Starting a run"), nil
+}
+
+func (service) Pause(ctx context.Context, req *Request) (*Status, error) {
+	if !downloader.Pause() {
+		return status("The downloads are already paused"), nil
+	}
+	return status("Pausing the downloads"), nil
+}
+
+func (service) Resume(ctx context.Context, req *Request) (*Status, error) {
+	if !downloader.Resume() {
+		return status("The downloads are not paused"), nil
+	}
+	return status("Resuming the downloads"), nil
+}
+
+func (service) GetStatus(ctx context.Context, req *Request) (*Status, error) {
+	return status(""), nil
+}
+
+func (service) Progress(req *ProgressRequest, stream grpc.ServerStream) error {
+	interval := time.Duration(req.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := stream.SendMsg(status(""))
+		if err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+//unary returns the handler of a call taking a Request
+func unary(call func(Server, context.Context, *Request) (*Status, error), method string) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := &Request{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(Server), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + method}
+			return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(Server), ctx, req.(*Request))
+			})
+		},
+	}
+}
+
+//serviceDesc describes the Control service to grpc
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		unary(Server.Start, "Start"),
+		unary(Server.Pause, "Pause"),
+		unary(Server.Resume, "Resume"),
+		unary(Server.GetStatus, "GetStatus"),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Progress",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := &ProgressRequest{}
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(Server).Progress(req, stream)
+		},
+		ServerStreams: true,
+	}},
+	Metadata: "control.proto",
+}
+
+//Serve serves the Control service on address in the background, it returns an error if the
+//address can not be listened on
+func Serve(address string) error {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer()
+	s.RegisterService(&serviceDesc, service{})
+	log.Printf("Serving the control service on %v", lis.Addr())
+	go func() {
+		err := s.Serve(lis)
+		if err != nil {
+			log.Printf("The control service stopped: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,47 @@
+package control
+
+import "github.com/golang/protobuf/proto"
+
+//The messages of control.proto
+
+//Request is the request of the calls without parameters
+type Request struct {
+}
+
+func (m *Request) Reset()         { *m = Request{} }
+func (m *Request) String() string { return proto.CompactTextString(m) }
+
+//ProtoMessage implements proto.Message
+func (*Request) ProtoMessage() {}
+
+//ProgressRequest is the request of Progress
+type ProgressRequest struct {
+	//IntervalSeconds is the time between two statuses, 1 second if not set
+	IntervalSeconds int32 `protobuf:"varint,1,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"`
+}
+
+func (m *ProgressRequest) Reset()         { *m = ProgressRequest{} }
+func (m *ProgressRequest) String() string { return proto.CompactTextString(m) }
+
+//ProtoMessage implements proto.Message
+func (*ProgressRequest) ProtoMessage() {}
+
+//Status is the state of the daemon and the statistics of the current or last run
+type Status struct {
+	Running    bool   `protobuf:"varint,1,opt,name=running,proto3" json:"running,omitempty"`
+	Paused     bool   `protobuf:"varint,2,opt,name=paused,proto3" json:"paused,omitempty"`
+	Processed  int64  `protobuf:"varint,3,opt,name=processed,proto3" json:"processed,omitempty"`
+	Downloaded int64  `protobuf:"varint,4,opt,name=downloaded,proto3" json:"downloaded,omitempty"`
+	Skipped    int64  `protobuf:"varint,5,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	Errors     int64  `protobuf:"varint,6,opt,name=errors,proto3" json:"errors,omitempty"`
+	Bytes      uint64 `protobuf:"varint,7,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Expected   int64  `protobuf:"varint,8,opt,name=expected,proto3" json:"expected,omitempty"`
+	Started    int64  `protobuf:"varint,9,opt,name=started,proto3" json:"started,omitempty"`
+	Message    string `protobuf:"bytes,10,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (m *Status) Reset()         { *m = Status{} }
+func (m *Status) String() string { return proto.CompactTextString(m) }
+
+//ProtoMessage implements proto.Message
+func (*Status) ProtoMessage() {}
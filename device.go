@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	deviceCodeURL  = "https://oauth2.googleapis.com/device/code"
+	deviceTokenURL = "https://oauth2.googleapis.com/token"
+	deviceGrant    = "urn:ietf:params:oauth:grant-type:device_code"
+	//deviceScopeHelp is how to authorize when Google refuses the scopes in the device flow
+	deviceScopeHelp = "Google does not allow the Google Photos scopes in the device flow. Authorize with -auth local " +
+		"instead: on a machine without a browser, forward the port of -oauth-listen with 'ssh -L 8085:127.0.0.1:8085 [machine]' " +
+		"and open the link printed on the computer running ssh"
+)
+
+//deviceCode is the response of the device authorization request
+type deviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Error           string `json:"error"`
+}
+
+//deviceToken is the response of the device token polling request
+type deviceToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+func postForm(u string, v url.Values, out interface{}) error {
+	resp, err := http.PostForm(u, v)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("%v: %v", resp.Status, err)
+	}
+	return nil
+}
+
+// Request a token using the device authorization flow, for machines without a browser.
+func getTokenFromDevice(config *oauth2.Config) *oauth2.Token {
+	code := &deviceCode{}
+	err := postForm(deviceCodeURL, url.Values{
+		"client_id": {config.ClientID},
+		"scope":     {strings.Join(config.Scopes, " ")},
+	}, code)
+	if err != nil {
+		log.Fatalf("Unable to request device code: %v", err)
+	}
+	if code.Error == "invalid_scope" {
+		log.Fatalf("Unable to request device code: %v", deviceScopeHelp)
+	}
+	if code.DeviceCode == "" {
+		log.Fatalf("Unable to request device code, make sure the OAuth client type is 'TVs and Limited Input devices'")
+	}
+	fmt.Printf("On another device, go to the following link and enter the code %v:\n%v\n", code.UserCode, code.VerificationURL)
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		resp := &deviceToken{}
+		err = postForm(deviceTokenURL, url.Values{
+			"client_id":     {config.ClientID},
+			"client_secret": {config.ClientSecret},
+			"device_code":   {code.DeviceCode},
+			"grant_type":    {deviceGrant},
+		}, resp)
+		if err != nil {
+			log.Fatalf("Unable to retrieve token from device flow: %v", err)
+		}
+		switch resp.Error {
+		case "":
+			return &oauth2.Token{
+				AccessToken:  resp.AccessToken,
+				TokenType:    resp.TokenType,
+				RefreshToken: resp.RefreshToken,
+				Expiry:       time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+			}
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		case "invalid_scope":
+			log.Fatalf("Unable to retrieve token from device flow: %v", deviceScopeHelp)
+		default:
+			log.Fatalf("Unable to retrieve token from device flow: %v", resp.Error)
+		}
+	}
+	log.Println("Device code expired before authorization was completed")
+	os.Exit(exitAuthRequired)
+	return nil
+}
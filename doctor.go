@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/downloader"
+	"github.com/stevedenman/gitmoo-goog/photos"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	//enableAPIURL is where to enable the Photos Library API and download credentials.json
+	enableAPIURL = "https://developers.google.com/photos/library/guides/get-started#enable-the-api"
+	//tokenInfoURL returns the scopes and the expiry of an access token
+	tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+	//maxClockSkew is the difference with the time of the Google servers reported as a problem
+	maxClockSkew = time.Minute
+	//doctorTimeout limits every request of the doctor command
+	doctorTimeout = 30 * time.Second
+)
+
+//doctor checks the setup one step at a time and logs how to fix what is wrong
+type doctor struct {
+	failed int
+	config *oauth2.Config
+	tok    *oauth2.Token
+}
+
+//ok logs a check that passed
+func (d *doctor) ok(check string, format string, args ...interface{}) {
+	log.Printf("OK    %v: %v", check, fmt.Sprintf(format, args...))
+}
+
+//warn logs a problem that does not stop the backups
+func (d *doctor) warn(check string, problem string, fix string) {
+	log.Printf("WARN  %v: %v", check, problem)
+	log.Printf("      Fix: %v", fix)
+}
+
+//fail logs a problem and how to fix it
+func (d *doctor) fail(check string, problem string, fix string) {
+	d.failed++
+	log.Printf("FAIL  %v: %v", check, problem)
+	log.Printf("      Fix: %v", fix)
+}
+
+//runDoctor checks the credentials, the token, the API, the clock and the backup folder
+func runDoctor() error {
+	d := &doctor{}
+	if d.checkCredentials() && d.checkToken() {
+		d.checkScopes()
+		d.checkAPI()
+	}
+	d.checkClock()
+	d.checkFolder()
+	d.checkFreeSpace()
+	if d.failed > 0 {
+		return fmt.Errorf("Setup checks failed: %v", d.failed)
+	}
+	log.Println("All checks passed")
+	return nil
+}
+
+//checkCredentials reads credentials.json
+func (d *doctor) checkCredentials() bool {
+	const check = "credentials"
+	b, err := readSecret("credentials", "credentials.json")
+	if err != nil {
+		d.fail(check, fmt.Sprintf("Unable to read client secret file: %v", err),
+			"Enable the Photos Library API and download the OAuth client configuration as credentials.json next to gitmoo-goog: "+enableAPIURL)
+		return false
+	}
+	config, err := google.ConfigFromJSON(b, scopes()...)
+	if err != nil {
+		d.fail(check, fmt.Sprintf("Unable to parse client secret file: %v", err),
+			"credentials.json must be the OAuth client configuration (Desktop app or TVs and Limited Input devices), not a service account key. Download it again: "+enableAPIURL)
+		return false
+	}
+	d.config = config
+	d.ok(check, "OAuth client %v", config.ClientID)
+	return true
+}
+
+//checkToken reads the token cache and refreshes the token
+func (d *doctor) checkToken() bool {
+	const check = "token"
+	data, err := readSecret("token", options.tokenFile)
+	if err != nil {
+		d.fail(check, fmt.Sprintf("No token: %v", err),
+			"Run 'gitmoo-goog auth' in a terminal to authorize, with -auth local and an ssh port forward on a machine without a browser (see -oauth-listen)")
+		return false
+	}
+	data, err = openToken(data)
+	if err != nil {
+		d.fail(check, fmt.Sprintf("Unable to read oauth token: %v", err),
+			"Use the -token-keyfile or -token-passphrase the token was encrypted with, or delete "+options.tokenFile+" and authorize again")
+		return false
+	}
+	tok := &oauth2.Token{}
+	err = json.Unmarshal(data, tok)
+	if err != nil {
+		d.fail(check, fmt.Sprintf("Invalid token file: %v", err), "Delete "+options.tokenFile+" and run 'gitmoo-goog auth' in a terminal to authorize again")
+		return false
+	}
+	if tok.RefreshToken == "" {
+		d.warn(check, "The token has no refresh token, it stops working when it expires",
+			"Delete "+options.tokenFile+" and authorize again, the authorization link asks for offline access")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	fresh, err := d.config.TokenSource(ctx, tok).Token()
+	if err != nil {
+		if isRevoked(err) {
+			d.fail(check, "The refresh token was revoked or has expired",
+				"Delete "+options.tokenFile+" and run 'gitmoo-goog auth' in a terminal to authorize again. Tokens of apps in 'Testing' publishing status expire after 7 days, publish the app in the Google API console to avoid this")
+		} else {
+			d.fail(check, fmt.Sprintf("Unable to refresh oauth token: %v", err),
+				"Check the network connection to oauth2.googleapis.com, and that credentials.json is the client the token was authorized with")
+		}
+		return false
+	}
+	d.tok = fresh
+	d.ok(check, "valid until %v", fresh.Expiry.Local().Format("2 Jan 2006 15:04"))
+	return true
+}
+
+//checkScopes checks the token was authorized for the scopes of scopes(), and no more
+func (d *doctor) checkScopes() {
+	const check = "scopes"
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequest("GET", tokenInfoURL+"?"+url.Values{"access_token": {d.tok.AccessToken}}.Encode(), nil)
+	if err != nil {
+		d.fail(check, err.Error(), "Report an issue")
+		return
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		d.warn(check, fmt.Sprintf("Unable to check the scopes of the token: %v", err), "Check the network connection to oauth2.googleapis.com")
+		return
+	}
+	defer resp.Body.Close()
+	info := struct {
+		Scope string `json:"scope"`
+	}{}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode == http.StatusOK {
+		err = json.Unmarshal(data, &info)
+	} else if err == nil {
+		err = errors.New(resp.Status)
+	}
+	if err != nil {
+		d.warn(check, fmt.Sprintf("Unable to check the scopes of the token: %v", err), "Run doctor again later")
+		return
+	}
+	granted := make(map[string]bool)
+	for _, scope := range strings.Fields(info.Scope) {
+		granted[scope] = true
+	}
+	if !granted[photos.ReadonlyScope] {
+		d.fail(check, fmt.Sprintf("The token is not authorized to read the library, only for '%v'", info.Scope),
+			"Delete "+options.tokenFile+" and authorize again, allowing access to the Google Photos library on the consent screen")
+		return
+	}
+	if options.uploadScope && !granted[photos.AppendonlyScope] {
+		d.fail(check, "The token is not authorized to add to the library, restore fails",
+			"Delete "+options.tokenFile+" and authorize again with -upload-scope")
+		return
+	}
+	if !options.uploadScope && len(granted) > 1 {
+		d.warn(check, fmt.Sprintf("The token is authorized for more than viewing the library: '%v'", info.Scope),
+			"Backups only need read-only access, delete "+options.tokenFile+" and authorize again without -upload-scope")
+		return
+	}
+	d.ok(check, "%v", info.Scope)
+}
+
+//checkAPI calls the Photos Library API
+func (d *doctor) checkAPI() {
+	const check = "api"
+	client := oauth2.NewClient(context.Background(), d.config.TokenSource(context.Background(), d.tok))
+	client.Timeout = doctorTimeout
+	_, err := photos.New(client).ListMediaItems(1, "")
+	if err == nil {
+		d.ok(check, "the Photos Library API answered")
+		return
+	}
+	var apiErr *photos.Error
+	if !errors.As(err, &apiErr) {
+		d.fail(check, fmt.Sprintf("Unable to reach the Photos Library API: %v", err),
+			"Check the network connection, proxy (HTTPS_PROXY) and firewall for photoslibrary.googleapis.com")
+		return
+	}
+	message := strings.ToLower(apiErr.Message)
+	switch {
+	case apiErr.Code == http.StatusForbidden && (strings.Contains(message, "has not been used") || strings.Contains(message, "disabled")):
+		d.fail(check, apiErr.Message, "Enable the Photos Library API in the Google API console, for the project of credentials.json: "+enableAPIURL)
+	case apiErr.Code == http.StatusForbidden && strings.Contains(message, "scope"):
+		d.fail(check, apiErr.Message, "Delete "+options.tokenFile+" and authorize again, allowing access to the Google Photos library on the consent screen")
+	case apiErr.Code == http.StatusForbidden:
+		d.fail(check, apiErr.Message, "Check the Photos Library API is enabled for the project of credentials.json, and that the account is a test user of the app in 'Testing' status: "+enableAPIURL)
+	case apiErr.Code == http.StatusUnauthorized:
+		d.fail(check, apiErr.Message, "Delete "+options.tokenFile+" and run 'gitmoo-goog auth' in a terminal to authorize again")
+	case apiErr.Code == http.StatusTooManyRequests:
+		d.warn(check, apiErr.Message, "The daily quota of the API is used up, it resets at midnight Pacific time. Use -daily-quota to spread the runs")
+	default:
+		d.fail(check, apiErr.Message, "Run doctor again later, the API may be unavailable")
+	}
+}
+
+//checkClock compares the local time with the time of the Google servers
+func (d *doctor) checkClock() {
+	const check = "clock"
+	client := &http.Client{Timeout: doctorTimeout}
+	resp, err := client.Head(tokenInfoURL)
+	if err != nil {
+		d.warn(check, fmt.Sprintf("Unable to reach the Google servers: %v", err),
+			"Check the network connection, proxy (HTTPS_PROXY) and firewall for *.googleapis.com")
+		return
+	}
+	resp.Body.Close()
+	server, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		d.warn(check, "The Google servers did not return their time", "Run doctor again later")
+		return
+	}
+	skew := time.Since(server)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		d.fail(check, fmt.Sprintf("The clock is %v off the Google servers", skew.Round(time.Second)),
+			"Set the clock, or enable time synchronization (NTP): tokens and HTTPS certificates are checked against it")
+		return
+	}
+	d.ok(check, "%v off the Google servers", skew.Round(time.Second))
+}
+
+//checkFolder creates and removes a file in the backup folder, which must exist
+func (d *doctor) checkFolder() {
+	const check = "folder"
+	folder := downloader.Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	info, err := os.Stat(folder)
+	if os.IsNotExist(err) {
+		d.fail(check, fmt.Sprintf("'%v' does not exist", folder),
+			"Check -folder for a typo and that the disk is mounted. For a new backup, create the folder first")
+		return
+	}
+	if err == nil && !info.IsDir() {
+		d.fail(check, fmt.Sprintf("'%v' is not a folder", folder), "Check -folder")
+		return
+	}
+	if err == nil {
+		var f *os.File
+		f, err = ioutil.TempFile(folder, ".doctor")
+		if err == nil {
+			f.Close()
+			err = os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		d.fail(check, fmt.Sprintf("Unable to write to '%v': %v", folder, err),
+			"Check -folder, that the disk is mounted and that the user running gitmoo-goog can write to it (see -owner and -dir-mode)")
+		return
+	}
+	d.ok(check, "'%v' is writable", folder)
+}
+
+//checkFreeSpace checks the backup disk has more free space than -disk-reserve
+func (d *doctor) checkFreeSpace() {
+	const check = "free space"
+	folder := downloader.Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	free, known, err := downloader.FreeSpace(folder)
+	if err != nil {
+		d.warn(check, fmt.Sprintf("Unable to check free space in '%v': %v", folder, err), "Check the disk is mounted")
+		return
+	}
+	if !known {
+		d.ok(check, "not known on this platform")
+		return
+	}
+	if free < downloader.Options.DiskReserve {
+		d.fail(check, fmt.Sprintf("%v free, less than the %v of -disk-reserve", humanize.Bytes(free), humanize.Bytes(downloader.Options.DiskReserve)),
+			"Free some space, back up to a larger disk, or lower -disk-reserve")
+		return
+	}
+	d.ok(check, "%v free", humanize.Bytes(free))
+}
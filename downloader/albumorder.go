@@ -0,0 +1,104 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//AlbumFoldersName returns the folder of the album folders of Options.AlbumOrder
+func AlbumFoldersName() string {
+	return filepath.Clean(Options.BackupFolder) + "-albums"
+}
+
+//positionWidth is the number of digits of the position of the files of an album with count
+//items, at least 3 so short albums sort the same way once they grow
+func positionWidth(count int) int {
+	width := len(fmt.Sprint(count))
+	if width < 3 {
+		return 3
+	}
+	return width
+}
+
+//linkAlbums links the files of every album of the manifests in a folder per album, named with
+//their position in the album so file browsers show them in album order. the folders are
+//rebuilt, so files moved in or removed from an album are renamed or removed
+func linkAlbums() {
+	manifests, err := ReadManifests()
+	if err != nil {
+		log.Printf("Unable to create the album folders: %v", err)
+		return
+	}
+	root := AlbumFoldersName()
+	used := make(map[string]bool)
+	for _, m := range manifests {
+		name := sanitize(m.Title)
+		if used[strings.ToLower(name)] {
+			name += "_" + m.ID[len(m.ID)-8:]
+		}
+		used[strings.ToLower(name)] = true
+		err = linkAlbum(m, filepath.Join(root, name))
+		if err != nil {
+			log.Printf("Unable to create the folder of album '%v': %v", m.Title, err)
+		}
+	}
+}
+
+//linkAlbum links the files of the album m in folder
+func linkAlbum(m *AlbumManifest, folder string) error {
+	width := positionWidth(len(m.Items))
+	links := make(map[string]string)
+	for i, item := range m.Items {
+		source := filepath.Join(Options.BackupFolder, filepath.FromSlash(item.File))
+		if Options.CAS != "" {
+			if object := objectFile(item.File); object != "" {
+				source = object
+			}
+		}
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+		links[fmt.Sprintf("%0*d_%v", width, i+1, path.Base(item.File))] = source
+	}
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, e := range entries {
+		link := filepath.Join(folder, e.Name())
+		source, ok := links[e.Name()]
+		if ok && sameFile(source, link) {
+			delete(links, e.Name())
+			continue
+		}
+		err = os.Remove(link)
+		if err != nil {
+			return err
+		}
+	}
+	for name, source := range links {
+		err = linkFile(source, filepath.Join(folder, name))
+		if err != nil {
+			return err
+		}
+	}
+	if len(links) > 0 {
+		log.Printf("Linked %v files in the folder of album '%v'", len(links), m.Title)
+	}
+	return nil
+}
+
+//sameFile checks if link is a link to source
+func sameFile(source string, link string) bool {
+	a, err := os.Stat(source)
+	if err != nil {
+		return false
+	}
+	b, err := os.Stat(link)
+	return err == nil && os.SameFile(a, b)
+}
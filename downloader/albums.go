@@ -0,0 +1,256 @@
+package downloader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//AlbumsFolder is the sub folder of the backup folder that holds album manifests
+const AlbumsFolder = "albums"
+
+//AlbumManifest records an album and the local files of its items
+type AlbumManifest struct {
+	//ID is the Google Photos album ID
+	ID string `json:"id"`
+	//Title of the album
+	Title string `json:"title"`
+	//ProductURL is the page of the album in Google Photos
+	ProductURL string `json:"productUrl,omitempty"`
+	//CoverItemID is the media item of the cover photo of the album
+	CoverItemID string `json:"coverItemId,omitempty"`
+	//CoverFile is the file of the cover photo, relative to the backup folder. empty if the
+	//cover is not an item of the album
+	CoverFile string `json:"coverFile,omitempty"`
+	//Items of the album, in album order
+	Items []AlbumItem `json:"items"`
+	//Truncated is set when Items are only the first items of the album, with Options.AlbumMax
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+//AlbumItem is an item of an album
+type AlbumItem struct {
+	//ID is the media item ID
+	ID string `json:"id"`
+	//File is the media file, relative to the backup folder
+	File string `json:"file"`
+}
+
+//add records item with the file it is given in folder, resolve replaces it with the file it was saved to
+func (m *AlbumManifest) add(folder string, item *photos.MediaItem) {
+	imageName, _ := getItemFileNames(folder, item)
+	m.Items = append(m.Items, AlbumItem{ID: item.ID, File: relativeName(imageName)})
+}
+
+//resolve sets the files of the items to where they were saved, from the hash index, once the
+//downloads are done: saving an item may change its extension, rename it or keep the file of an
+//earlier run
+func (m *AlbumManifest) resolve() {
+	for i := range m.Items {
+		if entry, ok := hashEntry(m.Items[i].ID); ok {
+			m.Items[i].File = entry.File
+		}
+		if m.Items[i].ID == m.CoverItemID {
+			m.CoverFile = m.Items[i].File
+		}
+	}
+}
+
+//pendingManifests are the manifests of the albums searched by the run, written by writeManifests
+var pendingManifests = struct {
+	sync.Mutex
+	manifests []*AlbumManifest
+}{}
+
+//queueManifest adds m to the manifests written at the end of the run
+func queueManifest(m *AlbumManifest) {
+	pendingManifests.Lock()
+	pendingManifests.manifests = append(pendingManifests.manifests, m)
+	pendingManifests.Unlock()
+}
+
+//writeManifests writes the manifests of the run with the files of their items, once the downloads
+//are done. returns the first error
+func writeManifests() error {
+	pendingManifests.Lock()
+	manifests := pendingManifests.manifests
+	pendingManifests.manifests = nil
+	pendingManifests.Unlock()
+	var first error
+	for _, m := range manifests {
+		m.resolve()
+		err := WriteManifest(m)
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+//ManifestFileName returns the manifest file of an album
+func ManifestFileName(albumID string) string {
+	return filepath.Join(Options.BackupFolder, AlbumsFolder, albumID+".json")
+}
+
+//WriteManifest saves an album manifest in the backup folder
+func WriteManifest(m *AlbumManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	fileName := ManifestFileName(m.ID)
+	err = MkdirAll(filepath.Dir(fileName))
+	if err != nil {
+		return err
+	}
+	return writeFile(fileName, data)
+}
+
+//ReadManifests reads all album manifests in the backup folder
+func ReadManifests() ([]*AlbumManifest, error) {
+	files, err := filepath.Glob(filepath.Join(Options.BackupFolder, AlbumsFolder, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifests := make([]*AlbumManifest, 0)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		m := &AlbumManifest{}
+		err = json.Unmarshal(data, m)
+		if err != nil {
+			log.Printf("Ignoring invalid album manifest '%v': %v", f, err)
+			continue
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+//listAlbums returns all albums of the account
+func listAlbums(svc photos.Library) ([]*photos.Album, error) {
+	albums := make([]*photos.Album, 0)
+	pageToken := ""
+	for {
+		resp, err := svc.ListAlbums(pageToken)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, resp.Albums...)
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			return albums, nil
+		}
+	}
+}
+
+//downloadAlbumItems downloads the items of album and queues its manifest
+func downloadAlbumItems(svc photos.Library, album *photos.Album, seen map[string]bool) (bool, error) {
+	log.Printf("Downloading album '%v' (%v items)", album.Title, album.MediaItemsCount)
+	manifest := &AlbumManifest{ID: album.ID, Title: album.Title, ProductURL: album.ProductURL, CoverItemID: album.CoverPhotoMediaItemID}
+	req := &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), AlbumID: album.ID}
+	p := &pass{folder: Options.BackupFolder, manifest: manifest, limit: Options.AlbumMax, album: newAlbumStats(album.ID, album.Title, album.MediaItemsCount)}
+	more, err := downloadSearch(svc, req, p, seen)
+	if err != nil {
+		return false, err
+	}
+	if more {
+		//the search stopped at Options.AlbumMax
+		manifest.Truncated = !p.complete
+		queueManifest(manifest)
+	}
+	return more, nil
+}
+
+//expectAlbum adds the items of album to the expected item count
+func expectAlbum(album *photos.Album) {
+	count := int(album.MediaItemsCount)
+	if Options.AlbumMax > 0 && count > Options.AlbumMax {
+		count = Options.AlbumMax
+	}
+	stats.expected.Add(int64(count))
+}
+
+//downloadAlbumList downloads the albums in albumIDs
+func downloadAlbumList(svc photos.Library, albumIDs []string, seen map[string]bool) (bool, error) {
+	albums := make([]*photos.Album, 0)
+	for _, id := range albumIDs {
+		album, err := svc.GetAlbum(id)
+		if err != nil {
+			return false, err
+		}
+		expectAlbum(album)
+		albums = append(albums, album)
+	}
+	return eachAlbum(albums, func(album *photos.Album) (bool, error) {
+		return downloadAlbumItems(svc, album, seen)
+	})
+}
+
+//downloadAlbums writes manifests for all albums, downloading items not seen yet
+func downloadAlbums(svc photos.Library, seen map[string]bool) (bool, error) {
+	albums, err := listAlbums(svc)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range albums {
+		expectAlbum(a)
+	}
+	return eachAlbum(albums, func(album *photos.Album) (bool, error) {
+		return downloadAlbumItems(svc, album, seen)
+	})
+}
+
+//eachAlbum calls download for every album, Options.AlbumWorkers albums at a time
+func eachAlbum(albums []*photos.Album, download func(*photos.Album) (bool, error)) (bool, error) {
+	return parallel(limitWorkers(Options.AlbumWorkers), len(albums), func(i int) (bool, error) {
+		return download(albums[i])
+	})
+}
+
+//parallel calls run for 0 to count-1, workers at a time. it stops starting runs after an error
+//or once MaxItems was reached (run returns false), and returns the first error
+func parallel(workers int, count int, run func(i int) (bool, error)) (bool, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var first error
+	more := true
+	slots := make(chan struct{}, workers)
+	for i := 0; i < count; i++ {
+		slots <- struct{}{}
+		mu.Lock()
+		stop := first != nil || !more
+		mu.Unlock()
+		if stop {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, err := run(i)
+			mu.Lock()
+			if err != nil && first == nil {
+				first = err
+			}
+			if !m {
+				more = false
+			}
+			mu.Unlock()
+			<-slots
+		}(i)
+	}
+	wg.Wait()
+	if first != nil {
+		return false, first
+	}
+	return more, nil
+}
@@ -0,0 +1,183 @@
+package downloader
+
+import (
+	"log"
+	"sync"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+//AlbumStats are the statistics of the items of one album in a run
+type AlbumStats struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	//Items is the number of items of the album seen by the run
+	Items int `json:"items"`
+	//Downloaded is the number of items of the album downloaded
+	Downloaded int `json:"downloaded"`
+	//Skipped is the number of items of the album left out by the filters
+	Skipped int `json:"skipped"`
+	//Errors is the number of items of the album that failed to download
+	Errors int `json:"errors"`
+	//Bytes is the number of bytes downloaded for the album
+	Bytes uint64 `json:"bytes"`
+	//Expected is the number of items of the album reported by the API (mediaItemsCount)
+	Expected int `json:"expected"`
+	//Missing is the number of items of Expected the search did not return, 0 if the search
+	//of the album did not complete
+	Missing int `json:"missing"`
+	//members are the item IDs of the album
+	members []string
+	//complete is set when the search returned all the items of the album
+	complete bool
+}
+
+//outcome is what happened to one item in the run
+type outcome struct {
+	downloaded bool
+	skipped    bool
+	failed     bool
+	bytes      uint64
+}
+
+//tallies are the outcomes of the items and the albums of the run, an item is downloaded once
+//but may belong to many albums, so the albums are totalled at the end of the run
+var tallies struct {
+	sync.Mutex
+	items  map[string]*outcome
+	albums []*AlbumStats
+	//library is the number of items returned by the search of the whole library, -1 if the
+	//run did not search all of it
+	library int
+}
+
+//resetTallies forgets the outcomes of the previous run
+func resetTallies() {
+	tallies.Lock()
+	defer tallies.Unlock()
+	tallies.items = make(map[string]*outcome)
+	tallies.albums = nil
+	tallies.library = -1
+}
+
+//itemOutcome returns the outcome of the item id, the lock must be held
+func itemOutcome(id string) *outcome {
+	o := tallies.items[id]
+	if o == nil {
+		o = &outcome{}
+		tallies.items[id] = o
+	}
+	return o
+}
+
+//tallyBytes records n bytes downloaded for the item id
+func tallyBytes(id string, n int64) {
+	tallies.Lock()
+	defer tallies.Unlock()
+	o := itemOutcome(id)
+	o.downloaded = true
+	o.bytes += uint64(n)
+}
+
+//tallySkipped records the item id was left out
+func tallySkipped(id string) {
+	tallies.Lock()
+	defer tallies.Unlock()
+	itemOutcome(id).skipped = true
+}
+
+//tallyFailed records the item id failed to download
+func tallyFailed(id string) {
+	tallies.Lock()
+	defer tallies.Unlock()
+	itemOutcome(id).failed = true
+}
+
+//tallyLibrary records the search of the whole library returned n items
+func tallyLibrary(n int) {
+	tallies.Lock()
+	tallies.library = n
+	tallies.Unlock()
+}
+
+//libraryResult returns the number of items returned by the search of the whole library
+func libraryResult() int {
+	tallies.Lock()
+	defer tallies.Unlock()
+	return tallies.library
+}
+
+//newAlbumStats starts the statistics of an album with expected items
+func newAlbumStats(id string, title string, expected int64) *AlbumStats {
+	a := &AlbumStats{ID: id, Title: title, Expected: int(expected)}
+	tallies.Lock()
+	tallies.albums = append(tallies.albums, a)
+	tallies.Unlock()
+	return a
+}
+
+//add records the item id as a member of the album
+func (a *AlbumStats) add(id string) {
+	tallies.Lock()
+	a.members = append(a.members, id)
+	tallies.Unlock()
+}
+
+//done records the search returned all the items of the album
+func (a *AlbumStats) done() {
+	tallies.Lock()
+	a.complete = true
+	tallies.Unlock()
+}
+
+//albumResults totals the outcomes of the members of every album
+func albumResults() []AlbumStats {
+	tallies.Lock()
+	defer tallies.Unlock()
+	results := make([]AlbumStats, 0, len(tallies.albums))
+	for _, a := range tallies.albums {
+		r := AlbumStats{ID: a.ID, Title: a.Title, Items: len(a.members), Expected: a.Expected}
+		if a.complete && a.Expected > r.Items {
+			r.Missing = a.Expected - r.Items
+		}
+		for _, id := range a.members {
+			o := tallies.items[id]
+			if o == nil {
+				continue
+			}
+			if o.downloaded {
+				r.Downloaded++
+			}
+			if o.skipped {
+				r.Skipped++
+			}
+			if o.failed {
+				r.Errors++
+			}
+			r.Bytes += o.bytes
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+//logAlbums logs the statistics of every album of the run
+func logAlbums(albums []AlbumStats) {
+	for _, a := range albums {
+		log.Printf("Album '%v': Items: %v, Downloaded: %v, Skipped: %v, Errors: %v, Total Size: %v",
+			a.Title, a.Items, a.Downloaded, a.Skipped, a.Errors, humanize.Bytes(a.Bytes))
+	}
+}
+
+//logCompleteness logs the albums and the library with items the search did not return: the
+//API leaves out some items without an error, such as videos still processing
+func logCompleteness(r *Result) {
+	for _, a := range r.Albums {
+		if a.Missing > 0 {
+			log.Printf("Album '%v' has %v items but the API returned %v, %v might be missing", a.Title, a.Expected, a.Items, a.Missing)
+		}
+	}
+	if r.LibraryItems >= 0 && Options.LibraryTotal > r.LibraryItems {
+		log.Printf("The library has %v items but the API returned %v, %v might be missing", Options.LibraryTotal, r.LibraryItems, Options.LibraryTotal-r.LibraryItems)
+	}
+}
@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+const (
+	//tuneInterval is how long a number of workers runs before its throughput is compared
+	tuneInterval = 20 * time.Second
+	//tuneGain is the throughput increase (5%) needed to keep an added worker
+	tuneGain = 1.05
+)
+
+//tuner adjusts the number of workers with Options.AutoWorkers: one more worker every tuneInterval
+//while the throughput grows, half of them when downloads are rate limited or fail (AIMD)
+type tuner struct {
+	sync.Mutex
+	workers int
+	//since is the start of the current interval, bytes the downloaded bytes at that time
+	since time.Time
+	bytes uint64
+	//rate is the throughput of the previous interval, in bytes per second
+	rate float64
+	//grew is true when a worker was added at the start of the interval
+	grew bool
+	//congested is true when a download was rate limited or failed during the interval
+	congested bool
+}
+
+var tuning tuner
+
+//reset starts the run with a single worker
+func (t *tuner) reset() {
+	t.Lock()
+	defer t.Unlock()
+	t.workers = 1
+	t.since = time.Now()
+	t.bytes = stats.totalsize.Load()
+	t.rate = 0
+	t.grew = false
+	t.congested = false
+}
+
+//congestion checks if a download failed because of the number of downloads
+func congestion(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, errStalled) || errors.Is(err, errTimedOut) ||
+		errors.Is(err, errTruncated) || errors.As(err, &netErr)
+}
+
+//failure halves the workers when err is a sign of too many downloads, once per interval
+func (t *tuner) failure(err error) {
+	if !Options.AutoWorkers || !congestion(err) {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.congested {
+		return
+	}
+	t.congested = true
+	if t.workers > 1 {
+		t.workers /= 2
+		log.Printf("Downloads failing (%v), reducing to %v workers", err, t.workers)
+	}
+	t.restart()
+}
+
+//restart starts a new interval, the lock must be held
+func (t *tuner) restart() {
+	t.since = time.Now()
+	t.bytes = stats.totalsize.Load()
+}
+
+//limit returns the number of workers, up to max, and tunes it at the end of an interval
+func (t *tuner) limit(max int) int {
+	if !Options.AutoWorkers {
+		return max
+	}
+	t.Lock()
+	defer t.Unlock()
+	elapsed := time.Since(t.since)
+	if elapsed >= tuneInterval {
+		rate := float64(stats.totalsize.Load()-t.bytes) / elapsed.Seconds()
+		switch {
+		case t.congested:
+			//halved by failure
+		case t.grew && rate < t.rate*tuneGain && t.workers > 1:
+			t.workers--
+			t.grew = false
+			log.Printf("No gain from the last worker (%v/s), back to %v workers", humanize.Bytes(uint64(rate)), t.workers)
+		case t.workers < max:
+			t.workers++
+			t.grew = true
+			log.Printf("Throughput %v/s, trying %v workers", humanize.Bytes(uint64(rate)), t.workers)
+		default:
+			t.grew = false
+		}
+		t.rate = rate
+		t.congested = false
+		t.restart()
+	}
+	if t.workers > max {
+		return max
+	}
+	return t.workers
+}
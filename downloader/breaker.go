@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+const (
+	//breakerPause is the first pause of an open circuit, doubled every time it opens again
+	breakerPause = time.Minute
+	//breakerMaxPause is the longest pause of an open circuit
+	breakerMaxPause = 30 * time.Minute
+)
+
+//circuit pauses the downloads and the searches after Options.Breaker failures in a row, instead
+//of failing every item of the library while the network is down or the account is blocked
+type circuit struct {
+	sync.Mutex
+	//failures is the number of failures in a row
+	failures int
+	//opened is the number of times the circuit opened since the last success
+	opened int
+	//until is the end of the pause
+	until time.Time
+}
+
+var breaker circuit
+
+//reset closes the circuit
+func (c *circuit) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.failures = 0
+	c.opened = 0
+	c.until = time.Time{}
+}
+
+//success closes the circuit
+func (c *circuit) success() {
+	c.Lock()
+	defer c.Unlock()
+	if c.opened > 0 {
+		log.Println("Downloads work again, resuming")
+	}
+	c.failures = 0
+	c.opened = 0
+}
+
+//failure counts a failure, and opens the circuit after Options.Breaker failures in a row
+func (c *circuit) failure(err error) {
+	if Options.Breaker <= 0 {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.failures++
+	if c.failures < Options.Breaker || time.Now().Before(c.until) {
+		return
+	}
+	pause := breakerPause << uint(c.opened)
+	if pause > breakerMaxPause || pause <= 0 {
+		pause = breakerMaxPause
+	}
+	c.opened++
+	c.until = time.Now().Add(pause)
+	log.Printf("The last %v downloads or API calls failed (the network may be down or the account blocked), pausing %v. Last error: %v",
+		c.failures, pause, err)
+	//after the pause a single failure opens the circuit again
+	c.failures = Options.Breaker - 1
+}
+
+//wait blocks while the circuit is open, or until stop is closed
+func (c *circuit) wait(stop <-chan struct{}) {
+	c.Lock()
+	delay := time.Until(c.until)
+	c.Unlock()
+	if delay <= 0 {
+		return
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+}
+
+//transient checks if an API call failed in a way that may work later
+func transient(err error) bool {
+	if errors.Is(err, ErrQuotaReached) {
+		return false
+	}
+	var apiErr *photos.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500 || errors.Is(err, ErrRateLimited)
+	}
+	return true
+}
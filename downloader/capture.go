@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/exif"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//captureTimesName is the state file of the EXIF capture times used for naming, by item ID
+const captureTimesName = "capture-times.json"
+
+//maxCreationDrift is how far the creation time can be from the EXIF capture time before it
+//is considered wrong, such as the upload time
+const maxCreationDrift = 48 * time.Hour
+
+//exifScanSize is how much of a photo is read to find its EXIF segment, which is at most 64KB
+const exifScanSize = 128 * 1024
+
+//captureTimes are the EXIF capture times of the photos named after them, loaded on first use
+var captureTimes = struct {
+	sync.Mutex
+	times   map[string]time.Time
+	changed bool
+}{}
+
+//loadCaptureTimes loads the state file, captureTimes must be locked
+func loadCaptureTimes() {
+	if captureTimes.times != nil {
+		return
+	}
+	captureTimes.times = make(map[string]time.Time)
+	err := ReadState(captureTimesName, &captureTimes.times)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", captureTimesName, err)
+	}
+}
+
+//captureTime returns the EXIF capture time of item if it is named after it
+func captureTime(id string) (time.Time, bool) {
+	captureTimes.Lock()
+	defer captureTimes.Unlock()
+	loadCaptureTimes()
+	t, ok := captureTimes.times[id]
+	return t, ok
+}
+
+func setCaptureTime(id string, t time.Time) {
+	captureTimes.Lock()
+	defer captureTimes.Unlock()
+	loadCaptureTimes()
+	captureTimes.times[id] = t
+	captureTimes.changed = true
+}
+
+//resetCaptureTimes forgets the capture times of a previous run, which may be of another backup folder
+func resetCaptureTimes() {
+	captureTimes.Lock()
+	captureTimes.times = nil
+	captureTimes.changed = false
+	captureTimes.Unlock()
+}
+
+//saveCaptureTimes saves the capture times found during the run
+func saveCaptureTimes() error {
+	captureTimes.Lock()
+	defer captureTimes.Unlock()
+	if !captureTimes.changed {
+		return nil
+	}
+	captureTimes.changed = false
+	return WriteState(captureTimesName, captureTimes.times)
+}
+
+//itemTime returns the time item is named after: its EXIF capture time with Options.ExifTime if
+//it was found wrong, otherwise its creation time
+func itemTime(item *photos.MediaItem) (time.Time, error) {
+	if Options.ExifTime {
+		if t, ok := captureTime(item.ID); ok {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, item.MediaMetadata.CreationTime)
+}
+
+//fileCaptureTime reads the EXIF capture time of a photo
+func fileCaptureTime(fileName string) (time.Time, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+	data := make([]byte, exifScanSize)
+	n, err := io.ReadFull(file, data)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return time.Time{}, err
+	}
+	return exif.CaptureTime(data[:n], folderZone)
+}
+
+//rehome moves a photo whose creation time is missing or wrong to the name of its EXIF capture
+//time, with Options.ExifTime. returns the new media and sidecar names
+func rehome(item *photos.MediaItem, folder string, imageName string, jsonName string) (string, string) {
+	if !Options.ExifTime || Options.Layout == LayoutHash || item.MediaMetadata.Video != nil {
+		return imageName, jsonName
+	}
+	if _, ok := captureTime(item.ID); ok {
+		return imageName, jsonName
+	}
+	t, err := fileCaptureTime(imageName)
+	if err != nil {
+		return imageName, jsonName
+	}
+	created, err := time.Parse(time.RFC3339, item.MediaMetadata.CreationTime)
+	if err == nil && created.Sub(t) < maxCreationDrift && t.Sub(created) < maxCreationDrift {
+		return imageName, jsonName
+	}
+	setCaptureTime(item.ID, t)
+	newImage, newJSON := getItemFileNames(folder, item)
+	if newImage == imageName {
+		return imageName, jsonName
+	}
+	err = MkdirAll(filepath.Dir(newImage))
+	if err == nil {
+		err = os.Rename(imageName, newImage)
+	}
+	if err != nil {
+		log.Printf("Unable to move '%v' to '%v': %v", imageName, newImage, err)
+		captureTimes.Lock()
+		delete(captureTimes.times, item.ID)
+		captureTimes.Unlock()
+		return imageName, jsonName
+	}
+	moveHash(item.ID, newImage)
+	err = os.Rename(jsonName, newJSON)
+	if err != nil {
+		//the sidecar is written again at the new name by the next run
+		log.Printf("Unable to move '%v' to '%v': %v", jsonName, newJSON, err)
+	}
+	err = syncDir(filepath.Dir(newImage))
+	if err != nil {
+		log.Printf("Unable to flush '%v': %v", filepath.Dir(newImage), err)
+	}
+	log.Printf("Moved '%v' to '%v', its creation time %v is not its EXIF capture time %v", imageName, newImage, item.MediaMetadata.CreationTime, t.Format(time.RFC3339))
+	return newImage, newJSON
+}
@@ -0,0 +1,201 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//pathDBName is the state file mapping the media files of the backup folder to their objects,
+//with Options.CAS
+const pathDBName = "pathdb.json"
+
+//pathDB maps the media files, relative to the backup folder, to their objects relative to
+//Options.CAS. loaded on first use
+var pathDB = struct {
+	sync.Mutex
+	paths   map[string]string
+	changed bool
+}{}
+
+//loadPathDB loads the state file, pathDB must be locked
+func loadPathDB() {
+	if pathDB.paths != nil {
+		return
+	}
+	pathDB.paths = make(map[string]string)
+	err := ReadState(pathDBName, &pathDB.paths)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", pathDBName, err)
+	}
+}
+
+//resetPathDB forgets the paths of a previous run, which may be of another backup folder
+func resetPathDB() {
+	pathDB.Lock()
+	pathDB.paths = nil
+	pathDB.changed = false
+	pathDB.Unlock()
+}
+
+//savePathDB saves the paths stored during the run
+func savePathDB() error {
+	pathDB.Lock()
+	defer pathDB.Unlock()
+	if !pathDB.changed {
+		return nil
+	}
+	pathDB.changed = false
+	return WriteState(pathDBName, pathDB.paths)
+}
+
+//checkCAS checks the options of the object store and creates it
+func checkCAS() error {
+	if Options.CAS == "" {
+		return nil
+	}
+	if Options.ConvertHEIC {
+		return fmt.Errorf("HEIC conversion (-heic-to-jpeg) can not be used with the object store")
+	}
+	if len(Options.Mirrors) > 0 {
+		return fmt.Errorf("Mirrors (-mirror) can not be used with the object store")
+	}
+	Options.CAS = longPathFolder(Options.CAS)
+	return MkdirAll(Options.CAS)
+}
+
+//objectName returns the object of the content with the SHA-256 sum, the extension is kept so
+//that objects can be opened
+func objectName(sum string, ext string) string {
+	return filepath.Join(Options.CAS, sum[:2], sum[2:]+strings.ToLower(ext))
+}
+
+//stored checks if the media file fileName is in the object store
+func stored(fileName string) bool {
+	pathDB.Lock()
+	loadPathDB()
+	object, ok := pathDB.paths[relativeName(fileName)]
+	pathDB.Unlock()
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(Options.CAS, filepath.FromSlash(object)))
+	return err == nil
+}
+
+//storeObject moves the downloaded media file of the item id to the object store, or removes
+//it when the store already has the same content
+func storeObject(id string, imageName string) error {
+	sum, err := fileHash(id, imageName)
+	if err != nil {
+		return err
+	}
+	object := objectName(sum, filepath.Ext(imageName))
+	info, err := os.Stat(imageName)
+	if err != nil {
+		return err
+	}
+	existing, err := os.Stat(object)
+	if err == nil && existing.Size() == info.Size() {
+		log.Printf("'%v' is already stored as '%v'", imageName, object)
+		err = os.Remove(imageName)
+	} else {
+		err = MkdirAll(filepath.Dir(object))
+		if err != nil {
+			return err
+		}
+		err = os.Rename(imageName, object)
+		if err != nil {
+			//the store is on another filesystem
+			err = copyFile(imageName, info, object)
+			if err == nil {
+				err = os.Remove(imageName)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to store '%v' as '%v': %v", imageName, object, err)
+	}
+	rel, err := filepath.Rel(Options.CAS, object)
+	if err != nil {
+		return err
+	}
+	pathDB.Lock()
+	defer pathDB.Unlock()
+	loadPathDB()
+	pathDB.paths[relativeName(imageName)] = filepath.ToSlash(rel)
+	pathDB.changed = true
+	return nil
+}
+
+//objectFile returns the object of the media file rel, relative to the backup folder, empty if
+//it is not in the object store
+func objectFile(rel string) string {
+	pathDB.Lock()
+	defer pathDB.Unlock()
+	loadPathDB()
+	object, ok := pathDB.paths[rel]
+	if !ok {
+		return ""
+	}
+	return filepath.Join(Options.CAS, filepath.FromSlash(object))
+}
+
+//linkFile creates a hard link to source, or a symbolic link when source is on another filesystem
+func linkFile(source string, link string) error {
+	err := MkdirAll(filepath.Dir(link))
+	if err != nil {
+		return err
+	}
+	err = os.Link(source, link)
+	if err != nil {
+		abs, absErr := filepath.Abs(source)
+		if absErr != nil {
+			return absErr
+		}
+		err = os.Symlink(abs, link)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to link '%v': %v", link, err)
+	}
+	return nil
+}
+
+//Materialize builds the tree of the backup folder in target from the object store, with hard
+//links to the objects (symbolic links when the store is on another filesystem), and the sidecars
+func Materialize(target string) error {
+	if Options.CAS == "" {
+		return fmt.Errorf("Materialize needs the object store (-cas)")
+	}
+	pathDB.Lock()
+	pathDB.paths = nil
+	loadPathDB()
+	paths := pathDB.paths
+	pathDB.Unlock()
+	linked, present := 0, 0
+	for file, object := range paths {
+		source := filepath.Join(Options.CAS, filepath.FromSlash(object))
+		name := filepath.Join(target, filepath.FromSlash(file))
+		sidecar := strings.TrimSuffix(file, filepath.Ext(file)) + ".json"
+		links := map[string]string{name: source}
+		if _, err := os.Stat(filepath.Join(Options.BackupFolder, filepath.FromSlash(sidecar))); err == nil {
+			links[filepath.Join(target, filepath.FromSlash(sidecar))] = filepath.Join(Options.BackupFolder, filepath.FromSlash(sidecar))
+		}
+		for link, source := range links {
+			if _, err := os.Lstat(link); err == nil {
+				present++
+				continue
+			}
+			err := linkFile(source, link)
+			if err != nil {
+				return err
+			}
+			linked++
+		}
+	}
+	log.Printf("Linked %v files in '%v', %v were already there", linked, target, present)
+	return nil
+}
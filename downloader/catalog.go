@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+//YearStats are the items of the archive created in a year
+type YearStats struct {
+	Items int
+	Bytes uint64
+}
+
+//Catalog is the summary of the archive from its sidecars and its hash index, without API calls
+type Catalog struct {
+	//Items is the number of items, with a sidecar
+	Items int
+	//Bytes is the size of their media files in the hash index
+	Bytes uint64
+	//Unindexed is the number of items not in the hash index, their size is not known
+	Unindexed int
+	//Years are the items by year of creation, 'unknown' for the items without a creation time
+	Years map[string]*YearStats
+	//Oldest and Newest are the creation times of the oldest and newest items
+	Oldest, Newest time.Time
+	//OldestFile and NewestFile are their sidecars, relative to the backup folder
+	OldestFile, NewestFile string
+}
+
+//catalogItem are the fields of a sidecar read by ReadCatalog
+type catalogItem struct {
+	ID            string `json:"id"`
+	MediaMetadata *struct {
+		CreationTime string `json:"creationTime"`
+	} `json:"mediaMetadata"`
+}
+
+//ReadCatalog reads the sidecars and the hash index of the backup folder
+func ReadCatalog() (*Catalog, error) {
+	index, err := LoadHashIndex()
+	if err != nil {
+		return nil, err
+	}
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	skip := map[string]bool{
+		filepath.Join(folder, AlbumsFolder):     true,
+		filepath.Join(folder, QuarantineFolder): true,
+		filepath.Join(folder, StateFolder):      true,
+	}
+	c := &Catalog{Years: make(map[string]*YearStats)}
+	err = filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if skip[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(path), ".json") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var item catalogItem
+		if json.Unmarshal(data, &item) != nil || item.ID == "" {
+			//not a sidecar, such as a report
+			return nil
+		}
+		c.add(item, relativeName(path), index)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//add adds the item of the sidecar fileName
+func (c *Catalog) add(item catalogItem, fileName string, index map[string]HashEntry) {
+	c.Items++
+	year := "unknown"
+	var created time.Time
+	if item.MediaMetadata != nil {
+		t, err := time.Parse(time.RFC3339, item.MediaMetadata.CreationTime)
+		if err == nil {
+			created = t
+			year = t.UTC().Format("2006")
+		}
+	}
+	y, ok := c.Years[year]
+	if !ok {
+		y = &YearStats{}
+		c.Years[year] = y
+	}
+	y.Items++
+	if entry, ok := index[item.ID]; ok {
+		y.Bytes += uint64(entry.Size)
+		c.Bytes += uint64(entry.Size)
+	} else {
+		c.Unindexed++
+	}
+	if created.IsZero() {
+		return
+	}
+	if c.Oldest.IsZero() || created.Before(c.Oldest) {
+		c.Oldest, c.OldestFile = created, fileName
+	}
+	if created.After(c.Newest) {
+		c.Newest, c.NewestFile = created, fileName
+	}
+}
+
+//Log logs the items and bytes of every year, and the oldest and newest items
+func (c *Catalog) Log() {
+	if c.Items == 0 {
+		log.Println("Archive: no items")
+		return
+	}
+	unindexed := ""
+	if c.Unindexed > 0 {
+		unindexed = ", not counting the size of the " + humanize.Comma(int64(c.Unindexed)) + " items not in the hash index"
+	}
+	log.Printf("Archive: %v items, %v%v", c.Items, humanize.Bytes(c.Bytes), unindexed)
+	years := make([]string, 0, len(c.Years))
+	for year := range c.Years {
+		years = append(years, year)
+	}
+	sort.Strings(years)
+	for _, year := range years {
+		log.Printf("  %v: %v items, %v", year, c.Years[year].Items, humanize.Bytes(c.Years[year].Bytes))
+	}
+	if !c.Oldest.IsZero() {
+		log.Printf("Oldest item: %v ('%v')", c.Oldest.Format("2 Jan 2006"), c.OldestFile)
+		log.Printf("Newest item: %v ('%v')", c.Newest.Format("2 Jan 2006"), c.NewestFile)
+	}
+}
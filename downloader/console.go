@@ -0,0 +1,175 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//the modes of NewConsole
+const (
+	ConsoleAuto  = "auto"
+	ConsoleRich  = "rich"
+	ConsolePlain = "plain"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+//logPrefix matches the date and time the log package writes before every line
+var logPrefix = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} (\d{2}:\d{2}:\d{2}) `)
+
+//goDuration matches a time.Duration as printed by fmt, such as 1h2m3.5s or 250ms
+var goDuration = regexp.MustCompile(`\b(\d+h)?(\d+m)?\d+(\.\d+)?(s|ms|µs)\b`)
+
+//errorPrefixes and warningPrefixes start the log lines shown in red and in yellow
+var (
+	errorPrefixes   = []string{"Unable to", "Failed to", "Error ", "Search failed"}
+	warningPrefixes = []string{"Ignoring", "Waiting", "Pausing", "Retrying", "Reached the", "Transfer still"}
+)
+
+//console writes the log to a terminal: the time of the lines without the date, errors and
+//warnings in color, the fields of the progress lines in aligned columns and durations rounded
+type console struct {
+	sync.Mutex
+	out     io.Writer
+	partial string
+	//widths are the widths of the values of the fields seen so far, by name, so successive
+	//progress lines stay aligned
+	widths map[string]int
+}
+
+//NewConsole returns the writer of the log to f in mode: plain writes the log as is, rich
+//formats it for a terminal, and auto is rich when f is a terminal supporting colors and the
+//NO_COLOR environment variable is not set
+func NewConsole(mode string, f *os.File) (io.Writer, error) {
+	switch mode {
+	case ConsolePlain:
+		return f, nil
+	case ConsoleAuto:
+		if os.Getenv("NO_COLOR") != "" || !isTerminal(f) || !enableANSI(f) {
+			return f, nil
+		}
+	case ConsoleRich:
+		enableANSI(f)
+	default:
+		return nil, fmt.Errorf("Invalid console '%v', use auto, rich or plain", mode)
+	}
+	return &console{out: f, widths: make(map[string]int)}, nil
+}
+
+func (c *console) Write(p []byte) (int, error) {
+	c.Lock()
+	defer c.Unlock()
+	text := c.partial + string(p)
+	lines := strings.Split(text, "\n")
+	c.partial = lines[len(lines)-1]
+	var b strings.Builder
+	for _, line := range lines[:len(lines)-1] {
+		b.WriteString(c.format(line))
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(c.out, b.String())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+//format returns line formatted for the terminal
+func (c *console) format(line string) string {
+	clock := ""
+	if m := logPrefix.FindStringSubmatch(line); m != nil {
+		clock = ansiDim + m[1] + ansiReset + "  "
+		line = line[len(m[0]):]
+	}
+	line = goDuration.ReplaceAllStringFunc(line, humanDuration)
+	color := ""
+	for _, prefix := range errorPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			color = ansiRed
+		}
+	}
+	for _, prefix := range warningPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			color = ansiYellow
+		}
+	}
+	if color != "" {
+		return clock + color + line + ansiReset
+	}
+	if columns, ok := c.columns(line); ok {
+		return clock + columns
+	}
+	return clock + line
+}
+
+//columns returns a line of fields such as 'Processed: 10, Downloaded: 4, Errors: 0' as
+//aligned columns with the values in bold, false if line is not a line of fields
+func (c *console) columns(line string) (string, bool) {
+	fields := strings.Split(line, ", ")
+	if len(fields) < 3 || !strings.Contains(fields[0], ": ") {
+		return "", false
+	}
+	var b strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString("  ")
+		}
+		parts := strings.SplitN(field, ": ", 2)
+		if len(parts) != 2 {
+			//such as the items done of the estimate
+			b.WriteString(field)
+			continue
+		}
+		name, value := parts[0], parts[1]
+		if len(value) > c.widths[name] {
+			c.widths[name] = len(value)
+		}
+		valueColor := ansiBold
+		if name == "Errors" && value != "0" {
+			valueColor = ansiBold + ansiRed
+		} else if name == "Downloaded" && value != "0" {
+			valueColor = ansiBold + ansiGreen
+		}
+		fmt.Fprintf(&b, "%v%v%v %v%v%v", ansiDim, name, ansiReset, valueColor, value, ansiReset)
+		if i < len(fields)-1 {
+			b.WriteString(strings.Repeat(" ", c.widths[name]-len(value)))
+		}
+	}
+	return b.String(), true
+}
+
+//humanDuration rounds a duration printed by fmt and spaces its units, such as 1h 2m for
+//1h2m3.456s or 3m 12s for 3m12.5s
+func humanDuration(s string) string {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return s
+	}
+	switch {
+	case d >= time.Hour:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh %dm", d/time.Hour, d%time.Hour/time.Minute)
+	case d >= time.Minute:
+		d = d.Round(time.Second)
+		return fmt.Sprintf("%dm %ds", d/time.Minute, d%time.Minute/time.Second)
+	case d >= 10*time.Second:
+		return fmt.Sprintf("%ds", d.Round(time.Second)/time.Second)
+	case d >= time.Second:
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	case d == 0:
+		return "0s"
+	}
+	return fmt.Sprintf("%dms", d.Round(time.Millisecond)/time.Millisecond)
+}
@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//heicConverter is an external tool able to convert HEIC files to JPEG
+type heicConverter struct {
+	name string
+	args func(in string, out string) []string
+}
+
+//heicConverters are tried in order, the first one installed is used
+var heicConverters = []heicConverter{
+	{"heif-convert", func(in string, out string) []string { return []string{"-q", "92", in, out} }},
+	{"magick", func(in string, out string) []string { return []string{in, "-quality", "92", out} }},
+	{"convert", func(in string, out string) []string { return []string{in, "-quality", "92", out} }},
+	{"sips", func(in string, out string) []string { return []string{"-s", "format", "jpeg", in, "--out", out} }},
+}
+
+//isHEIC checks if item is a HEIC/HEIF photo
+func isHEIC(item *photos.MediaItem) bool {
+	switch strings.ToLower(item.MimeType) {
+	case "image/heic", "image/heif":
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(item.Filename))
+	return ext == ".heic" || ext == ".heif"
+}
+
+//jpegName returns the name of the JPEG converted from fileName
+func jpegName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".jpg"
+}
+
+//findHEICConverter returns the path and arguments builder of an installed converter
+func findHEICConverter() (string, *heicConverter, error) {
+	for i := range heicConverters {
+		path, err := exec.LookPath(heicConverters[i].name)
+		if err == nil {
+			return path, &heicConverters[i], nil
+		}
+	}
+	return "", nil, fmt.Errorf("No HEIC converter found, install libheif (heif-convert) or ImageMagick")
+}
+
+//convertHEIC converts fileName to JPEG, removing the original unless KeepHEIC is set
+func convertHEIC(fileName string) error {
+	out := jpegName(fileName)
+	in, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	converted, err := os.Stat(out)
+	if err == nil && !converted.ModTime().Before(in.ModTime()) {
+		return nil
+	}
+	path, converter, err := findHEICConverter()
+	if err != nil {
+		return err
+	}
+	output, err := exec.Command(path, converter.args(fileName, out)...).CombinedOutput()
+	if err != nil {
+		os.Remove(out)
+		return fmt.Errorf("%v failed: %v: %v", converter.name, err, strings.TrimSpace(string(output)))
+	}
+	err = setOwnership(out, fileMode(), Options.FileMode != 0)
+	if err != nil {
+		return err
+	}
+	log.Printf("Converted '%v' to JPEG", fileName)
+	if !Options.KeepHEIC {
+		return os.Remove(fileName)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package downloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+const (
+	//dashboardWidth is the width the dashboard lines are cut to
+	dashboardWidth = 80
+	//graphSeconds is the number of seconds of the throughput graph
+	graphSeconds = 60
+	//dashboardErrors is the number of failures shown
+	dashboardErrors = 5
+	//dashboardLogLines is the number of log lines shown
+	dashboardLogLines = 6
+	//keptLogLines is the number of log lines replayed when the dashboard closes
+	keptLogLines = 20
+)
+
+//graphLevels are the bars of the throughput graph, from low to high
+var graphLevels = []rune("▁▂▃▄▅▆▇█")
+
+//logTail keeps the last lines of the log while the dashboard hides it
+type logTail struct {
+	sync.Mutex
+	//next also receives the log, nil when the log went to the terminal
+	next    io.Writer
+	lines   []string
+	partial string
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+	text := t.partial + string(p)
+	parts := strings.Split(text, "\n")
+	t.partial = parts[len(parts)-1]
+	t.lines = append(t.lines, parts[:len(parts)-1]...)
+	if len(t.lines) > keptLogLines {
+		t.lines = t.lines[len(t.lines)-keptLogLines:]
+	}
+	if t.next != nil {
+		return t.next.Write(p)
+	}
+	return len(p), nil
+}
+
+//last returns the last n lines
+func (t *logTail) last(n int) []string {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.lines) > n {
+		return append([]string(nil), t.lines[len(t.lines)-n:]...)
+	}
+	return append([]string(nil), t.lines...)
+}
+
+//dashboard is the full screen view of a run, redrawn every second
+type dashboard struct {
+	p       *pipeline
+	out     io.Writer
+	logs    *logTail
+	prevLog io.Writer
+	//history is the number of bytes downloaded in each of the last seconds
+	history []uint64
+	last    uint64
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+//isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+//startDashboard shows the dashboard of the run of p, returns nil if the output is not a terminal
+func startDashboard(p *pipeline) *dashboard {
+	if !isTerminal(os.Stdout) {
+		log.Println("The output is not a terminal, not showing the dashboard")
+		return nil
+	}
+	if !enableANSI(os.Stdout) {
+		log.Println("The terminal does not support ANSI escape sequences, not showing the dashboard")
+		return nil
+	}
+	d := &dashboard{p: p, out: os.Stdout, prevLog: log.Writer(), done: make(chan struct{})}
+	d.logs = &logTail{}
+	if _, ok := d.prevLog.(*console); !ok && d.prevLog != os.Stderr && d.prevLog != os.Stdout {
+		d.logs.next = d.prevLog
+	}
+	log.SetOutput(d.logs)
+	//switch to the alternate screen and hide the cursor
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+	if isTerminal(os.Stdin) {
+		keysOnce.Do(func() {
+			go readKeys(os.Stdin)
+		})
+	}
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+//keysOnce starts reading the keys once, for all the runs of a daemon
+var keysOnce sync.Once
+
+//readKeys pauses or resumes the downloads when p is typed, followed by Enter: the terminal
+//sends the input line by line
+func readKeys(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if strings.ToLower(strings.TrimSpace(scanner.Text())) == "p" && !Pause() {
+			Resume()
+		}
+	}
+}
+
+func (d *dashboard) run() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	d.draw()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.sample()
+			d.draw()
+		}
+	}
+}
+
+//sample adds the bytes downloaded since the last sample to the history
+func (d *dashboard) sample() {
+	total := stats.totalsize.Load()
+	d.history = append(d.history, total-d.last)
+	d.last = total
+	if len(d.history) > graphSeconds {
+		d.history = d.history[len(d.history)-graphSeconds:]
+	}
+}
+
+//graph returns the throughput history as a bar graph and its peak
+func (d *dashboard) graph() (string, uint64) {
+	peak := uint64(0)
+	for _, n := range d.history {
+		if n > peak {
+			peak = n
+		}
+	}
+	var b strings.Builder
+	for _, n := range d.history {
+		if peak == 0 || n == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		b.WriteRune(graphLevels[int(n*uint64(len(graphLevels)-1)/peak)])
+	}
+	return b.String(), peak
+}
+
+//cut shortens s to the dashboard width
+func cut(s string) string {
+	r := []rune(s)
+	if len(r) > dashboardWidth {
+		return string(r[:dashboardWidth-1]) + "…"
+	}
+	return s
+}
+
+func (d *dashboard) draw() {
+	var b strings.Builder
+	line := func(format string, a ...interface{}) {
+		b.WriteString(cut(fmt.Sprintf(format, a...)))
+		b.WriteString("\x1b[K\n")
+	}
+	b.WriteString("\x1b[H")
+	line("gitmoo-goog - backing up to %v", Options.BackupFolder)
+	line("%v", progressLine())
+	active := d.p.activeItems()
+	busy := 0
+	for _, m := range active {
+		if m != nil {
+			busy++
+		}
+	}
+	line("Queue: %v waiting, Workers: %v of %v busy", len(d.p.jobs), busy, len(active))
+	if Paused() {
+		line("Paused, type p and Enter to resume")
+	} else {
+		line("Type p and Enter to pause")
+	}
+	line("")
+	graph, peak := d.graph()
+	line("Throughput, last %v seconds (peak %v/s)", graphSeconds, humanize.Bytes(peak))
+	line("  %v", graph)
+	line("")
+	line("Workers")
+	for i, m := range active {
+		if m == nil {
+			line("  %2d idle", i+1)
+			continue
+		}
+		line("  %2d %v (%v)", i+1, m.Filename, m.ID)
+	}
+	line("")
+	failures := d.p.lastFailures(dashboardErrors)
+	line("Last failures")
+	for _, f := range failures {
+		line("  %v", f)
+	}
+	line("")
+	line("Log")
+	for _, l := range d.logs.last(dashboardLogLines) {
+		line("  %v", l)
+	}
+	//clear what is left of the previous frame
+	b.WriteString("\x1b[J")
+	fmt.Fprint(d.out, b.String())
+}
+
+//stop closes the dashboard and shows the last log lines it hid
+func (d *dashboard) stop() {
+	if d == nil {
+		return
+	}
+	close(d.done)
+	d.wg.Wait()
+	fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+	log.SetOutput(d.prevLog)
+	if d.logs.next == nil {
+		for _, l := range d.logs.last(keptLogLines) {
+			fmt.Fprintln(d.prevLog, l)
+		}
+	}
+}
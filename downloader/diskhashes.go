@@ -0,0 +1,226 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//hashShardsName is the sub folder of the state folder of the hash index kept on disk with
+//Options.LowMemory, rather than in hashIndexName
+const hashShardsName = "hashes"
+
+//hashShards is the number of files of the hash index on disk, a lookup reads one of them
+const hashShards = 256
+
+//shardEntry is a line of a file of the hash index on disk, the last line of an item wins
+type shardEntry struct {
+	ID string `json:"id"`
+	HashEntry
+}
+
+//diskHashes guards the files of the hash index on disk
+var diskHashes = struct {
+	sync.Mutex
+	//converted is set once hashIndexName was moved to the files, on first use in the run
+	converted bool
+	//appended are the files appended to since the last compaction
+	appended map[string]bool
+}{}
+
+//shardFile returns the file of the hash index on disk holding the item id
+func shardFile(id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return StateFileName(filepath.Join(hashShardsName, fmt.Sprintf("%02x.jsonl", h.Sum32()%hashShards)))
+}
+
+//readShard calls found with the lines of fileName, in order
+func readShard(fileName string, found func(e shardEntry)) error {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e shardEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil && e.ID != "" {
+			found(e)
+		}
+	}
+	return scanner.Err()
+}
+
+//appendShard adds the entry of id to its file, diskHashes must be locked
+func appendShard(id string, entry HashEntry) error {
+	fileName := shardFile(id)
+	err := MkdirAll(filepath.Dir(fileName))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(shardEntry{ID: id, HashEntry: entry})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if diskHashes.appended == nil {
+		diskHashes.appended = make(map[string]bool)
+	}
+	diskHashes.appended[fileName] = true
+	return err
+}
+
+//convertHashIndex moves the entries of hashIndexName to the files of the index on disk, reading
+//it entry by entry so it is never loaded whole. diskHashes must be locked
+func convertHashIndex() {
+	if diskHashes.converted {
+		return
+	}
+	diskHashes.converted = true
+	fileName := StateFileName(hashIndexName)
+	f, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	_, err = dec.Token()
+	n := 0
+	for err == nil && dec.More() {
+		var key json.Token
+		key, err = dec.Token()
+		if err != nil {
+			break
+		}
+		var entry HashEntry
+		err = dec.Decode(&entry)
+		if err == nil {
+			err = appendShard(fmt.Sprint(key), entry)
+			n++
+		}
+	}
+	if err != nil {
+		log.Printf("Unable to move %v to the index on disk: %v", hashIndexName, err)
+		return
+	}
+	f.Close()
+	err = os.Remove(fileName)
+	if err != nil {
+		log.Printf("Unable to remove %v: %v", fileName, err)
+	}
+	log.Printf("Moved %v entries of %v to the index on disk", n, hashIndexName)
+}
+
+//diskHash returns the entry of the item id in the index on disk
+func diskHash(id string) (HashEntry, bool) {
+	diskHashes.Lock()
+	defer diskHashes.Unlock()
+	convertHashIndex()
+	var entry HashEntry
+	found := false
+	err := readShard(shardFile(id), func(e shardEntry) {
+		if e.ID == id {
+			entry, found = e.HashEntry, true
+		}
+	})
+	if err != nil {
+		log.Printf("Unable to read the hash index: %v", err)
+	}
+	return entry, found
+}
+
+//setDiskHash records the entry of the item id in the index on disk
+func setDiskHash(id string, entry HashEntry) {
+	diskHashes.Lock()
+	defer diskHashes.Unlock()
+	convertHashIndex()
+	err := appendShard(id, entry)
+	if err != nil {
+		log.Printf("Unable to update the hash index: %v", err)
+	}
+}
+
+//compactShards rewrites the files of the index on disk appended to during the run, with the
+//last entry of every item
+func compactShards() error {
+	diskHashes.Lock()
+	defer diskHashes.Unlock()
+	for fileName := range diskHashes.appended {
+		entries := make(map[string]shardEntry)
+		lines := 0
+		err := readShard(fileName, func(e shardEntry) {
+			entries[e.ID] = e
+			lines++
+		})
+		if err != nil {
+			return err
+		}
+		if lines == len(entries) {
+			continue
+		}
+		var b strings.Builder
+		for _, e := range entries {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			b.Write(data)
+			b.WriteString("\n")
+		}
+		err = writeFile(fileName, []byte(b.String()))
+		if err != nil {
+			return err
+		}
+	}
+	diskHashes.appended = nil
+	return nil
+}
+
+//resetDiskHashes forgets the state of the index on disk of a previous run
+func resetDiskHashes() {
+	diskHashes.Lock()
+	diskHashes.converted = false
+	diskHashes.appended = nil
+	diskHashes.Unlock()
+}
+
+//readShards adds the entries of the index on disk to index, a later entry replacing an earlier
+//one. it returns false if there is no index on disk
+func readShards(index map[string]HashEntry) (bool, error) {
+	folder := StateFileName(hashShardsName)
+	files, err := ioutil.ReadDir(folder)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, f := range files {
+		err = readShard(filepath.Join(folder, f.Name()), func(e shardEntry) {
+			index[e.ID] = e.HashEntry
+		})
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
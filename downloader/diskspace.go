@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+//errFreeSpaceUnknown is returned by freeSpace on platforms where it is not supported
+var errFreeSpaceUnknown = errors.New("free space unknown")
+
+//diskFullError stops the run when the backup filesystem is running out of space
+type diskFullError struct {
+	folder string
+	free   uint64
+	need   uint64
+}
+
+func (e diskFullError) Error() string {
+	return fmt.Sprintf("Not enough free space in %v: %v free, %v needed (including the %v reserve), stopping",
+		e.folder, humanize.Bytes(e.free), humanize.Bytes(e.need), humanize.Bytes(Options.DiskReserve))
+}
+
+//existingParent returns folder or its closest parent that exists
+func existingParent(folder string) string {
+	folder, err := filepath.Abs(folder)
+	if err != nil {
+		return folder
+	}
+	for {
+		_, err := os.Stat(folder)
+		parent := filepath.Dir(folder)
+		if err == nil || parent == folder {
+			return folder
+		}
+		folder = parent
+	}
+}
+
+//checkDiskSpace fails if writing size bytes to folder would leave less than Options.DiskReserve free
+func checkDiskSpace(folder string, size int64) error {
+	if Options.DiskReserve == 0 {
+		return nil
+	}
+	free, err := freeSpace(existingParent(folder))
+	if err == errFreeSpaceUnknown {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to check free space in %v: %v", folder, err)
+	}
+	need := Options.DiskReserve
+	if size > 0 {
+		need += uint64(size)
+	}
+	if free < need {
+		return diskFullError{folder: folder, free: free, need: need}
+	}
+	return nil
+}
+
+//IsDiskFull reports whether err stopped the run because the backup filesystem is full
+func IsDiskFull(err error) bool {
+	var full diskFullError
+	return errors.As(err, &full)
+}
+
+//FreeSpace returns the free space of the filesystem of folder, or false where it is not known
+func FreeSpace(folder string) (uint64, bool, error) {
+	free, err := freeSpace(existingParent(folder))
+	if err == errFreeSpaceUnknown {
+		return 0, false, nil
+	}
+	return free, err == nil, err
+}
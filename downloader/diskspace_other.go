@@ -0,0 +1,9 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package downloader
+
+//freeSpace is not supported on this platform
+func freeSpace(path string) (uint64, error) {
+	return 0, errFreeSpaceUnknown
+}
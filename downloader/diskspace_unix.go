@@ -0,0 +1,16 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package downloader
+
+import "syscall"
+
+//freeSpace returns the bytes available to the user on the filesystem of path
+func freeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(path, &st)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
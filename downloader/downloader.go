@@ -2,20 +2,24 @@ package downloader
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	humanize "github.com/dustin/go-humanize"
-	photoslibrary "google.golang.org/api/photoslibrary/v1"
+	"github.com/stevedenman/gitmoo-goog/photos"
 )
 
 //Options defines downloader options
@@ -28,187 +32,863 @@ var Options struct {
 	PageSize int
 	//Throttle is time to wait between API calls
 	Throttle int
-	//Google photos AlbumID
-	AlbumID string
+	//AlbumIDs are Google photos album IDs to download, empty for the whole library
+	AlbumIDs []string
+	//AlbumMax is the max number of items to process per album, 0 for no limit
+	AlbumMax int
+	//AlbumWorkers is the number of albums searched at the same time
+	AlbumWorkers int
+	//IncludePartner also downloads the media of the albums shared with the account
+	IncludePartner bool
+	//PartnerFolder is a sub folder of BackupFolder for shared media, empty keeps it in the main tree
+	PartnerFolder string
+	//Quality is the image quality to download: original, high or wNNNN (max width/height)
+	Quality string
+	//Raw selects camera RAW files: include, skip or only
+	Raw string
+	//RawFolder is a sub folder for RAW files, empty keeps them with other files
+	RawFolder string
+	//ConvertHEIC converts HEIC/HEIF photos to JPEG after download
+	ConvertHEIC bool
+	//KeepHEIC keeps the original HEIC file after conversion
+	KeepHEIC bool
+	//Motion also saves the video part of motion photos and live photos
+	Motion bool
+	//MediaType selects the media to download: all, photo or video
+	MediaType string
+	//Enumerate is the API call listing the whole library: search or list
+	Enumerate string
+	//Shards searches the library by year or month, ShardWorkers shards at a time. empty for one search
+	Shards string
+	//Shard is the slice of the library of this machine, such as 2/4. empty for the whole library
+	Shard string
+	//ShardBy splits the library for Shard by item ID or by month of creation
+	ShardBy string
+	//ShardWorkers is the number of shards searched at the same time
+	ShardWorkers int
+	//MaxFileSize skips files larger than this many bytes, 0 for no limit
+	MaxFileSize uint64
+	//MinWidth skips photos narrower than this many pixels
+	MinWidth int
+	//MinHeight skips photos lower than this many pixels
+	MinHeight int
+	//MinDuration skips videos shorter than this
+	MinDuration time.Duration
+	//MaxDuration skips videos longer than this
+	MaxDuration time.Duration
+	//Cameras selects media created by these cameras ("make model" glob patterns)
+	Cameras []string
+	//ExcludeCameras skips media created by these cameras ("make model" glob patterns)
+	ExcludeCameras []string
+	//IncludeMime selects media with these mime types (glob patterns, e.g. image/*)
+	IncludeMime []string
+	//ExcludeMime skips media with these mime types (glob patterns, e.g. image/gif)
+	ExcludeMime []string
+	//Order processes the library newest or oldest first, empty for the API order
+	Order string
+	//Sample downloads this many items picked at random across the library, 0 to download everything
+	Sample int
+	//CountFirst counts the library items before downloading, to estimate the completion time
+	CountFirst bool
+	//LibraryTotal is the number of items Google Photos shows for the library, compared with the
+	//items returned by the search to report what might be missing. 0 to not compare
+	LibraryTotal int
+	//AlbumManifests writes a manifest for every album, used to recreate albums on restore
+	AlbumManifests bool
+	//AlbumOrder links the files of every album in [folder]-albums, prefixed with their position
+	AlbumOrder bool
+	//StallTimeout aborts a transfer that received no data for this long, 0 to wait forever
+	StallTimeout time.Duration
+	//StallRetries is how many times a stalled, truncated or invalid download is retried
+	StallRetries int
+	//ItemTimeout aborts a transfer that takes longer than this, 0 for no limit
+	ItemTimeout time.Duration
+	//DiskReserve is the free space to keep on the backup filesystem, the run stops before going below it
+	DiskReserve uint64
+	//MaxWriteRate limits disk writes to this many bytes per second, 0 for no limit
+	MaxWriteRate uint64
+	//MaxRate limits the media downloads to this many bytes per second outside the windows of Schedule, 0 for no limit
+	MaxRate uint64
+	//Schedule are windows of the day with their own download rate and workers, such as 01:00-07:00=0/8,09:00-18:00=500KB/1
+	Schedule string
+	//Workers is the number of concurrent downloads
+	Workers int
+	//AutoWorkers tunes the number of concurrent downloads, up to Workers, from the throughput and the failures
+	AutoWorkers bool
+	//LowMemory limits the memory used, for small devices: one download at a time, smaller buffers and the hash index on disk
+	LowMemory bool
+	//OnEvent receives the progress events of DownloadAll. it is called from the download workers,
+	//so it must be safe for concurrent use, and it should return quickly as it delays the downloads
+	OnEvent func(Event)
+	//Transport is used for the media downloads (not the API calls), nil for http.DefaultTransport.
+	//it allows logging, caching or intercepting the media traffic
+	Transport http.RoundTripper
+	//Validate checks downloaded photos can be decoded: header or full, empty to not check
+	Validate string
+	//Probe checks downloaded videos with ffprobe, when it is installed
+	Probe bool
+	//Quarantine moves files that failed validation or were truncated to the quarantine folder, instead of deleting them
+	Quarantine bool
+	//Layout names the files: date, hash or a template such as {year}/{mm}/{dd}_{id8}
+	Layout string
+	//Filesystem is the target filesystem of the names taken from the library: windows or posix
+	Filesystem string
+	//Normalize is the unicode normalization form of the file names: nfc or nfd
+	Normalize string
+	//DirMode is the mode of the created folders, 0 for 0700 with the umask
+	DirMode os.FileMode
+	//FileMode is the mode of the created files, 0 for 0644 with the umask
+	FileMode os.FileMode
+	//Owner is the uid:gid the created files and folders are given, if set
+	Owner string
+	//Xattr stores the item ID, creation time and albums in extended attributes of the files
+	Xattr bool
+	//Fsync flushes files and folders to the disk once written
+	Fsync bool
+	//Timezone of the dates in file names: utc, local, a zone name or an offset such as +05:30
+	Timezone string
+	//ExifTime names photos after their EXIF capture time when their creation time is missing or wrong
+	ExifTime bool
+	//WriteDescription writes the descriptions of the items in the EXIF ImageDescription of their JPEG files
+	WriteDescription bool
+	//StripGPS erases the location from the EXIF and XMP metadata of downloaded JPEG photos
+	StripGPS bool
+	//Report is the file the result of the run is written to as JSON, empty for none
+	Report string
+	//HTMLReport writes a status page of the run and of the past runs to HTMLReportName in the backup folder
+	HTMLReport bool
+	//Dashboard shows a full screen view of the run in the terminal instead of the log
+	Dashboard bool
+	//MaxErrors stops the run after this many failed items, or this percentage of the processed items such as 5%
+	MaxErrors string
+	//DailyQuota is the number of API calls allowed per day (midnight to midnight Pacific time), 0 for no limit
+	DailyQuota int
+	//QuotaWait waits for the next day when DailyQuota is reached, instead of stopping the run
+	QuotaWait bool
+	//Breaker pauses the run after this many failed downloads or API calls in a row, 0 to never pause
+	Breaker int
+	//CheckRemote requests the media of the items found in the hash index, to detect changed files
+	CheckRemote bool
+	//VerifyHash checks existing files against the hash index, to download again the ones changed on disk
+	VerifyHash bool
+	//Thumbnails is the folder of a mirror of the backup folder with thumbnails of the items, empty for none
+	Thumbnails string
+	//ThumbnailSize is the max width and height of the thumbnails
+	ThumbnailSize int
+	//ThumbnailsOnly downloads the thumbnails and the metadata of the items, not their media
+	ThumbnailsOnly bool
+	//Parity creates par2 parity files of this percentage of the size of every folder, 0 for none
+	Parity int
+	//CAS is the folder of an object store keeping the media files once by content, empty to keep
+	//them in the backup folder
+	CAS string
+	//Mirrors are folders receiving a copy of the files of the backup folder, from a single download
+	Mirrors []string
+	//Feed is the file the items downloaded by the last runs are written to as an Atom feed, empty for none
+	Feed string
+	//Relocate is what to do with the file of an item saved at another path by an earlier run, such as
+	//with another layout: RelocateMove (the default), RelocateLink or RelocateOff to download it again
+	Relocate string
 }
 
-var stats struct {
-	total      int
-	errors     int
-	totalsize  uint64
-	downloaded int
-}
+//dateTemplate is the template of LayoutDate
+const dateTemplate = "{year}/{month}/{day}_{id8}"
 
-func getFileNameByTime(item *photoslibrary.MediaItem) (string, error) {
-	t, err := time.Parse(time.RFC3339, item.MediaMetadata.CreationTime)
-	if err != nil {
-		log.Println(err)
-		return "", err
-	}
-	year := strconv.Itoa(t.Year())
-	month := t.Month().String()
-	name := fmt.Sprintf("%v_%v", t.Day(), item.Id[len(item.Id)-8:])
-	return filepath.Join(Options.BackupFolder, year, month, name), nil
-}
-func getFileNameByHash(item *photoslibrary.MediaItem) string {
+func getFileNameByHash(folder string, item *photos.MediaItem) string {
 	hasher := md5.New()
-	hasher.Write([]byte(item.Id))
+	hasher.Write([]byte(item.ID))
 	hash := hex.EncodeToString(hasher.Sum(nil))
-	return filepath.Join(Options.BackupFolder, hash[:4], hash[4:8], hash[8:])
+	return filepath.Join(folder, hash[:4], hash[4:8], hash[8:])
 }
 
-func getFileName(item *photoslibrary.MediaItem) string {
-	fileName, err := getFileNameByTime(item)
+func getFileName(folder string, item *photos.MediaItem) string {
+	var fileName string
+	var err error
+	switch Options.Layout {
+	case LayoutHash:
+		return getFileNameByHash(folder, item)
+	case "", LayoutDate:
+		fileName, err = uniqueFileName(folder, item, dateTemplate)
+	default:
+		fileName, err = uniqueFileName(folder, item, Options.Layout)
+	}
 	if err != nil {
-		fileName = getFileNameByHash(item)
+		fileName = getFileNameByHash(folder, item)
 	}
 	return fileName
 }
 
-func createJSON(item *photoslibrary.MediaItem, fileName string) error {
+func createJSON(item *photos.MediaItem, fileName string) error {
 
-	bytes, err := item.MarshalJSON()
+	bytes, err := json.Marshal(item)
 	if err != nil {
 		return err
 	}
 
+	fp := fingerprint(item)
 	fileInfo, err := os.Stat(fileName)
 	if fileInfo != nil {
-		if int64(len(bytes)) == fileInfo.Size() {
+		if sidecarFingerprint(item.ID, fileName) == fp {
 			return nil
 		}
+		log.Printf("Metadata of %v changed, updating '%v'", item.ID, fileName)
 	} else if !os.IsNotExist(err) {
 		log.Println("Error when checking if json file exists. Permissions?")
 		return nil
+	} else {
+		log.Printf("Creating '%v' ", fileName)
 	}
 
-	log.Printf("Creating '%v' ", fileName)
-
-	err = os.MkdirAll(filepath.Dir(fileName), 0700)
+	err = MkdirAll(filepath.Dir(fileName))
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(fileName, bytes, 0644)
+	markParity(fileName)
+	err = writeFile(fileName, bytes)
+	if err != nil {
+		return err
+	}
+	setFingerprint(item.ID, fp)
+	return nil
 
 }
 
-func createImage(item *photoslibrary.MediaItem, fileName string) error {
+//highQualitySize is the max width/height of the 'high' quality
+const highQualitySize = 4096
+
+//imageSuffix returns the base URL parameters for photos in the requested quality
+func imageSuffix() (string, error) {
+	switch {
+	case Options.Quality == "" || Options.Quality == "original":
+		return "=d", nil
+	case Options.Quality == "high":
+		return fmt.Sprintf("=w%v-h%v", highQualitySize, highQualitySize), nil
+	case strings.HasPrefix(Options.Quality, "w"):
+		size, err := strconv.Atoi(Options.Quality[1:])
+		if err != nil || size <= 0 {
+			return "", fmt.Errorf("Invalid quality '%v'", Options.Quality)
+		}
+		return fmt.Sprintf("=w%v-h%v", size, size), nil
+	}
+	return "", fmt.Errorf("Invalid quality '%v', use original, high or wNNNN", Options.Quality)
+}
+
+//createImage downloads the media of item to fileName, it returns false if the file was already downloaded
+func createImage(item *photos.MediaItem, fileName string) (bool, error) {
+	if Options.CAS != "" && stored(fileName) {
+		log.Println("File already downloaded")
+		return false, nil
+	}
+	//damaged is set when the content of the file does not match its hash
+	damaged := false
+	if !Options.CheckRemote && indexed(item.ID, fileName) {
+		if !Options.VerifyHash {
+			log.Println("File already downloaded")
+			return false, nil
+		}
+		if ok, _ := verifyHash(item.ID, fileName); ok {
+			log.Println("File already downloaded (hash verified)")
+			return false, nil
+		}
+		damaged = true
+	}
 
 	url := ""
 	if item.MediaMetadata.Video != nil {
 		// https://issuetracker.google.com/issues/80149160#comment1
-		url = fmt.Sprintf("%v=dv", item.BaseUrl)
+		// videos are always downloaded in original quality
+		url = fmt.Sprintf("%v=dv", item.BaseURL)
 	} else {
-		url = fmt.Sprintf("%v=d", item.BaseUrl)
+		suffix, err := imageSuffix()
+		if err != nil {
+			return false, err
+		}
+		url = item.BaseURL + suffix
 	}
 
-	response, err := http.Get(url)
+	response, err := startTransfer(url)
 	if err != nil {
-		return err
+		return false, err
+	}
+	defer response.Close()
+	err = checkFileSize(response.Length)
+	if err != nil {
+		return false, err
 	}
 
 	fileInfo, err := os.Stat(fileName)
-	if fileInfo != nil {
-		// file exists - check size
-		size := response.ContentLength
-		if size == fileInfo.Size() {
+	verified := false
+	if fileInfo != nil && Options.VerifyHash && !damaged {
+		ok, known := verifyHash(item.ID, fileName)
+		damaged = known && !ok
+		verified = known && ok
+	}
+	if fileInfo != nil && damaged {
+		log.Printf("The content of '%v' does not match its hash - will download", fileName)
+	} else if fileInfo != nil {
+		// file exists - check size, a file matching its hash is kept when the size is unknown
+		size := response.Length
+		downloaded, _ := editedSize(item.ID)
+		if size == fileInfo.Size() || size == downloaded || verified && size < 0 {
 			log.Println("File already downloaded")
-			return nil
+			recordFile(item.ID, fileName)
+			return false, nil
 		}
 
 		log.Printf("File size has changed - will download")
 	} else if err != nil && !os.IsNotExist(err) {
 		log.Println("Error when checking if output file exists. Permissions?")
-		return err
+		return false, err
 	} else {
 		log.Println("File not yet downloaded - will download")
 	}
 
-	//	Create() truncates existing files
-	output, err := os.Create(fileName)
+	err = checkDiskSpace(filepath.Dir(fileName), response.Length)
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer output.Close()
 
-	defer response.Body.Close()
-
-	n, err := io.Copy(output, response.Body)
+	//	Create() truncates existing files
+	output, err := createPart(fileName)
 	if err != nil {
-		return err
+		return false, err
+	}
+	hasher := sha256.New()
+	n, err := io.CopyBuffer(limitWrites(io.MultiWriter(output, hasher)), response.Body, copyBuffer())
+	err = response.err(err)
+	if err == io.ErrUnexpectedEOF || err == nil && response.Length >= 0 && n != response.Length {
+		err = fmt.Errorf("%w: received %v of %v bytes", errTruncated, n, response.Length)
+	}
+	if err != nil {
+		abortFile(output, fileName)
+		return false, err
+	}
+	err = commitFile(output, fileName)
+	if err != nil {
+		return false, err
+	}
+	if Options.Validate != "" && item.MediaMetadata.Video == nil {
+		err = validateImage(fileName, item.MimeType)
+	} else if ffprobePath != "" && item.MediaMetadata.Video != nil {
+		err = probeVideo(item, fileName)
+	}
+	if err != nil {
+		return false, err
 	}
 
+	if filepath.Ext(fileName) == "" {
+		//the item has no known mime type nor a file name extension, retype renames it
+		setExtension(item.ID, contentTypeExtension(response.Header.Get("Content-Type")))
+	}
 	log.Printf("Downloaded '%v' (%v)", fileName, humanize.Bytes(uint64(n)))
-	stats.downloaded++
-	stats.totalsize += uint64(n)
+	recordHash(item.ID, fileName, n, hasher.Sum(nil))
+	stats.downloaded.Add(1)
+	stats.totalsize.Add(uint64(n))
+	tallyBytes(item.ID, n)
 
-	return nil
+	return true, nil
 }
 
-func downloadItem(svc *photoslibrary.Service, item *photoslibrary.MediaItem) error {
-	name := getFileName(item)
-	imageName := name
+// getItemFileNames returns the media and metadata file names of item
+func getItemFileNames(folder string, item *photos.MediaItem) (string, string) {
+	name := getFileName(itemFolder(folder, item), item)
+	imageName := withLegacyExtension(item, name, itemExtension(item))
 	jsonName := name + ".json"
-	ext, _ := mime.ExtensionsByType(item.MimeType)
-	if len(ext) > 0 {
-		imageName += ext[0]
+	return imageName, jsonName
+}
+
+func downloadItem(svc photos.Library, item *photos.MediaItem, folder string) error {
+	imageName, jsonName := getItemFileNames(folder, item)
+	err := saveItem(item, folder, imageName, jsonName)
+	if err != nil {
+		return &DownloadError{ItemID: item.ID, Path: imageName, ProductURL: item.ProductURL, Err: err}
 	}
-	err := createJSON(item, jsonName)
+	return nil
+}
+
+//retryable checks if the download of an item failed in a way worth retrying
+func retryable(err error) bool {
+	return errors.Is(err, errStalled) || errors.Is(err, errTruncated) || errors.Is(err, errInvalid)
+}
+
+//saveItem saves the metadata and the media of item
+func saveItem(item *photos.MediaItem, folder string, imageName string, jsonName string) error {
+	err := checkDuration(item, imageName)
 	if err != nil {
 		return err
 	}
-
-	return createImage(item, imageName)
+	err = createJSON(item, jsonName)
+	if err != nil {
+		return err
+	}
+	if Options.ThumbnailsOnly {
+		downloaded, err := createThumbnail(item, imageName)
+		if downloaded {
+			stats.downloaded.Add(1)
+		}
+		syncMirrors(item, imageName, jsonName)
+		return err
+	}
+	if Options.ConvertHEIC && !Options.KeepHEIC && isHEIC(item) {
+		_, err = os.Stat(jpegName(imageName))
+		if err == nil {
+			mirrorThumbnail(item, imageName)
+			syncMirrors(item, imageName, jsonName)
+			return nil
+		}
+	}
+	relocate(item, folder, imageName)
+	downloaded, err := createImage(item, imageName)
+	for retry := 1; retryable(err) && retry <= Options.StallRetries; retry++ {
+		if errors.Is(err, errInvalid) {
+			//the file has its full size, the retry would take it as downloaded. the last one is discarded
+			os.Remove(imageName)
+		}
+		log.Printf("Download of %v failed (%v), retrying (%v/%v)", item.ID, err, retry, Options.StallRetries)
+		downloaded, err = createImage(item, imageName)
+	}
+	//with Options.Fsync a failed transfer leaves no partial file, imageName is an earlier version
+	if errors.Is(err, errInvalid) || errors.Is(err, errTruncated) && !Options.Fsync {
+		discard(item, imageName, err)
+	}
+	if errors.Is(err, errTimedOut) && !Options.Fsync {
+		//the partial file is downloaded again by the next run
+		os.Remove(imageName)
+	}
+	if err != nil {
+		return err
+	}
+	if downloaded {
+		imageName = retype(item, imageName)
+		imageName, jsonName = rehome(item, folder, imageName, jsonName)
+		addFeedEntry(item, imageName)
+		err = editPhoto(item, imageName)
+		if err != nil {
+			log.Printf("Unable to edit the metadata of '%v': %v", imageName, err)
+		}
+	}
+	if downloaded && Options.Motion && item.MediaMetadata.Video == nil {
+		err = createMotion(item, imageName)
+		if err != nil {
+			log.Printf("Failed to save motion video of %v: %v", item.ID, err)
+		}
+	}
+	if Options.ConvertHEIC && isHEIC(item) {
+		err = convertHEIC(imageName)
+		if err == nil && Options.StripGPS {
+			err = stripFile(jpegName(imageName))
+		}
+	}
+	if Options.Xattr {
+		tagItem(item, imageName, jsonName, motionName(imageName), jpegName(imageName))
+	}
+	if downloaded {
+		markParity(imageName)
+	}
+	if downloaded && Options.CAS != "" {
+		storeErr := storeObject(item.ID, imageName)
+		if storeErr != nil {
+			return storeErr
+		}
+	}
+	mirrorThumbnail(item, imageName)
+	syncMirrors(item, imageName, jsonName)
+	return err
 }
 
 //ListAlbums list albums
-func ListAlbums(svc *photoslibrary.Service) error {
-	// req := &photoslibrary.AlbumsListCall{}
-	resp, err := svc.Albums.List().Do()
+func ListAlbums(svc photos.Library) error {
+	resp, err := svc.ListAlbums("")
 	if err != nil {
 		return err
 	}
 	for _, a := range resp.Albums {
-		log.Printf("album %v: %v", a.Id, a.Title)
+		log.Printf("album %v: %v", a.ID, a.Title)
 	}
 	return nil
 }
 
-//DownloadAll downloads all files
-func DownloadAll(svc *photoslibrary.Service) error {
-	hasMore := true
-	stats.downloaded = 0
-	stats.errors = 0
-	stats.total = 0
-	stats.totalsize = 0
-	req := &photoslibrary.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), AlbumId: Options.AlbumID}
-	for hasMore {
-		sleepTime := time.Duration(time.Second * time.Duration(Options.Throttle))
-		log.Printf("Processed: %v, Downloaded: %v, Errors: %v, Total Size: %v, Waiting %v", stats.total, stats.downloaded, stats.errors, humanize.Bytes(stats.totalsize), sleepTime)
-		time.Sleep(sleepTime)
-		items, err := svc.MediaItems.Search(req).Do()
+//listSharedAlbums returns all albums shared with the account
+func listSharedAlbums(svc photos.Library) ([]*photos.Album, error) {
+	albums := make([]*photos.Album, 0)
+	pageToken := ""
+	for {
+		resp, err := svc.ListSharedAlbums(pageToken)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		albums = append(albums, resp.SharedAlbums...)
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			return albums, nil
+		}
+	}
+}
+
+//processItem filters an item and queues it for download, returns false when MaxItems was reached
+//or the run was stopped
+func processItem(svc photos.Library, m *photos.MediaItem, folder string) bool {
+	reason := skipReason(m)
+	if reason != "" {
+		log.Printf("Skipping %v: %v", m.ID, reason)
+		stats.skipped.Add(1)
+		tallySkipped(m.ID)
+		emit(Event{Type: ItemSkipped, Item: m, Err: skipError(reason)})
+		return true
+	}
+	if stats.total.Add(1) > int64(Options.MaxItems) {
+		stats.total.Add(-1)
+		return false
+	}
+	return work.add(m, folder)
+}
+
+//pass is one search over the library or an album
+type pass struct {
+	//folder to download into
+	folder string
+	//manifest records the items when not nil
+	manifest *AlbumManifest
+	//limit stops the pass after this many items, 0 for no limit
+	limit int
+	count int
+	//album totals the items of the pass when not nil
+	album *AlbumStats
+	//complete is set when the search returned all its pages
+	complete bool
+	//sliced is set when the search is in the slice of the library of this machine (Options.Shard)
+	sliced bool
+}
+
+//downloadSearch downloads all items returned by req, skipping items already in seen.
+//returns false when MaxItems was reached
+func downloadSearch(svc photos.Library, req *photos.SearchMediaItemsRequest, p *pass, seen map[string]bool) (bool, error) {
+	folder := p.folder
+	manifest := p.manifest
+	next := fetchPage(svc, req)
+	for {
+		page := <-next
+		if page.err != nil {
+			return false, page.err
+		}
+		items := page.items
+		emit(Event{Type: PageFetched, Items: len(items.MediaItems)})
+		req.PageToken = items.NextPageToken
+		if req.PageToken != "" {
+			next = fetchPage(svc, req)
 		}
 		for _, m := range items.MediaItems {
-			stats.total++
-			if stats.total > Options.MaxItems {
-				hasMore = false
-				break
+			if p.limit > 0 && p.count >= p.limit {
+				log.Printf("Reached the limit of %v items", p.limit)
+				return true, nil
 			}
-			err = downloadItem(svc, m)
-			if err != nil {
-				log.Printf("Failed to download %v: %v", m.Id, err)
-				stats.errors++
+			p.count++
+			if p.album != nil {
+				p.album.add(m.ID)
+			}
+			if manifest != nil {
+				manifest.add(folder, m)
+			}
+			if !p.sliced && !inSlice(m) {
+				continue
+			}
+			if !markSeen(seen, m.ID) {
+				continue
+			}
+			if !processItem(svc, m, folder) {
+				return false, nil
 			}
 		}
-		req.PageToken = items.NextPageToken
 		if req.PageToken == "" {
-			hasMore = false
+			p.complete = true
+			if p.album != nil {
+				p.album.done()
+			}
+			return true, nil
+		}
+	}
+}
+
+//seenMu guards the items seen by the run, albums may be searched at the same time
+var seenMu sync.Mutex
+
+//markSeen adds id to seen, returns false if it was already there
+func markSeen(seen map[string]bool, id string) bool {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	if seen[id] {
+		return false
+	}
+	seen[id] = true
+	return true
+}
+
+//page is a search result page fetched in the background
+type page struct {
+	items *photos.SearchMediaItemsResponse
+	err   error
+}
+
+//fetchPage waits for the throttle and requests the page of req in the background, so the
+//next page is fetched while the items of the current one are downloaded
+func fetchPage(svc photos.Library, req *photos.SearchMediaItemsRequest) <-chan page {
+	r := *req
+	c := make(chan page, 1)
+	go func() {
+		for {
+			sleepTime := time.Duration(time.Second * time.Duration(Options.Throttle))
+			log.Printf("%v, Waiting %v", progressLine(), sleepTime)
+			select {
+			case <-time.After(sleepTime):
+			case <-stopped():
+				c <- page{err: ErrStopped}
+				return
+			}
+			items, err := svc.SearchMediaItems(&r)
+			if err != nil && Options.Breaker > 0 && transient(err) {
+				log.Printf("Search failed, retrying: %v", err)
+				breaker.failure(err)
+				breaker.wait(stopped())
+				continue
+			}
+			if err == nil {
+				breaker.success()
+			}
+			c <- page{items: items, err: err}
+			return
+		}
+	}()
+	return c
+}
+
+//downloadPartner downloads media from albums shared with the account
+func downloadPartner(svc photos.Library, seen map[string]bool) error {
+	albums, err := listSharedAlbums(svc)
+	if err != nil {
+		return err
+	}
+	folder := filepath.Join(Options.BackupFolder, Options.PartnerFolder)
+	_, err = eachAlbum(albums, func(a *photos.Album) (bool, error) {
+		log.Printf("Downloading shared album '%v' (%v items)", a.Title, a.MediaItemsCount)
+		req := &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), AlbumID: a.ID}
+		return downloadSearch(svc, req, &pass{folder: folder, limit: Options.AlbumMax, album: newAlbumStats(a.ID, a.Title, a.MediaItemsCount)}, seen)
+	})
+	return err
+}
+
+//DownloadAll downloads all files and returns the outcome of the run. if the run completed but
+//some items failed, the error is ItemErrors. the result is nil if the run could not start
+func DownloadAll(svc photos.Library) (*Result, error) {
+	return downloadAll(svc, nil)
+}
+
+//inRun is set during a run, the state of a run is global to the package so runs can not overlap
+var inRun atomic.Bool
+
+//downloadAll downloads all files, calling hooks if not nil
+func downloadAll(svc photos.Library, hooks *Hooks) (*Result, error) {
+	if !inRun.CompareAndSwap(false, true) {
+		return nil, ErrRunInProgress
+	}
+	defer inRun.Store(false)
+	if stopRequested() {
+		return nil, ErrStopped
+	}
+	stats.reset()
+	resetClaims()
+	resetState()
+	resetTallies()
+	breaker.reset()
+	tuning.reset()
+	xattrFailed.Store(false)
+	applyLowMemory()
+	_, err := imageSuffix()
+	if err != nil {
+		return nil, err
+	}
+	err = checkFilters()
+	if err != nil {
+		return nil, err
+	}
+	err = checkOrder()
+	if err != nil {
+		return nil, err
+	}
+	err = checkEnumerate()
+	if err != nil {
+		return nil, err
+	}
+	err = checkShards()
+	if err != nil {
+		return nil, err
+	}
+	err = checkSlice()
+	if err != nil {
+		return nil, err
+	}
+	err = checkValidate()
+	if err != nil {
+		return nil, err
+	}
+	err = checkThumbnails()
+	if err != nil {
+		return nil, err
+	}
+	err = CheckLayout()
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parseMaxErrors()
+	if err != nil {
+		return nil, err
+	}
+	schedule, err = parseSchedule()
+	if err != nil {
+		return nil, err
+	}
+	findProbe()
+	findPar2()
+	_, _, err = parseOwner()
+	if err != nil {
+		return nil, err
+	}
+	Options.BackupFolder = longPathFolder(Options.BackupFolder)
+	err = checkDiskSpace(Options.BackupFolder, 0)
+	if err != nil {
+		return nil, err
+	}
+	err = checkMirrors()
+	if err != nil {
+		return nil, err
+	}
+	err = checkCAS()
+	if err != nil {
+		return nil, err
+	}
+	err = checkRelocate()
+	if err != nil {
+		return nil, err
+	}
+	if Options.DailyQuota > 0 {
+		svc = quotaLibrary{svc}
+	}
+	if Options.Enumerate == EnumerateList {
+		svc = listLibrary{svc}
+	}
+	work = startPipeline(svc, limit, hooks)
+	setRunning(work)
+	var board *dashboard
+	if Options.Dashboard {
+		board = startDashboard(work)
+	}
+	err = downloadPasses(svc)
+	stop := work.finish()
+	setRunning(nil)
+	board.stop()
+	if err == nil {
+		err = stop
+	}
+	manifestErr := writeManifests()
+	if err == nil {
+		err = manifestErr
+	}
+	if Options.Xattr {
+		tagAlbums()
+	}
+	if Options.AlbumOrder {
+		linkAlbums()
+	}
+	if par2Path != "" {
+		parityErr := updateParity()
+		if parityErr != nil {
+			log.Printf("Unable to save the folders missing parity files: %v", parityErr)
+		}
+	}
+	saveState()
+	emit(Event{Type: RunFinished, Err: err})
+	snapshot := stats.snapshot()
+	result := newResult(snapshot, work.failed)
+	recordRun(snapshot, result, err)
+	if Options.Report != "" {
+		reportErr := writeReport(Options.Report, result)
+		if reportErr != nil {
+			log.Printf("Unable to write the report '%v': %v", Options.Report, reportErr)
 		}
 	}
+	if Options.HTMLReport {
+		reportErr := writeHTMLReport(result, err)
+		if reportErr != nil {
+			log.Printf("Unable to write the HTML report: %v", reportErr)
+		}
+	}
+	if err != nil {
+		return result, err
+	}
+
+	log.Printf("Processed: %v, Downloaded: %v, Skipped: %v, Errors: %v, Total Size: %v, Time: %v",
+		result.Processed, result.Downloaded, result.Skipped, len(result.Failures), humanize.Bytes(result.Bytes), result.Duration.Round(time.Second))
+	logAlbums(result.Albums)
+	logCompleteness(result)
+	if len(result.Failures) > 0 {
+		return result, result.Failures
+	}
+	return result, nil
+}
 
-	log.Printf("Processed: %v, Downloaded: %v, Errors: %v, Total Size: %v",
-		stats.total, stats.downloaded, stats.errors, humanize.Bytes(stats.totalsize))
+//downloadPasses searches the library, albums and shared media for the items to download
+func downloadPasses(svc photos.Library) error {
+	seen := make(map[string]bool)
+	var more bool
+	var err error
+	if len(Options.AlbumIDs) > 0 {
+		more, err = downloadAlbumList(svc, Options.AlbumIDs, seen)
+	} else if Options.Sample > 0 {
+		stats.expected.Store(int64(Options.Sample))
+		more, err = downloadSample(svc)
+	} else if Options.Shards != "" {
+		if Options.CountFirst {
+			count, err := countItems(svc)
+			if err != nil {
+				return err
+			}
+			stats.expected.Store(int64(count))
+		}
+		more, err = downloadSharded(svc, seen)
+	} else if Options.Order != "" {
+		if Options.CountFirst {
+			count, err := countItems(svc)
+			if err != nil {
+				return err
+			}
+			stats.expected.Store(int64(count))
+		}
+		more, err = downloadOrdered(svc, seen)
+	} else {
+		if Options.CountFirst {
+			count, err := countItems(svc)
+			if err != nil {
+				return err
+			}
+			stats.expected.Store(int64(count))
+		}
+		req := &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), Filters: searchFilters()}
+		p := &pass{folder: Options.BackupFolder}
+		more, err = downloadSearch(svc, req, p, seen)
+		if err == nil && p.complete && req.Filters == nil {
+			tallyLibrary(p.count)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if more && Options.AlbumManifests && len(Options.AlbumIDs) == 0 {
+		more, err = downloadAlbums(svc, seen)
+		if err != nil {
+			return err
+		}
+	}
+	if more && Options.IncludePartner && len(Options.AlbumIDs) == 0 {
+		return downloadPartner(svc, seen)
+	}
 	return nil
 }
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+	"github.com/stevedenman/gitmoo-goog/photos/photostest"
+)
+
+//testLibrary is a library of n photos served by srv, one a day from 1 Jan 2019
+func testLibrary(srv *httptest.Server, n int) *photostest.Library {
+	lib := &photostest.Library{}
+	day := time.Date(2019, time.January, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		lib.Items = append(lib.Items, &photos.MediaItem{
+			ID:       fmt.Sprintf("TESTITEM%08d", i),
+			BaseURL:  fmt.Sprintf("%v/photo%d", srv.URL, i),
+			MimeType: "image/jpeg",
+			Filename: fmt.Sprintf("IMG_%04d.jpg", i),
+			MediaMetadata: &photos.MediaMetadata{
+				CreationTime: day.AddDate(0, 0, i).Format(time.RFC3339),
+				Width:        100,
+				Height:       100,
+				Photo:        &photos.Photo{},
+			},
+		})
+	}
+	return lib
+}
+
+//testServer serves every media download with the same content, counting the requests
+func testServer(requests *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(requests, 1)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("not really a jpeg, long enough to be a photo file"))
+	}))
+}
+
+//testOptions sets the Options of a run in folder, the returned function restores them
+func testOptions(folder string) func() {
+	saved := Options
+	Options.BackupFolder = folder
+	Options.MaxItems = 1000
+	Options.PageSize = 10
+	Options.Throttle = 0
+	Options.Quality = "original"
+	Options.Raw = "include"
+	Options.MediaType = "all"
+	Options.Workers = 4
+	Options.StallTimeout = time.Minute
+	return func() {
+		Options = saved
+	}
+}
+
+//mediaFiles returns the media files of the archive in folder, without the sidecars and the state
+func mediaFiles(t *testing.T, folder string) []string {
+	var files []string
+	err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == StateFolder {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && filepath.Ext(path) != ".json" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestDownloadAll(t *testing.T) {
+	folder, err := ioutil.TempDir("", "gitmoo-goog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+	defer testOptions(folder)()
+	var requests int64
+	srv := testServer(&requests)
+	defer srv.Close()
+	lib := testLibrary(srv, 5)
+
+	Options.Layout = LayoutHash
+	result, err := DownloadAll(lib)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	if result.Downloaded != 5 || atomic.LoadInt64(&requests) != 5 {
+		t.Fatalf("first run: downloaded %v files with %v requests, want 5", result.Downloaded, requests)
+	}
+	for _, item := range lib.Items {
+		if _, err := os.Stat(getFileNameByHash(folder, item) + ".jpg"); err != nil {
+			t.Errorf("first run: %v", err)
+		}
+	}
+
+	atomic.StoreInt64(&requests, 0)
+	result, err = DownloadAll(lib)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if result.Downloaded != 0 || result.Processed != 5 || atomic.LoadInt64(&requests) != 0 {
+		t.Fatalf("second run: downloaded %v of %v items with %v requests, want 0 of 5 with 0",
+			result.Downloaded, result.Processed, requests)
+	}
+
+	Options.Layout = LayoutDate
+	result, err = DownloadAll(lib)
+	if err != nil {
+		t.Fatalf("run with the date layout: %v", err)
+	}
+	if result.Downloaded != 0 || atomic.LoadInt64(&requests) != 0 {
+		t.Fatalf("run with the date layout: downloaded %v files with %v requests, want them relocated",
+			result.Downloaded, requests)
+	}
+	files := mediaFiles(t, folder)
+	if len(files) != 5 {
+		t.Fatalf("run with the date layout: %v files, want 5: %v", len(files), files)
+	}
+	for i, item := range lib.Items {
+		want := filepath.Join(folder, "2019", "January", fmt.Sprintf("%d_%v.jpg", i+1, item.ID[len(item.ID)-8:]))
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("run with the date layout: %v", err)
+		}
+		if _, err := os.Stat(getFileNameByHash(folder, item) + ".jpg"); !os.IsNotExist(err) {
+			t.Errorf("run with the date layout: %v left at its hash layout path", item.ID)
+		}
+	}
+}
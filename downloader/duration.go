@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//durationProbeSize is how many bytes are read from each end of a video to find its duration
+const durationProbeSize = 1024 * 1024
+
+var errNoDuration = errors.New("video duration not found")
+
+//mvhdDuration parses the duration in the 'mvhd' box of MP4/QuickTime data
+func mvhdDuration(data []byte) (time.Duration, error) {
+	i := bytes.Index(data, []byte("mvhd"))
+	if i < 0 {
+		return 0, errNoDuration
+	}
+	box := data[i+4:]
+	if len(box) < 32 {
+		return 0, errNoDuration
+	}
+	var timescale, duration uint64
+	if box[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(box[20:24]))
+		duration = binary.BigEndian.Uint64(box[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(box[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(box[16:20]))
+	}
+	if timescale == 0 {
+		return 0, errNoDuration
+	}
+	return time.Duration(duration) * time.Second / time.Duration(timescale), nil
+}
+
+//readRange reads a byte range of url
+func readRange(url string, byteRange string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+byteRange)
+	resp, err := mediaClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range request failed: %v", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+//videoDuration finds the duration of a video without downloading it, using the
+//movie header at the start or the end of the file
+func videoDuration(item *photos.MediaItem) (time.Duration, error) {
+	url := item.BaseURL + "=dv"
+	head, err := readRange(url, fmt.Sprintf("0-%v", durationProbeSize-1))
+	if err != nil {
+		return 0, err
+	}
+	d, err := mvhdDuration(head)
+	if err == nil {
+		return d, nil
+	}
+	tail, err := readRange(url, fmt.Sprintf("-%v", durationProbeSize))
+	if err != nil {
+		return 0, err
+	}
+	return mvhdDuration(tail)
+}
+
+//saved checks if the media of item is in fileName already, from the hash index or the object store
+//or else by its existence
+func saved(item *photos.MediaItem, fileName string) bool {
+	if Options.CAS != "" && stored(fileName) || indexed(item.ID, fileName) {
+		return true
+	}
+	_, err := os.Stat(fileName)
+	return err == nil
+}
+
+//checkDuration returns a skipError if item is a video outside the duration limits. videos saved
+//in fileName already are not checked, finding the duration takes up to two requests
+func checkDuration(item *photos.MediaItem, fileName string) error {
+	if Options.MinDuration == 0 && Options.MaxDuration == 0 {
+		return nil
+	}
+	if item.MediaMetadata == nil || item.MediaMetadata.Video == nil || saved(item, fileName) {
+		return nil
+	}
+	d, err := videoDuration(item)
+	if err != nil {
+		return fmt.Errorf("Unable to check duration: %v", err)
+	}
+	if Options.MinDuration > 0 && d < Options.MinDuration {
+		return skipError(fmt.Sprintf("duration %v is shorter than %v", d, Options.MinDuration))
+	}
+	if Options.MaxDuration > 0 && d > Options.MaxDuration {
+		return skipError(fmt.Sprintf("duration %v is longer than %v", d, Options.MaxDuration))
+	}
+	return nil
+}
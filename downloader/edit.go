@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/stevedenman/gitmoo-goog/exif"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//editedName is the state file of the downloaded sizes of the files edited after download, by item ID
+const editedName = "edited.json"
+
+//edited are the downloaded sizes of the edited files, loaded on first use. a file whose size is
+//its downloaded size is not downloaded again
+var edited = struct {
+	sync.Mutex
+	sizes   map[string]int64
+	changed bool
+}{}
+
+//loadEdited loads the state file, edited must be locked
+func loadEdited() {
+	if edited.sizes != nil {
+		return
+	}
+	edited.sizes = make(map[string]int64)
+	err := ReadState(editedName, &edited.sizes)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", editedName, err)
+	}
+}
+
+//editedSize returns the downloaded size of the file of item if it was edited
+func editedSize(id string) (int64, bool) {
+	edited.Lock()
+	defer edited.Unlock()
+	loadEdited()
+	size, ok := edited.sizes[id]
+	return size, ok
+}
+
+func setEdited(id string, size int64) {
+	edited.Lock()
+	defer edited.Unlock()
+	loadEdited()
+	edited.sizes[id] = size
+	edited.changed = true
+}
+
+//resetEdited forgets the sizes of a previous run, which may be of another backup folder
+func resetEdited() {
+	edited.Lock()
+	edited.sizes = nil
+	edited.changed = false
+	edited.Unlock()
+}
+
+//saveEdited saves the sizes of the files edited during the run
+func saveEdited() error {
+	edited.Lock()
+	defer edited.Unlock()
+	if !edited.changed {
+		return nil
+	}
+	edited.changed = false
+	return WriteState(editedName, edited.sizes)
+}
+
+//editPhoto edits the metadata of the JPEG file of item: the location is erased with
+//Options.StripGPS and the description written with Options.WriteDescription
+func editPhoto(item *photos.MediaItem, fileName string) error {
+	describe := Options.WriteDescription && item.Description != ""
+	if !describe && !Options.StripGPS || item.MimeType != "image/jpeg" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	size := int64(len(data))
+	changed := Options.StripGPS && exif.StripGPS(data)
+	if describe {
+		data, err = exif.SetDescription(data, item.Description)
+		if err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	err = writeFile(fileName, data)
+	if err != nil {
+		return err
+	}
+	recordContent(item.ID, fileName, data)
+	if int64(len(data)) != size {
+		setEdited(item.ID, size)
+	}
+	return nil
+}
+
+//stripFile erases the location of a JPEG file made from a download, such as a converted HEIC photo
+func stripFile(fileName string) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil || !exif.StripGPS(data) {
+		return err
+	}
+	return writeFile(fileName, data)
+}
@@ -0,0 +1,49 @@
+package downloader
+
+import (
+	"fmt"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+const (
+	//EnumerateSearch lists the library with mediaItems.search (the default)
+	EnumerateSearch = "search"
+	//EnumerateList lists the library with mediaItems.list
+	EnumerateList = "list"
+)
+
+//checkEnumerate validates Options.Enumerate, mediaItems.list has no filters nor order
+func checkEnumerate() error {
+	switch Options.Enumerate {
+	case "", EnumerateSearch:
+		return nil
+	case EnumerateList:
+	default:
+		return fmt.Errorf("Invalid enumeration '%v', use %v or %v", Options.Enumerate, EnumerateSearch, EnumerateList)
+	}
+	if searchFilters() != nil {
+		return fmt.Errorf("The media type (-type) can not be used with -enumerate %v", EnumerateList)
+	}
+	if Options.Order != "" {
+		return fmt.Errorf("The order (-order) can not be used with -enumerate %v", EnumerateList)
+	}
+	return nil
+}
+
+//listLibrary answers the searches of the whole library with mediaItems.list, searches of an
+//album or with filters still use mediaItems.search
+type listLibrary struct {
+	photos.Library
+}
+
+func (l listLibrary) SearchMediaItems(req *photos.SearchMediaItemsRequest) (*photos.SearchMediaItemsResponse, error) {
+	if req.AlbumID != "" || req.Filters != nil || req.OrderBy != "" {
+		return l.Library.SearchMediaItems(req)
+	}
+	resp, err := l.Library.ListMediaItems(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &photos.SearchMediaItemsResponse{MediaItems: resp.MediaItems, NextPageToken: resp.NextPageToken}, nil
+}
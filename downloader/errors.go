@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+var (
+	//ErrRateLimited matches errors caused by exceeding the API or download quota
+	ErrRateLimited = photos.ErrRateLimited
+	//ErrBaseURLExpired matches media downloads refused because the item base URL is no longer valid
+	ErrBaseURLExpired = errors.New("base URL expired")
+	//ErrItemSkipped matches items left out by the filters
+	ErrItemSkipped = errors.New("item skipped")
+	//ErrTooManyErrors matches runs stopped because more items failed than Options.MaxErrors allows
+	ErrTooManyErrors = errors.New("too many errors")
+	//ErrQuotaReached matches runs stopped because the API calls of the day reached Options.DailyQuota
+	ErrQuotaReached = errors.New("daily quota reached")
+	//ErrStopped matches runs stopped by Stop
+	ErrStopped = errors.New("run stopped")
+	//ErrRunInProgress is returned by DownloadAll when another run is in progress
+	ErrRunInProgress = errors.New("another run is in progress")
+)
+
+//DownloadError is the error of an item that failed to download
+type DownloadError struct {
+	//ItemID is the media item ID
+	ItemID string
+	//Path is the file the item was saved to
+	Path string
+	//ProductURL opens the item in Google Photos
+	ProductURL string
+	Err        error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("Unable to download %v to '%v': %v", e.ItemID, e.Path, e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+//skipError is the reason an item is skipped, it matches ErrItemSkipped
+type skipError string
+
+func (e skipError) Error() string {
+	return string(e)
+}
+
+func (e skipError) Is(target error) bool {
+	return target == ErrItemSkipped
+}
+
+//errInvalid matches downloads that failed the validation of the media file
+var errInvalid = errors.New("invalid media")
+
+//invalidError is the reason a downloaded file failed the validation, it matches errInvalid
+type invalidError string
+
+func (e invalidError) Error() string {
+	return string(e)
+}
+
+func (e invalidError) Is(target error) bool {
+	return target == errInvalid
+}
+
+//mediaError returns the error of a media download that failed with status
+func mediaError(status int, text string) error {
+	switch status {
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %v", ErrRateLimited, text)
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("%w: %v", ErrBaseURLExpired, text)
+	}
+	return errors.New(text)
+}
+
+//ItemErrors is returned by DownloadAll when items failed to download, with the error of every item
+type ItemErrors []*DownloadError
+
+func (e ItemErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v items failed to download, the first: %v", len(e), e[0])
+}
+
+//Unwrap returns the item errors, for errors.Is and errors.As
+func (e ItemErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,58 @@
+package downloader
+
+import "github.com/stevedenman/gitmoo-goog/photos"
+
+//EventType is the kind of a progress Event
+type EventType int
+
+const (
+	//ItemStarted is sent when a worker starts downloading an item
+	ItemStarted EventType = iota
+	//ItemFinished is sent when an item was downloaded (or already present), Err is set if it failed
+	ItemFinished
+	//ItemSkipped is sent when an item is left out by the filters, Err has the reason
+	ItemSkipped
+	//PageFetched is sent when a page of search results was received, Items is the page size
+	PageFetched
+	//RunFinished is sent at the end of DownloadAll, Err is set if the run failed
+	RunFinished
+)
+
+var eventNames = []string{"ItemStarted", "ItemFinished", "ItemSkipped", "PageFetched", "RunFinished"}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventNames) {
+		return "Unknown"
+	}
+	return eventNames[t]
+}
+
+//Event is a progress notification for programs embedding the downloader
+type Event struct {
+	Type EventType
+	//Item is the media item, nil for PageFetched and RunFinished
+	Item *photos.MediaItem
+	//Items is the number of items in a fetched page
+	Items int
+	Err   error
+	//Stats are the run statistics when the event was sent
+	Stats Snapshot
+}
+
+//emit sends an event to Options.OnEvent and to the hooks of the run, if set
+func emit(e Event) {
+	var hooks *Hooks
+	if work != nil {
+		hooks = work.hooks
+	}
+	if Options.OnEvent == nil && hooks == nil {
+		return
+	}
+	e.Stats = stats.snapshot()
+	if Options.OnEvent != nil {
+		Options.OnEvent(e)
+	}
+	if hooks != nil {
+		hooks.call(e)
+	}
+}
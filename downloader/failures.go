@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+//failuresName is the state file of the items that failed to download and did not succeed since
+const failuresName = "failures.json"
+
+//PendingFailure is an item that failed to download, until a run downloads it
+type PendingFailure struct {
+	//Path is the file the item is saved to
+	Path string `json:"path"`
+	//Error is the last error
+	Error string `json:"error"`
+	//Since is when the item failed first
+	Since time.Time `json:"since"`
+	//Attempts is the number of runs it failed in
+	Attempts int `json:"attempts"`
+}
+
+//failures are the pending failures, loaded on first use
+var failures = struct {
+	sync.Mutex
+	items   map[string]*PendingFailure
+	changed bool
+}{}
+
+//ReadFailures reads the pending failures of the backup folder, by item ID
+func ReadFailures() (map[string]*PendingFailure, error) {
+	items := make(map[string]*PendingFailure)
+	err := ReadState(failuresName, &items)
+	return items, err
+}
+
+//loadFailures loads the state file, failures must be locked
+func loadFailures() {
+	if failures.items != nil {
+		return
+	}
+	items, err := ReadFailures()
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", failuresName, err)
+		items = make(map[string]*PendingFailure)
+	}
+	failures.items = items
+}
+
+//recordFailure adds a failed item to the pending failures
+func recordFailure(f *DownloadError) {
+	failures.Lock()
+	defer failures.Unlock()
+	loadFailures()
+	p, ok := failures.items[f.ItemID]
+	if !ok {
+		p = &PendingFailure{Since: time.Now()}
+		failures.items[f.ItemID] = p
+	}
+	p.Path = relativeName(f.Path)
+	p.Error = f.Err.Error()
+	p.Attempts++
+	failures.changed = true
+}
+
+//clearFailure removes an item downloaded from the pending failures
+func clearFailure(id string) {
+	failures.Lock()
+	defer failures.Unlock()
+	loadFailures()
+	if _, ok := failures.items[id]; ok {
+		delete(failures.items, id)
+		failures.changed = true
+	}
+}
+
+//resetFailures forgets the failures loaded by a previous run, which may be of another backup folder
+func resetFailures() {
+	failures.Lock()
+	failures.items = nil
+	failures.changed = false
+	failures.Unlock()
+}
+
+//saveFailures saves the pending failures, if they changed
+func saveFailures() error {
+	failures.Lock()
+	defer failures.Unlock()
+	if !failures.changed {
+		return nil
+	}
+	failures.changed = false
+	return WriteState(failuresName, failures.items)
+}
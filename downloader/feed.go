@@ -0,0 +1,205 @@
+package downloader
+
+import (
+	"encoding/xml"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//feedName is the state file of the entries of the feed, newest first
+const feedName = "feed.json"
+
+//feedEntries is the number of items kept in the feed
+const feedEntries = 200
+
+//feedEntry is an item downloaded by a run
+type feedEntry struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	File        string    `json:"file"`
+	MimeType    string    `json:"mimeType,omitempty"`
+	ProductURL  string    `json:"productUrl,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Created     string    `json:"created,omitempty"`
+	Archived    time.Time `json:"archived"`
+}
+
+//feed are the items downloaded by the run
+var feed struct {
+	sync.Mutex
+	entries []feedEntry
+}
+
+//resetFeed forgets the items of the previous run
+func resetFeed() {
+	feed.Lock()
+	feed.entries = nil
+	feed.Unlock()
+}
+
+//addFeedEntry records the download of item to imageName for the feed
+func addFeedEntry(item *photos.MediaItem, imageName string) {
+	if Options.Feed == "" {
+		return
+	}
+	file, err := filepath.Abs(imageName)
+	if err != nil {
+		file = imageName
+	}
+	e := feedEntry{
+		ID:          item.ID,
+		Title:       item.Filename,
+		File:        file,
+		MimeType:    item.MimeType,
+		ProductURL:  item.ProductURL,
+		Description: item.Description,
+		Archived:    time.Now().UTC(),
+	}
+	if e.Title == "" {
+		e.Title = filepath.Base(imageName)
+	}
+	if item.MediaMetadata != nil {
+		e.Created = item.MediaMetadata.CreationTime
+	}
+	feed.Lock()
+	feed.entries = append(feed.entries, e)
+	feed.Unlock()
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+}
+
+//fileURL returns the file URL of path
+func fileURL(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		//a Windows drive letter
+		abs = "/" + abs
+	}
+	return (&url.URL{Scheme: "file", Path: abs}).String()
+}
+
+//fileLink returns the link to fileName from the feed, relative to the feed when it can be
+func fileLink(fileName string) string {
+	feedFile, err := filepath.Abs(Options.Feed)
+	if err != nil {
+		return fileURL(fileName)
+	}
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		return fileURL(fileName)
+	}
+	rel, err := filepath.Rel(filepath.Dir(feedFile), abs)
+	if err != nil {
+		//another Windows drive
+		return fileURL(fileName)
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+//saveFeed adds the items downloaded by the run to the feed, and writes it to Options.Feed as Atom
+func saveFeed() error {
+	if Options.Feed == "" {
+		return nil
+	}
+	feed.Lock()
+	defer feed.Unlock()
+	var entries []feedEntry
+	err := ReadState(feedName, &entries)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", feedName, err)
+		entries = nil
+	}
+	//the items downloaded again are moved to the top
+	added := make(map[string]bool)
+	latest := make([]feedEntry, 0, len(feed.entries)+len(entries))
+	for i := len(feed.entries) - 1; i >= 0; i-- {
+		added[feed.entries[i].ID] = true
+		latest = append(latest, feed.entries[i])
+	}
+	for _, e := range entries {
+		if !added[e.ID] {
+			latest = append(latest, e)
+		}
+	}
+	entries = latest
+	if len(entries) > feedEntries {
+		entries = entries[:feedEntries]
+	}
+	if len(feed.entries) > 0 {
+		err = WriteState(feedName, entries)
+		if err != nil {
+			return err
+		}
+	}
+	feed.entries = nil
+
+	folder, err := filepath.Abs(Options.BackupFolder)
+	if err != nil {
+		folder = Options.BackupFolder
+	}
+	f := atomFeed{
+		Title:   "gitmoo-goog: " + filepath.Base(folder),
+		ID:      fileURL(folder),
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "gitmoo-goog"},
+	}
+	for _, e := range entries {
+		entry := atomEntry{
+			Title:     e.Title,
+			ID:        "urn:gitmoo-goog:item:" + e.ID,
+			Updated:   e.Archived.Format(time.RFC3339),
+			Published: e.Created,
+			Links:     []atomLink{{Rel: "enclosure", Href: fileLink(e.File), Type: e.MimeType}},
+			Summary:   e.Description,
+		}
+		if e.ProductURL != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: e.ProductURL})
+		}
+		f.Entries = append(f.Entries, entry)
+	}
+	data, err := xml.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(Options.Feed, append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,289 @@
+package downloader
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//extensionsName is the state file of the extensions found from the content of the files, by
+//item ID, for the files whose content does not match their mime type
+const extensionsName = "extensions.json"
+
+//sniffSize is how much of a file is read to find its type
+const sniffSize = 32
+
+//mimeExtensions are the extensions of the mime types, used before the mime database of the OS
+//which gives different (and surprising, such as .jfif) results on every system
+var mimeExtensions = map[string]string{
+	"image/jpeg":            ".jpg",
+	"image/png":             ".png",
+	"image/gif":             ".gif",
+	"image/webp":            ".webp",
+	"image/heic":            ".heic",
+	"image/heif":            ".heif",
+	"image/avif":            ".avif",
+	"image/bmp":             ".bmp",
+	"image/tiff":            ".tif",
+	"image/x-icon":          ".ico",
+	"image/x-adobe-dng":     ".dng",
+	"image/x-canon-cr2":     ".cr2",
+	"image/x-canon-cr3":     ".cr3",
+	"image/x-canon-crw":     ".crw",
+	"image/x-nikon-nef":     ".nef",
+	"image/x-nikon-nrw":     ".nrw",
+	"image/x-sony-arw":      ".arw",
+	"image/x-sony-sr2":      ".sr2",
+	"image/x-olympus-orf":   ".orf",
+	"image/x-panasonic-rw2": ".rw2",
+	"image/x-fuji-raf":      ".raf",
+	"image/x-pentax-pef":    ".pef",
+	"image/x-samsung-srw":   ".srw",
+	"video/mp4":             ".mp4",
+	"video/quicktime":       ".mov",
+	"video/x-m4v":           ".m4v",
+	"video/3gpp":            ".3gp",
+	"video/3gpp2":           ".3g2",
+	"video/x-msvideo":       ".avi",
+	"video/webm":            ".webm",
+	"video/x-matroska":      ".mkv",
+	"video/mpeg":            ".mpg",
+	"video/mp2t":            ".mts",
+	"video/x-ms-wmv":        ".wmv",
+}
+
+//heicSniffBrands are the heifBrands telling a HEIC photo apart, without mif1 and msf1 which AVIF
+//uses too
+var heicSniffBrands = map[string]bool{"heic": true, "heix": true, "hevc": true, "hevx": true, "heim": true, "heis": true}
+
+//mimeExtension returns the extension of mimeType, an empty string if it is unknown
+func mimeExtension(mimeType string) string {
+	mimeType = strings.ToLower(mimeType)
+	if ext, ok := mimeExtensions[mimeType]; ok {
+		return ext
+	}
+	return legacyExtension(mimeType)
+}
+
+//legacyExtension returns the extension of mimeType in the mime database of the OS, used to
+//name files before mimeExtensions
+func legacyExtension(mimeType string) string {
+	ext, _ := mime.ExtensionsByType(mimeType)
+	if len(ext) == 0 {
+		return ""
+	}
+	return ext[0]
+}
+
+//sniffExtension returns the extension of the file starting with header, an empty string if
+//the type is not recognized or ambiguous (TIFF based RAW files, Matroska)
+func sniffExtension(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return ".jpg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return ".png"
+	case bytes.HasPrefix(header, []byte("GIF87a")) || bytes.HasPrefix(header, []byte("GIF89a")):
+		return ".gif"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return ".webp"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "AVI ":
+		return ".avi"
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		brand := string(header[8:12])
+		switch {
+		case heicSniffBrands[brand]:
+			return ".heic"
+		case brand == "avif" || brand == "avis":
+			return ".avif"
+		case brand == "crx ":
+			return ".cr3"
+		case brand == "qt  ":
+			return ".mov"
+		case brand == "M4V " || brand == "M4VH" || brand == "M4VP":
+			return ".m4v"
+		case strings.HasPrefix(brand, "3gp"):
+			return ".3gp"
+		case strings.HasPrefix(brand, "3g2"):
+			return ".3g2"
+		case brand == "mif1" || brand == "msf1":
+			return ""
+		}
+		return ".mp4"
+	}
+	return ""
+}
+
+//extensions are the extensions of the files whose content does not match their mime type,
+//loaded on first use
+var extensions = struct {
+	sync.Mutex
+	exts    map[string]string
+	changed bool
+}{}
+
+//loadExtensions loads the state file, extensions must be locked
+func loadExtensions() {
+	if extensions.exts != nil {
+		return
+	}
+	extensions.exts = make(map[string]string)
+	err := ReadState(extensionsName, &extensions.exts)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", extensionsName, err)
+	}
+}
+
+//fileExtension returns the extension found from the content of the file of an item, if it is
+//not the one of its mime type
+func fileExtension(id string) (string, bool) {
+	extensions.Lock()
+	defer extensions.Unlock()
+	loadExtensions()
+	ext, ok := extensions.exts[id]
+	return ext, ok
+}
+
+//setExtension records the extension found from the content of the file of an item, an empty
+//ext forgets it
+func setExtension(id string, ext string) {
+	extensions.Lock()
+	defer extensions.Unlock()
+	loadExtensions()
+	if _, ok := extensions.exts[id]; !ok && ext == "" {
+		return
+	}
+	if ext == "" {
+		delete(extensions.exts, id)
+	} else {
+		extensions.exts[id] = ext
+	}
+	extensions.changed = true
+}
+
+//resetExtensions forgets the extensions of a previous run, which may be of another backup folder
+func resetExtensions() {
+	extensions.Lock()
+	extensions.exts = nil
+	extensions.changed = false
+	extensions.Unlock()
+}
+
+//saveExtensions saves the extensions found during the run
+func saveExtensions() error {
+	extensions.Lock()
+	defer extensions.Unlock()
+	if !extensions.changed {
+		return nil
+	}
+	extensions.changed = false
+	return WriteState(extensionsName, extensions.exts)
+}
+
+//maxExtensionLength is the longest extension taken from a file name, dot included
+const maxExtensionLength = 6
+
+//nameExtension returns the extension of the original file name, an empty string if it does not
+//look like one
+func nameExtension(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if len(ext) < 2 || len(ext) > maxExtensionLength {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+//contentTypeExtension returns the extension of the Content-Type of a download, an empty string
+//if it is unknown or generic
+func contentTypeExtension(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "application/octet-stream" {
+		return ""
+	}
+	return mimeExtension(mediaType)
+}
+
+//itemExtension returns the extension of the media file of item: the one found from its content,
+//of its mime type, or of its original file name when the mime type is missing or unknown
+func itemExtension(item *photos.MediaItem) string {
+	if ext, ok := fileExtension(item.ID); ok {
+		return ext
+	}
+	ext := mimeExtension(item.MimeType)
+	if ext == "" {
+		ext = nameExtension(item.Filename)
+	}
+	return ext
+}
+
+//withLegacyExtension returns the file named with the extension of the OS mime database, when
+//it exists and name+ext does not, so archives named before mimeExtensions are not downloaded again
+func withLegacyExtension(item *photos.MediaItem, name string, ext string) string {
+	if _, ok := fileExtension(item.ID); ok {
+		return name + ext
+	}
+	legacy := legacyExtension(item.MimeType)
+	if legacy == "" || legacy == ext {
+		return name + ext
+	}
+	if _, err := os.Stat(name + ext); !os.IsNotExist(err) {
+		return name + ext
+	}
+	if _, err := os.Stat(name + legacy); err == nil {
+		return name + legacy
+	}
+	return name + ext
+}
+
+//retype renames the downloaded file of item when its content does not match its extension,
+//it returns the new name
+func retype(item *photos.MediaItem, imageName string) string {
+	file, err := os.Open(imageName)
+	if err != nil {
+		return imageName
+	}
+	header := make([]byte, sniffSize)
+	n, _ := io.ReadFull(file, header)
+	file.Close()
+	ext := sniffExtension(header[:n])
+	if ext == "" && filepath.Ext(imageName) == "" {
+		//the extension of the Content-Type, recorded by createImage
+		ext, _ = fileExtension(item.ID)
+	}
+	if ext == "" || strings.EqualFold(ext, filepath.Ext(imageName)) {
+		return imageName
+	}
+	if ext == mimeExtension(item.MimeType) {
+		setExtension(item.ID, "")
+	} else {
+		if item.MimeType != "" {
+			log.Printf("The content of '%v' is %v, not %v", imageName, ext, item.MimeType)
+		}
+		setExtension(item.ID, ext)
+	}
+	newImage := strings.TrimSuffix(imageName, filepath.Ext(imageName)) + ext
+	err = os.Rename(imageName, newImage)
+	if err != nil {
+		log.Printf("Unable to move '%v' to '%v': %v", imageName, newImage, err)
+		setExtension(item.ID, "")
+		return imageName
+	}
+	moveHash(item.ID, newImage)
+	err = syncDir(filepath.Dir(newImage))
+	if err != nil {
+		log.Printf("Unable to flush '%v': %v", filepath.Dir(newImage), err)
+	}
+	return newImage
+}
@@ -0,0 +1,155 @@
+package downloader
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//rawMimeTypes are mime types of camera RAW files
+var rawMimeTypes = map[string]bool{
+	"image/x-adobe-dng":     true,
+	"image/x-canon-cr2":     true,
+	"image/x-canon-cr3":     true,
+	"image/x-canon-crw":     true,
+	"image/x-nikon-nef":     true,
+	"image/x-nikon-nrw":     true,
+	"image/x-sony-arw":      true,
+	"image/x-sony-sr2":      true,
+	"image/x-olympus-orf":   true,
+	"image/x-panasonic-rw2": true,
+	"image/x-fuji-raf":      true,
+	"image/x-pentax-pef":    true,
+	"image/x-samsung-srw":   true,
+}
+
+//rawExtensions are file extensions of camera RAW files
+var rawExtensions = map[string]bool{
+	".dng": true, ".cr2": true, ".cr3": true, ".crw": true, ".nef": true, ".nrw": true, ".arw": true,
+	".sr2": true, ".orf": true, ".rw2": true, ".raf": true, ".pef": true, ".srw": true,
+}
+
+//isRaw checks if item is a camera RAW file
+func isRaw(item *photos.MediaItem) bool {
+	return rawMimeTypes[strings.ToLower(item.MimeType)] || rawExtensions[strings.ToLower(filepath.Ext(item.Filename))]
+}
+
+//matchesAny checks if s matches one of the glob patterns, ignoring case
+func matchesAny(patterns []string, s string) bool {
+	s = strings.ToLower(s)
+	for _, p := range patterns {
+		ok, err := path.Match(strings.ToLower(p), s)
+		if err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+//camera returns the "make model" of the device that created item
+func camera(item *photos.MediaItem) string {
+	if item.MediaMetadata == nil {
+		return ""
+	}
+	cameraMake, cameraModel := "", ""
+	if p := item.MediaMetadata.Photo; p != nil {
+		cameraMake, cameraModel = p.CameraMake, p.CameraModel
+	} else if v := item.MediaMetadata.Video; v != nil {
+		cameraMake, cameraModel = v.CameraMake, v.CameraModel
+	}
+	return strings.TrimSpace(cameraMake + " " + cameraModel)
+}
+
+//checkFilters validates the filter options
+func checkFilters() error {
+	switch Options.Raw {
+	case "", "include", "skip", "only":
+	default:
+		return fmt.Errorf("Invalid raw option '%v', use include, skip or only", Options.Raw)
+	}
+	switch Options.MediaType {
+	case "", "all", "photo", "video":
+	default:
+		return fmt.Errorf("Invalid media type '%v', use all, photo or video", Options.MediaType)
+	}
+	for _, patterns := range [][]string{Options.Cameras, Options.ExcludeCameras, Options.IncludeMime, Options.ExcludeMime} {
+		for _, p := range patterns {
+			_, err := path.Match(p, "")
+			if err != nil {
+				return fmt.Errorf("Invalid pattern '%v': %v", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+//searchFilters returns the API filters matching the filter options, nil if none apply
+func searchFilters() *photos.Filters {
+	switch Options.MediaType {
+	case "photo":
+		return &photos.Filters{MediaTypeFilter: &photos.MediaTypeFilter{MediaTypes: []string{"PHOTO"}}}
+	case "video":
+		return &photos.Filters{MediaTypeFilter: &photos.MediaTypeFilter{MediaTypes: []string{"VIDEO"}}}
+	}
+	return nil
+}
+
+//checkFileSize returns a skipError if the download of size bytes is larger than MaxFileSize
+func checkFileSize(size int64) error {
+	if Options.MaxFileSize > 0 && size > 0 && uint64(size) > Options.MaxFileSize {
+		return skipError(fmt.Sprintf("file size %v is larger than %v", humanize.Bytes(uint64(size)), humanize.Bytes(Options.MaxFileSize)))
+	}
+	return nil
+}
+
+//skipReason returns why item should not be downloaded, or an empty string to download it
+func skipReason(item *photos.MediaItem) string {
+	video := item.MediaMetadata != nil && item.MediaMetadata.Video != nil
+	if video && Options.MediaType == "photo" {
+		return "not a photo"
+	}
+	if !video && Options.MediaType == "video" {
+		return "not a video"
+	}
+	if len(Options.IncludeMime) > 0 && !matchesAny(Options.IncludeMime, item.MimeType) {
+		return fmt.Sprintf("mime type '%v' is not included", item.MimeType)
+	}
+	if matchesAny(Options.ExcludeMime, item.MimeType) {
+		return fmt.Sprintf("mime type '%v' is excluded", item.MimeType)
+	}
+	if !video && item.MediaMetadata != nil {
+		w, h := item.MediaMetadata.Width, item.MediaMetadata.Height
+		if (Options.MinWidth > 0 && w < int64(Options.MinWidth)) || (Options.MinHeight > 0 && h < int64(Options.MinHeight)) {
+			return fmt.Sprintf("resolution %vx%v is below %vx%v", w, h, Options.MinWidth, Options.MinHeight)
+		}
+	}
+	if len(Options.Cameras) > 0 || len(Options.ExcludeCameras) > 0 {
+		c := camera(item)
+		if len(Options.Cameras) > 0 && !matchesAny(Options.Cameras, c) {
+			return fmt.Sprintf("camera '%v' is not selected", c)
+		}
+		if matchesAny(Options.ExcludeCameras, c) {
+			return fmt.Sprintf("camera '%v' is excluded", c)
+		}
+	}
+	raw := isRaw(item)
+	if raw && Options.Raw == "skip" {
+		return "RAW file"
+	}
+	if !raw && Options.Raw == "only" {
+		return "not a RAW file"
+	}
+	return ""
+}
+
+//itemFolder returns the folder to place item in
+func itemFolder(folder string, item *photos.MediaItem) string {
+	if Options.RawFolder != "" && isRaw(item) {
+		return filepath.Join(folder, Options.RawFolder)
+	}
+	return folder
+}
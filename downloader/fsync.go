@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+//partSuffix is added to files being written with Options.Fsync, until they are complete
+const partSuffix = ".part"
+
+//createPart creates the file written for fileName: fileName itself, or with Options.Fsync a
+//.part file that commitFile renames once complete, so a crash never leaves a truncated file
+func createPart(fileName string) (*os.File, error) {
+	if Options.Fsync {
+		return createFile(fileName + partSuffix)
+	}
+	return createFile(fileName)
+}
+
+//commitFile closes a file of createPart. with Options.Fsync its data is flushed to the disk
+//before it is renamed to fileName, and the rename is flushed with the folder
+func commitFile(file *os.File, fileName string) error {
+	if !Options.Fsync {
+		return file.Close()
+	}
+	err := file.Sync()
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if file.Name() != fileName {
+		err = os.Rename(file.Name(), fileName)
+		if err != nil {
+			return err
+		}
+	}
+	return syncDir(filepath.Dir(fileName))
+}
+
+//abortFile closes a file of createPart whose data is incomplete. with Options.Fsync the .part
+//file is removed and fileName is left as it was
+func abortFile(file *os.File, fileName string) {
+	file.Close()
+	if file.Name() != fileName {
+		os.Remove(file.Name())
+	}
+}
+
+//syncDir flushes the entries of folder with Options.Fsync. folders can not be flushed on Windows,
+//NTFS journals renames
+func syncDir(folder string) error {
+	if !Options.Fsync || runtime.GOOS == "windows" {
+		return nil
+	}
+	dir, err := os.Open(folder)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	closeErr := dir.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//hashIndexName is the state file of the content hashes of the media files, by item ID
+const hashIndexName = "hashes.json"
+
+//HashEntry is the content hash of the media file of an item, as it is in the archive
+type HashEntry struct {
+	//File is the media file, relative to the backup folder
+	File string `json:"file"`
+	//Size of the file
+	Size int64 `json:"size"`
+	//SHA256 of the file content
+	SHA256 string `json:"sha256"`
+}
+
+//hashes is the hash index, loaded on first use
+var hashes = struct {
+	sync.Mutex
+	index   map[string]HashEntry
+	changed bool
+}{}
+
+//LoadHashIndex reads the hash index of the backup folder, with the index on disk of the runs with
+//Options.LowMemory
+func LoadHashIndex() (map[string]HashEntry, error) {
+	index := make(map[string]HashEntry)
+	err := ReadState(hashIndexName, &index)
+	if err != nil {
+		return index, err
+	}
+	_, err = readShards(index)
+	return index, err
+}
+
+//SaveHashIndex saves the hash index of the backup folder, replacing the index on disk
+func SaveHashIndex(index map[string]HashEntry) error {
+	err := WriteState(hashIndexName, index)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(StateFileName(hashShardsName))
+}
+
+//loadHashes loads the index, hashes must be locked
+func loadHashes() {
+	if hashes.index != nil {
+		return
+	}
+	index, err := LoadHashIndex()
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", hashIndexName, err)
+		index = make(map[string]HashEntry)
+	}
+	hashes.index = index
+	//the index on disk of a run with Options.LowMemory is moved back to hashIndexName
+	if _, err := os.Stat(StateFileName(hashShardsName)); err == nil {
+		hashes.changed = true
+	}
+}
+
+//hashEntry returns the entry of the item id in the index
+func hashEntry(id string) (HashEntry, bool) {
+	if Options.LowMemory {
+		return diskHash(id)
+	}
+	hashes.Lock()
+	defer hashes.Unlock()
+	loadHashes()
+	entry, ok := hashes.index[id]
+	return entry, ok
+}
+
+//setHashEntry records the entry of the item id in the index
+func setHashEntry(id string, entry HashEntry) {
+	if Options.LowMemory {
+		setDiskHash(id, entry)
+		return
+	}
+	hashes.Lock()
+	defer hashes.Unlock()
+	loadHashes()
+	hashes.index[id] = entry
+	hashes.changed = true
+}
+
+//relativeName returns fileName relative to the backup folder, with slashes
+func relativeName(fileName string) string {
+	rel, err := filepath.Rel(Options.BackupFolder, fileName)
+	if err != nil {
+		rel = fileName
+	}
+	return filepath.ToSlash(rel)
+}
+
+//recordHash stores the hash of the media file of an item
+func recordHash(id string, fileName string, size int64, sum []byte) {
+	setHashEntry(id, HashEntry{File: relativeName(fileName), Size: size, SHA256: hex.EncodeToString(sum)})
+}
+
+//recordContent stores the hash of data, the new content of the media file of an item
+func recordContent(id string, fileName string, data []byte) {
+	sum := sha256.Sum256(data)
+	recordHash(id, fileName, int64(len(data)), sum[:])
+}
+
+//recordFile hashes fileName, the media file of an item already in the archive, so the next runs
+//find it in the index
+func recordFile(id string, fileName string) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, file)
+	if err != nil {
+		log.Printf("Unable to hash '%v': %v", fileName, err)
+		return
+	}
+	recordHash(id, fileName, n, hasher.Sum(nil))
+}
+
+//indexed checks if fileName is in the index as the media file of the item id, with the same size
+func indexed(id string, fileName string) bool {
+	entry, ok := hashEntry(id)
+	if !ok || entry.File != relativeName(fileName) {
+		return false
+	}
+	info, err := os.Stat(fileName)
+	return err == nil && info.Size() == entry.Size
+}
+
+//verifyHash checks the content of fileName against its hash in the index, known is false when
+//the index has no hash of fileName for the item id
+func verifyHash(id string, fileName string) (ok bool, known bool) {
+	entry, found := hashEntry(id)
+	if !found || entry.File != relativeName(fileName) {
+		return false, false
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false, true
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, file)
+	if err != nil || n != entry.Size {
+		return false, true
+	}
+	return hex.EncodeToString(hasher.Sum(nil)) == entry.SHA256, true
+}
+
+//fileHash returns the SHA-256 of fileName, the media file of the item id, from the index when
+//it is up to date or by reading the file
+func fileHash(id string, fileName string) (string, error) {
+	if indexed(id, fileName) {
+		entry, _ := hashEntry(id)
+		return entry.SHA256, nil
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+	sum := hasher.Sum(nil)
+	recordHash(id, fileName, n, sum)
+	return hex.EncodeToString(sum), nil
+}
+
+//moveHash updates the file of an item after it was renamed
+func moveHash(id string, fileName string) {
+	entry, ok := hashEntry(id)
+	if ok {
+		entry.File = relativeName(fileName)
+		setHashEntry(id, entry)
+	}
+}
+
+//resetHashes forgets the index of a previous run, which may be of another backup folder
+func resetHashes() {
+	hashes.Lock()
+	hashes.index = nil
+	hashes.changed = false
+	hashes.Unlock()
+	resetDiskHashes()
+}
+
+//saveHashes saves the hashes recorded during the run
+func saveHashes() error {
+	if Options.LowMemory {
+		return compactShards()
+	}
+	hashes.Lock()
+	defer hashes.Unlock()
+	if !hashes.changed {
+		return nil
+	}
+	hashes.changed = false
+	return SaveHashIndex(hashes.index)
+}
@@ -0,0 +1,49 @@
+package downloader
+
+import "github.com/stevedenman/gitmoo-goog/photos"
+
+//Hooks are optional callbacks of a Downloader, for metrics, notifications or custom bookkeeping.
+//the item hooks are called from the download workers, so they must be safe for concurrent use
+type Hooks struct {
+	//OnItemStart is called when an item starts downloading
+	OnItemStart func(item *photos.MediaItem)
+	//OnItemDone is called when an item was downloaded, or was already present
+	OnItemDone func(item *photos.MediaItem)
+	//OnError is called when an item failed to download
+	OnError func(item *photos.MediaItem, err error)
+	//OnRunComplete is called at the end of the run with its statistics, err is set if it failed
+	OnRunComplete func(stats Snapshot, err error)
+}
+
+//Downloader downloads a library with the package Options, calling its Hooks. the Downloaders
+//share the Options and the state of the package, one runs at a time
+type Downloader struct {
+	Library photos.Library
+	Hooks   Hooks
+}
+
+//New returns a Downloader of svc without hooks
+func New(svc photos.Library) *Downloader {
+	return &Downloader{Library: svc}
+}
+
+//DownloadAll downloads all files, see DownloadAll. Options.OnEvent still receives the events.
+//it returns ErrRunInProgress if another run is in progress
+func (d *Downloader) DownloadAll() (*Result, error) {
+	hooks := d.Hooks
+	return downloadAll(d.Library, &hooks)
+}
+
+//call dispatches an event to the hooks
+func (h *Hooks) call(e Event) {
+	switch {
+	case e.Type == ItemStarted && h.OnItemStart != nil:
+		h.OnItemStart(e.Item)
+	case e.Type == ItemFinished && e.Err == nil && h.OnItemDone != nil:
+		h.OnItemDone(e.Item)
+	case e.Type == ItemFinished && e.Err != nil && h.OnError != nil:
+		h.OnError(e.Item, e.Err)
+	case e.Type == RunFinished && h.OnRunComplete != nil:
+		h.OnRunComplete(e.Stats, e.Err)
+	}
+}
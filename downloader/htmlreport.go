@@ -0,0 +1,166 @@
+package downloader
+
+import (
+	"bytes"
+	"html/template"
+	"path/filepath"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+//HTMLReportName is the HTML report written to the backup folder with Options.HTMLReport
+const HTMLReportName = "report.html"
+
+//chartDays is the number of days of the chart of the HTML report
+const chartDays = 30
+
+//htmlDay is a bar of the chart of the HTML report
+type htmlDay struct {
+	Day   string
+	Bytes uint64
+	//Height is the height of the bar, in percent of the busiest day
+	Height int
+}
+
+//htmlFailure is a row of the failed items of the HTML report
+type htmlFailure struct {
+	ItemID     string
+	Path       string
+	ProductURL string
+	Error      string
+}
+
+//htmlReport is the data of the HTML report
+type htmlReport struct {
+	Generated string
+	Folder    string
+	//Status sums up the run for the title, OK is false when it failed or items failed
+	Status   string
+	OK       bool
+	Result   *Result
+	Lifetime *Lifetime
+	Days     []htmlDay
+	Failures []htmlFailure
+}
+
+var htmlFuncs = template.FuncMap{
+	"bytes": humanize.Bytes,
+	"duration": func(d time.Duration) time.Duration {
+		return d.Round(time.Second)
+	},
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Format("Mon 2 Jan 2006 15:04") + " (" + humanize.Time(t) + ")"
+	},
+}
+
+var htmlTemplate = template.Must(template.New(HTMLReportName).Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Photo backup: {{.Status}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; padding: 0 1em; color: #222; }
+h1 { font-size: 1.6em; }
+.ok { color: #1a7f37; }
+.failed { color: #cf222e; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.number { text-align: right; }
+.chart { display: flex; align-items: flex-end; height: 12em; gap: 2px; border-bottom: 1px solid #888; margin-bottom: .3em; }
+.chart div { flex: 1; background: #4a90d9; min-height: 1px; }
+.axis { display: flex; justify-content: space-between; font-size: .8em; color: #666; margin-bottom: 2em; }
+</style>
+</head>
+<body>
+<h1 class="{{if .OK}}ok{{else}}failed{{end}}">{{.Status}}</h1>
+<p>Backup of Google Photos into <code>{{.Folder}}</code>, last updated {{.Generated}}.</p>
+
+<h2>Last run</h2>
+<table>
+<tr><th>Items checked</th><td class="number">{{.Result.Processed}}</td></tr>
+<tr><th>Files downloaded</th><td class="number">{{.Result.Downloaded}}</td></tr>
+<tr><th>Items skipped by the filters</th><td class="number">{{.Result.Skipped}}</td></tr>
+<tr><th>Failed items</th><td class="number">{{len .Result.Failures}}</td></tr>
+<tr><th>Downloaded</th><td class="number">{{bytes .Result.Bytes}}</td></tr>
+<tr><th>Time</th><td class="number">{{duration .Result.Duration}}</td></tr>
+</table>
+
+<h2>All runs</h2>
+<table>
+<tr><th>Runs</th><td class="number">{{.Lifetime.Runs}}</td></tr>
+<tr><th>First run</th><td class="number">{{date .Lifetime.FirstRun}}</td></tr>
+<tr><th>Last run without errors</th><td class="number">{{date .Lifetime.LastComplete}}</td></tr>
+<tr><th>Files downloaded</th><td class="number">{{.Lifetime.Downloaded}}</td></tr>
+<tr><th>Downloaded</th><td class="number">{{bytes .Lifetime.Bytes}}</td></tr>
+</table>
+
+<h2>Downloaded per day</h2>
+<div class="chart">{{range .Days}}<div style="height: {{.Height}}%" title="{{.Day}}: {{bytes .Bytes}}"></div>{{end}}</div>
+<div class="axis">{{with index .Days 0}}<span>{{.Day}}</span>{{end}}<span>today</span></div>
+
+{{if .Failures}}<h2>Failed items</h2>
+<p>They are downloaded again by the next run.</p>
+<table>
+<tr><th>Photo</th><th>File</th><th>Error</th></tr>
+{{range .Failures}}<tr><td>{{if .ProductURL}}<a href="{{.ProductURL}}">{{.ItemID}}</a>{{else}}{{.ItemID}}{{end}}</td><td>{{.Path}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+//writeHTMLReport writes the HTML report of the run and of the lifetime totals to the backup
+//folder, runErr is the error the run stopped with
+func writeHTMLReport(r *Result, runErr error) error {
+	l, err := ReadLifetime()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	out := htmlReport{
+		Generated: now.Format("Mon 2 Jan 2006 15:04"),
+		Folder:    Options.BackupFolder,
+		Result:    r,
+		Lifetime:  l,
+		Failures:  make([]htmlFailure, 0, len(r.Failures)),
+	}
+	switch {
+	case runErr != nil && len(r.Failures) == 0:
+		out.Status = "The last backup failed: " + runErr.Error()
+	case len(r.Failures) > 0:
+		out.Status = "The last backup completed, but some photos could not be downloaded"
+	default:
+		out.Status = "The backup is up to date"
+		out.OK = true
+	}
+	var busiest uint64
+	for i := chartDays - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(dayFormat)
+		out.Days = append(out.Days, htmlDay{Day: day, Bytes: l.Days[day]})
+		if l.Days[day] > busiest {
+			busiest = l.Days[day]
+		}
+	}
+	for i := range out.Days {
+		if busiest > 0 {
+			out.Days[i].Height = int(out.Days[i].Bytes * 100 / busiest)
+		}
+	}
+	for _, f := range r.Failures {
+		path := f.Path
+		if rel, err := filepath.Rel(Options.BackupFolder, f.Path); err == nil {
+			path = rel
+		}
+		out.Failures = append(out.Failures, htmlFailure{ItemID: f.ItemID, Path: path, ProductURL: f.ProductURL, Error: f.Err.Error()})
+	}
+	var buf bytes.Buffer
+	err = htmlTemplate.Execute(&buf, out)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(Options.BackupFolder, HTMLReportName), buf.Bytes())
+}
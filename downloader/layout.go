@@ -0,0 +1,219 @@
+package downloader
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//archive layouts
+const (
+	//LayoutDate is [year]/[month]/[day]_[last 8 characters of the ID], the full ID is used
+	//instead when 2 items of a day end with the same 8 characters
+	LayoutDate = "date"
+	//LayoutHash is the legacy layout, folders from the MD5 hash of the item ID
+	LayoutHash = "hash"
+)
+
+//layoutFields are the placeholders of layout templates
+var layoutFields = []string{"{year}", "{month}", "{mm}", "{day}", "{dd}", "{id}", "{id8}", "{filename}"}
+
+//claims are the file names given during the run, to the item ID using them. names are
+//compared ignoring case, as the archive can be copied to a case insensitive filesystem
+var claims = struct {
+	sync.Mutex
+	owners map[string]string
+	//sidecars are the sidecars already in the archive folders seen during the run, by lower case name
+	sidecars map[string]map[string]string
+}{owners: make(map[string]string), sidecars: make(map[string]map[string]string)}
+
+//resetClaims forgets the names given by a previous run
+func resetClaims() {
+	claims.Lock()
+	claims.owners = make(map[string]string)
+	claims.sidecars = make(map[string]map[string]string)
+	claims.Unlock()
+}
+
+//claim reserves name for the item with id, it fails if another item of the run or a sidecar
+//already in the archive uses it, or the same name with a different case
+func claim(name string, id string) bool {
+	key := strings.ToLower(name)
+	claims.Lock()
+	defer claims.Unlock()
+	if owner, ok := claims.owners[key]; ok {
+		return owner == id
+	}
+	if sidecar, ok := folderSidecars(filepath.Dir(name))[key]; ok {
+		if owner := sidecarID(sidecar); owner != "" && owner != id {
+			claims.owners[key] = owner
+			return false
+		}
+	}
+	claims.owners[key] = id
+	return true
+}
+
+//folderSidecars returns the sidecars of folder by lower case name without the .json extension.
+//folders are listed once, claims must be locked
+func folderSidecars(folder string) map[string]string {
+	sidecars, ok := claims.sidecars[folder]
+	if ok {
+		return sidecars
+	}
+	sidecars = make(map[string]string)
+	files, _ := ioutil.ReadDir(folder)
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+			path := filepath.Join(folder, f.Name())
+			sidecars[strings.ToLower(strings.TrimSuffix(path, ".json"))] = path
+		}
+	}
+	claims.sidecars[folder] = sidecars
+	return sidecars
+}
+
+//sidecarID returns the item ID of a sidecar, or an empty string if there is none
+func sidecarID(fileName string) string {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return ""
+	}
+	item := &photos.MediaItem{}
+	if json.Unmarshal(data, item) != nil {
+		return ""
+	}
+	return item.ID
+}
+
+//uniqueFileName returns the name of item with template. if another item already uses the name,
+//the full ID is used instead of {id8}, and if it still collides (IDs only differing by case)
+//a lower case hash of the ID is added
+func uniqueFileName(folder string, item *photos.MediaItem, template string) (string, error) {
+	name, err := getFileNameByTemplate(folder, item, template)
+	if err != nil || claim(name, item.ID) {
+		return name, err
+	}
+	unique := name
+	if strings.Contains(template, "{id8}") {
+		unique, err = getFileNameByTemplate(folder, item, strings.Replace(template, "{id8}", "{id}", -1))
+		if err != nil {
+			return "", err
+		}
+	}
+	if unique == name || !claim(unique, item.ID) {
+		hash := md5.Sum([]byte(item.ID))
+		unique += "_" + hex.EncodeToString(hash[:4])
+		claim(unique, item.ID)
+	}
+	log.Printf("'%v' is used by another item, saving %v as '%v'", name, item.ID, unique)
+	return unique, nil
+}
+
+//CheckLayout validates Options.Layout
+func CheckLayout() error {
+	err := checkFilesystem()
+	if err != nil {
+		return err
+	}
+	err = checkNormalize()
+	if err != nil {
+		return err
+	}
+	err = checkTimezone()
+	if err != nil {
+		return err
+	}
+	switch Options.Layout {
+	case "", LayoutDate, LayoutHash:
+		return nil
+	}
+	if !strings.Contains(Options.Layout, "{id") {
+		return fmt.Errorf("Layout '%v' must include {id} or {id8} to keep names unique", Options.Layout)
+	}
+	rest := Options.Layout
+	for _, f := range layoutFields {
+		rest = strings.Replace(rest, f, "", -1)
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("Unknown field in layout '%v', use %v", Options.Layout, strings.Join(layoutFields, " "))
+	}
+	return nil
+}
+
+//maxFilenameLength is the longest {filename} of a layout, in characters
+const maxFilenameLength = 100
+
+//windowsMaxPath is the longest path most Windows programs can open (MAX_PATH without the NUL)
+const windowsMaxPath = 259
+
+//suffixRoom is the room kept after a name for what is added to it, such as a disambiguating
+//hash and the .motion.mp4 extension
+const suffixRoom = 24
+
+//getFileNameByTemplate names item with a layout template such as {year}/{mm}/{dd}_{id8}.
+//{filename} is the original file name without its extension, sanitized for Options.Filesystem
+//and shortened so the path fits in windowsMaxPath on Windows. dates are in Options.Timezone.
+//the name is normalized to Options.Normalize
+func getFileNameByTemplate(folder string, item *photos.MediaItem, template string) (string, error) {
+	t, err := itemTime(item)
+	if err != nil {
+		return "", err
+	}
+	t = t.In(folderZone)
+	filename := shorten(sanitize(strings.TrimSuffix(item.Filename, filepath.Ext(item.Filename))), maxFilenameLength)
+	fileName := expand(folder, item, t, template, filename)
+	if Options.Filesystem != FilesystemPosix && strings.Contains(template, "{filename}") {
+		excess := len([]rune(fileName)) + suffixRoom - windowsMaxPath
+		if excess > 0 {
+			fileName = expand(folder, item, t, template, shorten(filename, len([]rune(filename))-excess))
+		}
+	}
+	return fileName, nil
+}
+
+//shorten keeps the first max characters of name, without trailing dots and spaces
+func shorten(name string, max int) string {
+	runes := []rune(name)
+	if len(runes) <= max {
+		return name
+	}
+	if max < 1 {
+		return "_"
+	}
+	name = strings.TrimRight(string(runes[:max]), ". ")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+//expand replaces the fields of template with the values of item
+func expand(folder string, item *photos.MediaItem, t time.Time, template string, filename string) string {
+	name := strings.NewReplacer(
+		"{year}", fmt.Sprint(t.Year()),
+		"{month}", t.Month().String(),
+		"{mm}", fmt.Sprintf("%02d", t.Month()),
+		"{day}", fmt.Sprint(t.Day()),
+		"{dd}", fmt.Sprintf("%02d", t.Day()),
+		"{id8}", item.ID[len(item.ID)-8:],
+		"{id}", item.ID,
+		"{filename}", filename,
+	).Replace(template)
+	return filepath.Join(folder, filepath.FromSlash(normalize(name)))
+}
+
+//ItemFileNames returns the media and the sidecar file names of item in the backup folder
+//(or a sub folder of it, such as the partner folder) with the current layout
+func ItemFileNames(folder string, item *photos.MediaItem) (string, string) {
+	return getItemFileNames(folder, item)
+}
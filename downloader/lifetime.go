@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+//lifetimeName is the state file of the totals of all runs
+const lifetimeName = "lifetime.json"
+
+//lifetimeDays is the number of days Lifetime.Days are kept for
+const lifetimeDays = 90
+
+//dayFormat is the format of the days of Lifetime.Days
+const dayFormat = "2006-01-02"
+
+//Lifetime are the totals of all runs into a backup folder
+type Lifetime struct {
+	//Runs is the number of runs
+	Runs int `json:"runs"`
+	//Downloaded is the number of files downloaded
+	Downloaded int `json:"downloaded"`
+	//Bytes is the number of bytes downloaded
+	Bytes uint64 `json:"bytes"`
+	//Seconds is the time taken by the runs
+	Seconds float64 `json:"seconds"`
+	//Failures is the number of failed item downloads
+	Failures int `json:"failures"`
+	//FirstRun is when the first run started
+	FirstRun time.Time `json:"firstRun"`
+	//LastRun is when the last run started
+	LastRun time.Time `json:"lastRun"`
+	//LastComplete is when the last run without errors started, zero if there was none
+	LastComplete time.Time `json:"lastComplete"`
+	//LastProcessed is the number of items processed by the last run
+	LastProcessed int `json:"lastProcessed"`
+	//LastExpected is the estimated number of items of the last run, 0 if unknown
+	LastExpected int `json:"lastExpected,omitempty"`
+	//Days are the bytes downloaded by the runs started on every day (2006-01-02, local time) of
+	//the last lifetimeDays days
+	Days map[string]uint64 `json:"days,omitempty"`
+}
+
+//ReadLifetime reads the totals of the runs into the backup folder
+func ReadLifetime() (*Lifetime, error) {
+	l := &Lifetime{}
+	err := ReadState(lifetimeName, l)
+	return l, err
+}
+
+//recordRun adds the result of the run to the lifetime totals
+func recordRun(s Snapshot, result *Result, err error) {
+	l, readErr := ReadLifetime()
+	if readErr != nil {
+		log.Printf("Unable to read the lifetime statistics: %v", readErr)
+		return
+	}
+	l.Runs++
+	l.Downloaded += result.Downloaded
+	l.Bytes += result.Bytes
+	l.Seconds += result.Duration.Seconds()
+	l.Failures += len(result.Failures)
+	if l.FirstRun.IsZero() {
+		l.FirstRun = s.Started
+	}
+	l.LastRun = s.Started
+	if err == nil && len(result.Failures) == 0 {
+		l.LastComplete = s.Started
+	}
+	l.LastProcessed = result.Processed
+	l.LastExpected = s.Expected
+	if l.Days == nil {
+		l.Days = make(map[string]uint64)
+	}
+	l.Days[s.Started.Format(dayFormat)] += result.Bytes
+	oldest := s.Started.AddDate(0, 0, -lifetimeDays).Format(dayFormat)
+	for day := range l.Days {
+		if day < oldest {
+			delete(l.Days, day)
+		}
+	}
+	err = WriteState(lifetimeName, l)
+	if err != nil {
+		log.Printf("Unable to save the lifetime statistics: %v", err)
+	}
+}
+
+//Log logs the lifetime totals
+func (l *Lifetime) Log() {
+	if l.Runs == 0 {
+		log.Println("No run recorded in this folder yet")
+		return
+	}
+	log.Printf("Runs: %v, since %v", l.Runs, l.FirstRun.Format(time.RFC1123))
+	log.Printf("Downloaded: %v files, Total Size: %v, Failures: %v", l.Downloaded, humanize.Bytes(l.Bytes), l.Failures)
+	last := ""
+	if l.LastExpected > 0 {
+		last = fmt.Sprintf(" of %v", l.LastExpected)
+	}
+	log.Printf("Last run: %v (%v), processed %v%v items", l.LastRun.Format(time.RFC1123), humanize.Time(l.LastRun), l.LastProcessed, last)
+	if l.LastComplete.IsZero() {
+		log.Println("Last run without errors: never")
+	} else {
+		log.Printf("Last run without errors: %v (%v)", l.LastComplete.Format(time.RFC1123), humanize.Time(l.LastComplete))
+	}
+}
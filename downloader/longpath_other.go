@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package downloader
+
+//longPathFolder returns folder, paths are only limited to 260 characters on Windows
+func longPathFolder(folder string) string {
+	return folder
+}
@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package downloader
+
+import (
+	"log"
+	"path/filepath"
+)
+
+//longPathFolder makes folder absolute: the os package only uses the \\?\ prefix, which lifts the
+//260 characters limit of paths, for absolute paths
+func longPathFolder(folder string) string {
+	abs, err := filepath.Abs(folder)
+	if err != nil {
+		log.Printf("Unable to find the absolute path of '%v': %v", folder, err)
+		return folder
+	}
+	return abs
+}
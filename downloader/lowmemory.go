@@ -0,0 +1,46 @@
+package downloader
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	//lowMemoryWorkers is the number of concurrent downloads, albums and shards with Options.LowMemory
+	lowMemoryWorkers = 1
+	//lowMemoryBuffer is the size of the buffer of the downloads with Options.LowMemory, 32KB otherwise
+	lowMemoryBuffer = 8 * 1024
+	//lowMemoryGCPercent makes the garbage collector run when the heap grew by a quarter, not doubled
+	lowMemoryGCPercent = 25
+)
+
+//lowMemoryOnce logs the low memory profile once, for all the runs of a daemon
+var lowMemoryOnce sync.Once
+
+//applyLowMemory sets up the low memory profile of Options.LowMemory
+func applyLowMemory() {
+	if !Options.LowMemory {
+		return
+	}
+	lowMemoryOnce.Do(func() {
+		debug.SetGCPercent(lowMemoryGCPercent)
+		log.Printf("Low memory: %v download at a time, hash index on disk", lowMemoryWorkers)
+	})
+}
+
+//limitWorkers returns workers, limited to lowMemoryWorkers with Options.LowMemory
+func limitWorkers(workers int) int {
+	if Options.LowMemory && workers > lowMemoryWorkers {
+		return lowMemoryWorkers
+	}
+	return workers
+}
+
+//copyBuffer returns the buffer of the downloads, nil for the default of io.CopyBuffer
+func copyBuffer() []byte {
+	if Options.LowMemory {
+		return make([]byte, lowMemoryBuffer)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package downloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//minErrorSample is the number of processed items before a percentage of failures stops the run,
+//so the first failures of a run do not stop it
+const minErrorSample = 20
+
+//errorLimit is the parsed Options.MaxErrors
+type errorLimit struct {
+	//count stops the run after this many failures, 0 for no limit
+	count int
+	//percent stops the run when this percentage of the items failed, 0 for no limit
+	percent float64
+}
+
+//parseMaxErrors parses Options.MaxErrors: a number of failures, or a percentage such as 5%
+func parseMaxErrors() (errorLimit, error) {
+	value := strings.TrimSpace(Options.MaxErrors)
+	if value == "" {
+		return errorLimit{}, nil
+	}
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return errorLimit{}, fmt.Errorf("Invalid max errors '%v', use a number or a percentage such as 5%%", Options.MaxErrors)
+		}
+		return errorLimit{percent: percent}, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return errorLimit{}, fmt.Errorf("Invalid max errors '%v', use a number or a percentage such as 5%%", Options.MaxErrors)
+	}
+	return errorLimit{count: count}, nil
+}
+
+//exceeded returns an error matching ErrTooManyErrors when the failures of the run reached the limit
+func (l errorLimit) exceeded(s Snapshot) error {
+	if l.count > 0 && s.Errors >= l.count {
+		return fmt.Errorf("%w: %v items failed", ErrTooManyErrors, s.Errors)
+	}
+	if l.percent > 0 && s.Total >= minErrorSample && float64(s.Errors)*100 >= l.percent*float64(s.Total) {
+		return fmt.Errorf("%w: %v of %v items failed", ErrTooManyErrors, s.Errors, s.Total)
+	}
+	return nil
+}
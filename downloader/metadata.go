@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"sync"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//metadataName is the state file of the fingerprints of the metadata in the sidecars, by item ID
+const metadataName = "metadata.json"
+
+//metadata are the fingerprints of the sidecars, loaded on first use
+var metadata = struct {
+	sync.Mutex
+	fingerprints map[string]string
+	changed      bool
+}{}
+
+//loadMetadata loads the state file, metadata must be locked
+func loadMetadata() {
+	if metadata.fingerprints != nil {
+		return
+	}
+	metadata.fingerprints = make(map[string]string)
+	err := ReadState(metadataName, &metadata.fingerprints)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", metadataName, err)
+	}
+}
+
+//fingerprint returns the hash of the metadata of item: description, file name, creation time,
+//camera... the base URLs of the item and of the profile picture of its contributor change with
+//every request, they are left out
+func fingerprint(item *photos.MediaItem) string {
+	m := *item
+	m.BaseURL = ""
+	if m.ContributorInfo != nil {
+		contributor := *m.ContributorInfo
+		contributor.ProfilePictureBaseURL = ""
+		m.ContributorInfo = &contributor
+	}
+	data, _ := json.Marshal(&m)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+//sidecarFingerprint returns the fingerprint of the item in the sidecar fileName, from the state
+//file or by reading the sidecar of an archive written before it. with Options.LowMemory the
+//state file is not loaded, the sidecar is always read
+func sidecarFingerprint(id string, fileName string) string {
+	if !Options.LowMemory {
+		metadata.Lock()
+		loadMetadata()
+		fp, ok := metadata.fingerprints[id]
+		metadata.Unlock()
+		if ok {
+			return fp
+		}
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return ""
+	}
+	item := &photos.MediaItem{}
+	if json.Unmarshal(data, item) != nil {
+		return ""
+	}
+	fp := fingerprint(item)
+	setFingerprint(id, fp)
+	return fp
+}
+
+//setFingerprint records the fingerprint of the sidecar of the item id
+func setFingerprint(id string, fp string) {
+	if Options.LowMemory {
+		return
+	}
+	metadata.Lock()
+	defer metadata.Unlock()
+	loadMetadata()
+	if metadata.fingerprints[id] == fp {
+		return
+	}
+	metadata.fingerprints[id] = fp
+	metadata.changed = true
+}
+
+//resetMetadata forgets the fingerprints of a previous run, which may be of another backup folder
+func resetMetadata() {
+	metadata.Lock()
+	metadata.fingerprints = nil
+	metadata.changed = false
+	metadata.Unlock()
+}
+
+//saveMetadata saves the fingerprints of the sidecars written during the run
+func saveMetadata() error {
+	metadata.Lock()
+	defer metadata.Unlock()
+	if !metadata.changed {
+		return nil
+	}
+	metadata.changed = false
+	return WriteState(metadataName, metadata.fingerprints)
+}
@@ -0,0 +1,104 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//checkMirrors checks the mirror folders are not the backup folder nor inside it, and creates them
+func checkMirrors() error {
+	backup, err := filepath.Abs(Options.BackupFolder)
+	if err != nil {
+		return err
+	}
+	for i, mirror := range Options.Mirrors {
+		abs, err := filepath.Abs(mirror)
+		if err != nil {
+			return err
+		}
+		if abs == backup || strings.HasPrefix(abs, backup+string(filepath.Separator)) {
+			return fmt.Errorf("The mirror '%v' can not be in the backup folder", mirror)
+		}
+		Options.Mirrors[i] = longPathFolder(mirror)
+		err = MkdirAll(Options.Mirrors[i])
+		if err != nil {
+			return fmt.Errorf("Unable to create the mirror '%v': %v", mirror, err)
+		}
+	}
+	return nil
+}
+
+//mirrored checks if target is a copy of the file of info, copies get the modification time
+//of the file
+func mirrored(info os.FileInfo, target string) bool {
+	mirror, err := os.Stat(target)
+	return err == nil && mirror.Size() == info.Size() && mirror.ModTime().Equal(info.ModTime())
+}
+
+//copyFile copies fileName of the backup folder to target
+func copyFile(fileName string, info os.FileInfo, target string) error {
+	input, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	err = MkdirAll(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	output, err := createPart(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(limitWrites(output), input)
+	if err != nil {
+		abortFile(output, target)
+	} else {
+		err = commitFile(output, target)
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
+
+//syncMirrors copies the files of an item to every mirror missing them, or having another
+//version. the files are read from the backup folder, so they are downloaded once
+func syncMirrors(item *photos.MediaItem, imageName string, jsonName string) {
+	if len(Options.Mirrors) == 0 {
+		return
+	}
+	files := []string{jsonName, imageName, motionName(imageName)}
+	if jpegName(imageName) != imageName {
+		files = append(files, jpegName(imageName))
+	}
+	for _, fileName := range files {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(Options.BackupFolder, fileName)
+		if err != nil {
+			continue
+		}
+		for _, mirror := range Options.Mirrors {
+			target := filepath.Join(mirror, rel)
+			if mirrored(info, target) {
+				continue
+			}
+			err = copyFile(fileName, info, target)
+			if err != nil {
+				log.Printf("Unable to copy '%v' of %v to the mirror '%v': %v", rel, item.ID, mirror, err)
+				continue
+			}
+			log.Printf("Copied '%v' to the mirror '%v'", rel, mirror)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//MotionSuffix is appended to the base name of a photo for its motion video
+const MotionSuffix = ".motion.mp4"
+
+//motionMarkers are XMP markers of photos with an embedded video
+var motionMarkers = [][]byte{[]byte("MotionPhoto"), []byte("MicroVideo")}
+
+//videoBrands are major brands of the embedded MP4 'ftyp' box
+var videoBrands = map[string]bool{"mp41": true, "mp42": true, "isom": true, "iso2": true, "iso5": true, "avc1": true, "qt  ": true}
+
+//motionName returns the motion video file of the photo in fileName
+func motionName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + MotionSuffix
+}
+
+//embeddedVideo returns the MP4 appended to a motion photo (Pixel, Samsung), or nil
+func embeddedVideo(data []byte) []byte {
+	head := data
+	if len(head) > 128*1024 {
+		head = head[:128*1024]
+	}
+	found := false
+	for _, marker := range motionMarkers {
+		if bytes.Contains(head, marker) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	// the video starts with an ISO BMFF 'ftyp' box, preceded by its 4 bytes size.
+	// HEIC photos start with their own 'ftyp' box, so the start of the file is skipped
+	for offset := 8; offset < len(data); {
+		i := bytes.Index(data[offset:], []byte("ftyp"))
+		if i < 0 {
+			return nil
+		}
+		i += offset
+		if i+8 <= len(data) && videoBrands[string(data[i+4:i+8])] {
+			size := binary.BigEndian.Uint32(data[i-4 : i])
+			if size >= 16 && size <= 64 && size%4 == 0 {
+				return data[i-4:]
+			}
+		}
+		offset = i + 4
+	}
+	return nil
+}
+
+//downloadMotion downloads the video part of a motion photo, returns false if it has none
+func downloadMotion(item *photos.MediaItem, fileName string) (bool, error) {
+	response, err := mediaClient().Get(item.BaseURL + "=dv")
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || !strings.HasPrefix(response.Header.Get("Content-Type"), "video/") {
+		return false, nil
+	}
+	output, err := createPart(fileName)
+	if err != nil {
+		return false, err
+	}
+	n, err := io.Copy(limitWrites(output), response.Body)
+	if err != nil {
+		abortFile(output, fileName)
+		return false, err
+	}
+	err = commitFile(output, fileName)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Downloaded motion video '%v' (%v)", fileName, humanize.Bytes(uint64(n)))
+	stats.totalsize.Add(uint64(n))
+	tallyBytes(item.ID, n)
+	return true, nil
+}
+
+//createMotion saves the video part of a motion photo next to the photo in fileName.
+//the video is extracted from the photo when embedded, otherwise it is requested with the =dv parameter
+func createMotion(item *photos.MediaItem, fileName string) error {
+	name := motionName(fileName)
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	video := embeddedVideo(data)
+	if video != nil {
+		log.Printf("Extracted motion video '%v' (%v)", name, humanize.Bytes(uint64(len(video))))
+		return writeFile(name, video)
+	}
+	_, err = downloadMotion(item, name)
+	if err != nil {
+		os.Remove(name)
+		return fmt.Errorf("Unable to download motion video: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//firstBucketYear is the first yearly bucket, older items are searched in one bucket
+const firstBucketYear = 1990
+
+//Order values
+const (
+	//OrderNewest processes the newest items first
+	OrderNewest = "newest"
+	//OrderOldest processes the oldest items first
+	OrderOldest = "oldest"
+)
+
+//checkOrder validates the Order option
+func checkOrder() error {
+	switch Options.Order {
+	case "", OrderNewest, OrderOldest:
+		return nil
+	}
+	return fmt.Errorf("Invalid order '%v', use newest or oldest", Options.Order)
+}
+
+//dateBuckets returns yearly date ranges covering the whole library, in processing order
+func dateBuckets() []*photos.DateRange {
+	buckets := []*photos.DateRange{{
+		StartDate: &photos.Date{Year: 1, Month: 1, Day: 1},
+		EndDate:   &photos.Date{Year: firstBucketYear - 1, Month: 12, Day: 31},
+	}}
+	for year := firstBucketYear; year <= time.Now().Year()+1; year++ {
+		buckets = append(buckets, &photos.DateRange{
+			StartDate: &photos.Date{Year: year, Month: 1, Day: 1},
+			EndDate:   &photos.Date{Year: year, Month: 12, Day: 31},
+		})
+	}
+	if Options.Order == OrderNewest {
+		for i, j := 0, len(buckets)-1; i < j; i, j = i+1, j-1 {
+			buckets[i], buckets[j] = buckets[j], buckets[i]
+		}
+	}
+	return buckets
+}
+
+//downloadOrdered downloads the library bucket by bucket, in the requested order
+func downloadOrdered(svc photos.Library, seen map[string]bool) (bool, error) {
+	orderBy := "MediaMetadata.creation_time"
+	if Options.Order == OrderNewest {
+		orderBy += " desc"
+	}
+	for _, bucket := range dateBuckets() {
+		filters := searchFilters()
+		if filters == nil {
+			filters = &photos.Filters{}
+		}
+		filters.DateFilter = &photos.DateFilter{Ranges: []*photos.DateRange{bucket}}
+		req := &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), Filters: filters, OrderBy: orderBy}
+		log.Printf("Searching %v to %v", bucket.StartDate.Year, bucket.EndDate.Year)
+		more, err := downloadSearch(svc, req, &pass{folder: Options.BackupFolder}, seen)
+		if err != nil || !more {
+			return more, err
+		}
+	}
+	return true, nil
+}
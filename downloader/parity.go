@@ -0,0 +1,184 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//ParityExtension is the extension of the parity files
+const ParityExtension = ".par2"
+
+//parityBase is the name of the parity files of a folder: parity.par2 and its recovery volumes
+const parityBase = "parity"
+
+//parityName is the state file of the folders whose parity files are out of date
+const parityName = "parity.json"
+
+//par2Path is the par2 used to create the parity files, empty if it is not installed or not enabled
+var par2Path string
+
+//parity are the folders whose parity files are out of date, relative to the backup folder
+var parity = struct {
+	sync.Mutex
+	folders map[string]bool
+}{}
+
+//findPar2 looks for par2 when Options.Parity is set
+func findPar2() {
+	par2Path = ""
+	if Options.Parity <= 0 {
+		return
+	}
+	path, err := exec.LookPath("par2")
+	if err != nil {
+		log.Println("par2 not found, no parity files will be created (install par2cmdline)")
+		return
+	}
+	par2Path = path
+}
+
+//loadParity loads the state file, parity must be locked
+func loadParity() {
+	if parity.folders != nil {
+		return
+	}
+	parity.folders = make(map[string]bool)
+	err := ReadState(parityName, &parity.folders)
+	if err != nil {
+		log.Printf("Ignoring invalid %v: %v", parityName, err)
+	}
+}
+
+//resetParity forgets the folders of a previous run, which may be of another backup folder
+func resetParity() {
+	parity.Lock()
+	parity.folders = nil
+	parity.Unlock()
+}
+
+//markParity records the parity files of the folder of fileName are out of date
+func markParity(fileName string) {
+	if par2Path == "" {
+		return
+	}
+	rel, err := filepath.Rel(Options.BackupFolder, filepath.Dir(fileName))
+	if err != nil {
+		return
+	}
+	parity.Lock()
+	defer parity.Unlock()
+	loadParity()
+	parity.folders[filepath.ToSlash(rel)] = true
+}
+
+//isParityFile checks if name is a parity file of gitmoo-goog
+func isParityFile(name string) bool {
+	return strings.HasPrefix(name, parityBase+".") && strings.HasSuffix(name, ParityExtension)
+}
+
+//createParity replaces the parity files of folder with new ones for all its files
+func createParity(folder string) error {
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if isParityFile(name) {
+			err = os.Remove(filepath.Join(folder, name))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if e.IsDir() || e.Size() == 0 || ext == ".part" || ext == ".tmp" {
+			continue
+		}
+		files = append(files, name)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	sort.Strings(files)
+	args := append([]string{"create", "-q", "-q", fmt.Sprintf("-r%v", Options.Parity), "--", parityBase + ParityExtension}, files...)
+	var stderr bytes.Buffer
+	cmd := exec.Command(par2Path, args...)
+	cmd.Dir = folder
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("par2: %v %v", err, strings.TrimSpace(stderr.String()))
+	}
+	log.Printf("Created the parity files of '%v' (%v files)", folder, len(files))
+	return nil
+}
+
+//updateParity creates the parity files of the folders changed by this run and the previous ones
+func updateParity() error {
+	parity.Lock()
+	defer parity.Unlock()
+	loadParity()
+	if len(parity.folders) == 0 {
+		return nil
+	}
+	for rel := range parity.folders {
+		err := createParity(filepath.Join(Options.BackupFolder, filepath.FromSlash(rel)))
+		if err != nil {
+			log.Printf("Unable to create the parity files of '%v': %v", rel, err)
+			continue
+		}
+		delete(parity.folders, rel)
+	}
+	err := WriteState(parityName, parity.folders)
+	parity.folders = nil
+	return err
+}
+
+//VerifyParity checks the files of every folder of the backup folder with parity files, it
+//returns the folders with damaged or missing files
+func VerifyParity() ([]string, error) {
+	path, err := exec.LookPath("par2")
+	if err != nil {
+		return nil, fmt.Errorf("par2 not found (install par2cmdline)")
+	}
+	folder := Options.BackupFolder
+	if folder == "" {
+		folder = "."
+	}
+	var damaged []string
+	checked := 0
+	err = filepath.Walk(folder, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != parityBase+ParityExtension {
+			return nil
+		}
+		checked++
+		cmd := exec.Command(path, "verify", "-q", "-q", info.Name())
+		cmd.Dir = filepath.Dir(p)
+		if cmd.Run() != nil {
+			log.Printf("'%v' has damaged or missing files, repair them with: par2 repair %v", filepath.Dir(p), p)
+			damaged = append(damaged, filepath.Dir(p))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Verified %v folders, %v damaged", checked, len(damaged))
+	if len(damaged) > 0 {
+		return damaged, fmt.Errorf("%v folders have damaged or missing files", len(damaged))
+	}
+	return damaged, nil
+}
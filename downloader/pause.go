@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"log"
+	"sync"
+)
+
+//pausing holds the workers between items while the downloads are paused. the searches stop
+//once the queue is full, so a resumed run continues where it was
+var pausing = struct {
+	sync.Mutex
+	paused bool
+	//resumed is closed by Resume
+	resumed chan struct{}
+}{}
+
+//Pause pauses the downloads: the items being downloaded are finished and the next ones wait
+//for Resume. it returns false if the downloads were already paused
+func Pause() bool {
+	pausing.Lock()
+	defer pausing.Unlock()
+	if pausing.paused {
+		return false
+	}
+	pausing.paused = true
+	pausing.resumed = make(chan struct{})
+	log.Println("Pausing the downloads, the items being downloaded are finished first")
+	return true
+}
+
+//Resume resumes paused downloads, it returns false if they were not paused
+func Resume() bool {
+	pausing.Lock()
+	defer pausing.Unlock()
+	if !pausing.paused {
+		return false
+	}
+	pausing.paused = false
+	close(pausing.resumed)
+	log.Println("Resuming the downloads")
+	return true
+}
+
+//Paused checks if the downloads are paused
+func Paused() bool {
+	pausing.Lock()
+	defer pausing.Unlock()
+	return pausing.paused
+}
+
+//waitResumed waits while the downloads are paused, or until stop is closed
+func waitResumed(stop <-chan struct{}) {
+	pausing.Lock()
+	paused, resumed := pausing.paused, pausing.resumed
+	pausing.Unlock()
+	if !paused {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-stop:
+	}
+}
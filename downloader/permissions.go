@@ -0,0 +1,119 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//modes of the archive files when Options.DirMode and Options.FileMode are not set, the umask applies
+const (
+	defaultDirMode  os.FileMode = 0700
+	defaultFileMode os.FileMode = 0644
+)
+
+//parseOwner parses Options.Owner, uid:gid or uid. -1 is returned for an unset id
+func parseOwner() (int, int, error) {
+	if Options.Owner == "" {
+		return -1, -1, nil
+	}
+	if runtime.GOOS == "windows" {
+		return -1, -1, fmt.Errorf("Owner is not supported on Windows")
+	}
+	parts := strings.SplitN(Options.Owner, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil || uid < 0 {
+		return -1, -1, fmt.Errorf("Invalid owner '%v', use uid:gid such as 1000:1000", Options.Owner)
+	}
+	gid := -1
+	if len(parts) == 2 {
+		gid, err = strconv.Atoi(parts[1])
+		if err != nil || gid < 0 {
+			return -1, -1, fmt.Errorf("Invalid owner '%v', use uid:gid such as 1000:1000", Options.Owner)
+		}
+	}
+	return uid, gid, nil
+}
+
+//setOwnership applies mode, bypassing the umask, if it was configured and Options.Owner to path
+func setOwnership(path string, mode os.FileMode, configured bool) error {
+	if configured {
+		err := os.Chmod(path, mode)
+		if err != nil {
+			return err
+		}
+	}
+	uid, gid, err := parseOwner()
+	if err != nil || uid == -1 {
+		return err
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+func dirMode() os.FileMode {
+	if Options.DirMode == 0 {
+		return defaultDirMode
+	}
+	return Options.DirMode
+}
+
+func fileMode() os.FileMode {
+	if Options.FileMode == 0 {
+		return defaultFileMode
+	}
+	return Options.FileMode
+}
+
+//MkdirAll creates folder and its missing parents with Options.DirMode and Options.Owner
+func MkdirAll(folder string) error {
+	var created []string
+	for dir := folder; dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		created = append(created, dir)
+	}
+	err := os.MkdirAll(folder, dirMode())
+	if err != nil {
+		return err
+	}
+	for _, dir := range created {
+		err = setOwnership(dir, dirMode(), Options.DirMode != 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//writeFile writes a file of the archive with Options.FileMode and Options.Owner, and flushes it
+//with Options.Fsync
+func writeFile(fileName string, data []byte) error {
+	file, err := createPart(fileName)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err != nil {
+		abortFile(file, fileName)
+		return err
+	}
+	return commitFile(file, fileName)
+}
+
+//createFile creates or truncates a file of the archive with Options.FileMode and Options.Owner
+func createFile(fileName string) (*os.File, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileMode())
+	if err != nil {
+		return nil, err
+	}
+	err = setOwnership(fileName, fileMode(), Options.FileMode != 0)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,255 @@
+package downloader
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//job is an item queued for download
+type job struct {
+	item   *photos.MediaItem
+	folder string
+}
+
+//pipeline downloads the items found by the searches with Options.Workers workers.
+//the queue is bounded, so a search blocks when the workers are busy and memory stays flat
+//whatever the page size and the number of workers
+type pipeline struct {
+	svc  photos.Library
+	jobs chan job
+	wg   sync.WaitGroup
+	//stop is closed when a worker hit an error that ends the run
+	stop     chan struct{}
+	stopOnce sync.Once
+	//closed is closed when no more items are queued
+	closed chan struct{}
+	//abort is the error of halt, which Stop calls outside the workers
+	abort   error
+	abortMu sync.Mutex
+	//failed are the errors of the items that failed to download
+	failed   ItemErrors
+	failedMu sync.Mutex
+	//limit stops the run when too many items failed
+	limit errorLimit
+	//hooks are the hooks of the Downloader of the run, nil for DownloadAll
+	hooks *Hooks
+	//active are the items being downloaded, by worker
+	active   []*photos.MediaItem
+	activeMu sync.Mutex
+}
+
+//work is the pipeline of the current run
+var work *pipeline
+
+//stopping holds the stop request of Stop, for the run in progress and the next ones
+var stopping = struct {
+	sync.Mutex
+	requested bool
+	//running is the pipeline of the run in progress, nil between runs
+	running *pipeline
+	//done is closed by Stop, for the waits outside the pipeline
+	done chan struct{}
+}{done: make(chan struct{})}
+
+//Stop stops the run in progress like Options.MaxErrors does: the items being downloaded are
+//finished, the state is saved and DownloadAll returns ErrStopped. later runs return it right away
+func Stop() {
+	stopping.Lock()
+	defer stopping.Unlock()
+	if !stopping.requested {
+		close(stopping.done)
+	}
+	stopping.requested = true
+	if stopping.running != nil {
+		log.Println("Stopping the run, the items being downloaded are finished first")
+		stopping.running.halt(ErrStopped)
+	}
+}
+
+//stopRequested checks if Stop was called
+func stopRequested() bool {
+	stopping.Lock()
+	defer stopping.Unlock()
+	return stopping.requested
+}
+
+//stopped returns a channel closed by Stop
+func stopped() <-chan struct{} {
+	return stopping.done
+}
+
+//setRunning records the pipeline of the run in progress, nil once it finished. it is halted
+//at once if Stop was called meanwhile
+func setRunning(p *pipeline) {
+	stopping.Lock()
+	defer stopping.Unlock()
+	stopping.running = p
+	if p != nil && stopping.requested {
+		p.halt(ErrStopped)
+	}
+}
+
+//startPipeline starts the download workers
+func startPipeline(svc photos.Library, limit errorLimit, hooks *Hooks) *pipeline {
+	workers := maxWorkers()
+	if workers < 1 {
+		workers = 1
+	}
+	p := &pipeline{
+		svc:    svc,
+		limit:  limit,
+		hooks:  hooks,
+		jobs:   make(chan job, workers),
+		stop:   make(chan struct{}),
+		closed: make(chan struct{}),
+		active: make([]*photos.MediaItem, workers),
+	}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.worker(i)
+	}
+	return p
+}
+
+//add queues an item, returns false if the run was stopped
+func (p *pipeline) add(m *photos.MediaItem, folder string) bool {
+	select {
+	case <-p.stop:
+		return false
+	default:
+	}
+	select {
+	case p.jobs <- job{item: m, folder: folder}:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+func (p *pipeline) worker(slot int) {
+	defer p.wg.Done()
+	for {
+		p.waitTurn(slot)
+		waitResumed(p.stop)
+		j, ok := <-p.jobs
+		if !ok {
+			return
+		}
+		select {
+		case <-p.stop:
+			continue
+		default:
+		}
+		breaker.wait(p.stop)
+		select {
+		case <-p.stop:
+			continue
+		default:
+		}
+		p.setActive(slot, j.item)
+		p.download(j)
+		p.setActive(slot, nil)
+	}
+}
+
+//waitTurn waits while the schedule or the tuning allow fewer workers than slot. the workers
+//help finishing the queue once the searches are done, or the run stopped
+func (p *pipeline) waitTurn(slot int) {
+	for slot > 0 && slot >= tuning.limit(scheduledWorkers()) {
+		select {
+		case <-p.stop:
+			return
+		case <-p.closed:
+			return
+		case <-time.After(scheduleCheck):
+		}
+	}
+}
+
+//setActive records the item the worker in slot is downloading, nil when idle
+func (p *pipeline) setActive(slot int, m *photos.MediaItem) {
+	p.activeMu.Lock()
+	p.active[slot] = m
+	p.activeMu.Unlock()
+}
+
+//activeItems returns the item of every worker, nil for idle workers
+func (p *pipeline) activeItems() []*photos.MediaItem {
+	p.activeMu.Lock()
+	defer p.activeMu.Unlock()
+	return append([]*photos.MediaItem(nil), p.active...)
+}
+
+//lastFailures returns the last n failures
+func (p *pipeline) lastFailures(n int) ItemErrors {
+	p.failedMu.Lock()
+	defer p.failedMu.Unlock()
+	if len(p.failed) > n {
+		return append(ItemErrors(nil), p.failed[len(p.failed)-n:]...)
+	}
+	return append(ItemErrors(nil), p.failed...)
+}
+
+//download downloads one item and records the outcome
+func (p *pipeline) download(j job) {
+	m := j.item
+	emit(Event{Type: ItemStarted, Item: m})
+	err := downloadItem(p.svc, m, j.folder)
+	if errors.Is(err, ErrItemSkipped) {
+		log.Printf("Skipping %v: %v", m.ID, errors.Unwrap(err))
+		stats.total.Add(-1)
+		stats.skipped.Add(1)
+		tallySkipped(m.ID)
+		emit(Event{Type: ItemSkipped, Item: m, Err: err})
+		return
+	}
+	if IsDiskFull(err) {
+		p.halt(err)
+	} else if err != nil {
+		log.Println(err)
+		breaker.failure(err)
+		tuning.failure(err)
+		stats.errors.Add(1)
+		tallyFailed(m.ID)
+		var failure *DownloadError
+		if errors.As(err, &failure) {
+			p.failedMu.Lock()
+			p.failed = append(p.failed, failure)
+			p.failedMu.Unlock()
+			recordFailure(failure)
+		}
+		limitErr := p.limit.exceeded(stats.snapshot())
+		if limitErr != nil {
+			p.halt(limitErr)
+		}
+	}
+	if err == nil {
+		breaker.success()
+		clearFailure(m.ID)
+	}
+	emit(Event{Type: ItemFinished, Item: m, Err: err})
+}
+
+//halt stops the run with err, the downloads in progress are finished
+func (p *pipeline) halt(err error) {
+	p.stopOnce.Do(func() {
+		p.abortMu.Lock()
+		p.abort = err
+		p.abortMu.Unlock()
+		close(p.stop)
+	})
+}
+
+//finish waits for the queued downloads, returns the error that stopped the run, if any
+func (p *pipeline) finish() error {
+	close(p.closed)
+	close(p.jobs)
+	p.wg.Wait()
+	p.abortMu.Lock()
+	defer p.abortMu.Unlock()
+	return p.abort
+}
@@ -0,0 +1,209 @@
+package downloader
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//planSpeed is the download speed assumed by Plan before a run measured one, in bytes per second
+const planSpeed = 5e6
+
+//bytes per pixel of the estimated file sizes, the API does not return the size of the files
+const (
+	jpegBytesPerPixel  = 0.3
+	heicBytesPerPixel  = 0.15
+	rawBytesPerPixel   = 1.5
+	otherBytesPerPixel = 1.0
+	//videoBytesPerPixel is per pixel of a frame, for a video of about a minute
+	videoBytesPerPixel = 25.0
+)
+
+//PlanReport is the estimate of a run, from the metadata of the items
+type PlanReport struct {
+	//Items is the number of items the run would process
+	Items  int
+	Photos int
+	Videos int
+	//Skipped is the number of items left out by the filters
+	Skipped int
+	//Present is the number of items already in the backup folder
+	Present int
+	//Bytes is the estimated size of the items to download
+	Bytes uint64
+	//Calls is the number of API calls to list the items
+	Calls int
+	//Listing is the time spent waiting between API calls (-throttle)
+	Listing time.Duration
+	//Downloading is the estimated time to download Bytes
+	Downloading time.Duration
+	//Speed is the download speed of the estimate, in bytes per second
+	Speed float64
+	//Measured is true when Speed was measured by the previous runs
+	Measured bool
+}
+
+//maxDimension returns the max width and height of the downloaded photos, 0 for the original size
+func maxDimension() int64 {
+	switch {
+	case Options.Quality == "high":
+		return highQualitySize
+	case strings.HasPrefix(Options.Quality, "w"):
+		size, _ := strconv.Atoi(Options.Quality[1:])
+		return int64(size)
+	}
+	return 0
+}
+
+//estimateSize returns the estimated size of the media of item
+func estimateSize(item *photos.MediaItem) uint64 {
+	if item.MediaMetadata == nil {
+		return 0
+	}
+	w, h := float64(item.MediaMetadata.Width), float64(item.MediaMetadata.Height)
+	if item.MediaMetadata.Video != nil {
+		return uint64(w * h * videoBytesPerPixel)
+	}
+	max := float64(maxDimension())
+	if max > 0 && (w > max || h > max) {
+		scale := max / w
+		if h > w {
+			scale = max / h
+		}
+		w, h = w*scale, h*scale
+	}
+	perPixel := otherBytesPerPixel
+	switch {
+	case isRaw(item):
+		perPixel = rawBytesPerPixel
+	case isHEIC(item):
+		perPixel = heicBytesPerPixel
+	case item.MimeType == "image/jpeg":
+		perPixel = jpegBytesPerPixel
+	}
+	return uint64(w * h * perPixel)
+}
+
+//Plan lists the library (or the albums of Options.AlbumIDs) without downloading, to estimate
+//the items, bytes, API calls and time of a run
+func Plan(svc photos.Library) (*PlanReport, error) {
+	resetClaims()
+	_, err := imageSuffix()
+	if err != nil {
+		return nil, err
+	}
+	err = checkFilters()
+	if err != nil {
+		return nil, err
+	}
+	err = CheckLayout()
+	if err != nil {
+		return nil, err
+	}
+	err = checkEnumerate()
+	if err != nil {
+		return nil, err
+	}
+	if Options.Enumerate == EnumerateList {
+		svc = listLibrary{svc}
+	}
+	r := &PlanReport{Speed: planSpeed}
+	seen := make(map[string]bool)
+	if len(Options.AlbumIDs) > 0 {
+		for _, id := range Options.AlbumIDs {
+			r.Calls++
+			_, err = svc.GetAlbum(id)
+			if err != nil {
+				return nil, err
+			}
+			err = r.walk(svc, &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), AlbumID: id}, seen)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		err = r.walk(svc, &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), Filters: searchFilters()}, seen)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.Listing = time.Duration(r.Calls) * time.Second * time.Duration(Options.Throttle)
+	lifetime, err := ReadLifetime()
+	if err == nil && lifetime.Bytes > 0 && lifetime.Seconds > 0 {
+		r.Speed = float64(lifetime.Bytes) / lifetime.Seconds
+		r.Measured = true
+	}
+	r.Downloading = time.Duration(float64(r.Bytes) / r.Speed * float64(time.Second))
+	return r, nil
+}
+
+//walk adds the items returned by req to the estimate
+func (r *PlanReport) walk(svc photos.Library, req *photos.SearchMediaItemsRequest, seen map[string]bool) error {
+	for {
+		time.Sleep(time.Duration(time.Second * time.Duration(Options.Throttle)))
+		r.Calls++
+		items, err := svc.SearchMediaItems(req)
+		if err != nil {
+			return err
+		}
+		for _, m := range items.MediaItems {
+			if seen[m.ID] {
+				continue
+			}
+			seen[m.ID] = true
+			r.add(m)
+		}
+		log.Printf("Planning: %v items", r.Items+r.Skipped)
+		req.PageToken = items.NextPageToken
+		if req.PageToken == "" {
+			return nil
+		}
+	}
+}
+
+//add adds an item to the estimate
+func (r *PlanReport) add(m *photos.MediaItem) {
+	if skipReason(m) != "" {
+		r.Skipped++
+		return
+	}
+	if r.Items >= Options.MaxItems {
+		return
+	}
+	r.Items++
+	if m.MediaMetadata != nil && m.MediaMetadata.Video != nil {
+		r.Videos++
+	} else {
+		r.Photos++
+	}
+	imageName, _ := getItemFileNames(Options.BackupFolder, m)
+	_, err := os.Stat(imageName)
+	if err == nil || Options.CAS != "" && stored(imageName) {
+		r.Present++
+		return
+	}
+	r.Bytes += estimateSize(m)
+}
+
+//Log logs the estimate
+func (r *PlanReport) Log() {
+	log.Printf("Items: %v (%v photos, %v videos), Skipped by the filters: %v", r.Items, r.Photos, r.Videos, r.Skipped)
+	log.Printf("Already in the backup folder: %v, To download: %v (about %v)", r.Present, r.Items-r.Present, humanize.Bytes(r.Bytes))
+	log.Printf("API calls: %v, waiting %v between them (-throttle)", r.Calls, r.Listing.Round(time.Second))
+	speed := "assumed"
+	if r.Measured {
+		speed = "measured by the previous runs"
+	}
+	log.Printf("Download time: about %v at %v/s (%v)", r.Downloading.Round(time.Minute), humanize.Bytes(uint64(r.Speed)), speed)
+	//the next page is listed while the items of the current one are downloaded
+	total := r.Listing
+	if r.Downloading > total {
+		total = r.Downloading
+	}
+	log.Printf("Estimated run time: about %v", total.Round(time.Minute))
+}
@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//ffprobePath is the ffprobe used to check videos, empty if it is not installed or not enabled
+var ffprobePath string
+
+//probeResult is the part of the ffprobe json output that is checked
+type probeResult struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		Width     int64  `json:"width"`
+		Height    int64  `json:"height"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+//findProbe looks for ffprobe when Options.Probe is set
+func findProbe() {
+	ffprobePath = ""
+	if !Options.Probe {
+		return
+	}
+	path, err := exec.LookPath("ffprobe")
+	if err != nil {
+		log.Println("ffprobe not found, videos will not be checked (install FFmpeg)")
+		return
+	}
+	ffprobePath = path
+}
+
+//probeVideo checks with ffprobe that the video in fileName is complete: it must be readable
+//without errors, have a positive duration and a video stream of the item size
+func probeVideo(item *photos.MediaItem, fileName string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(ffprobePath, "-v", "error", "-show_entries", "format=duration:stream=codec_type,width,height", "-of", "json", fileName)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil || stderr.Len() > 0 {
+		return invalidError(fmt.Sprintf("Invalid video: ffprobe: %v", strings.TrimSpace(stderr.String())))
+	}
+	result := probeResult{}
+	err = json.Unmarshal(stdout.Bytes(), &result)
+	if err != nil {
+		return fmt.Errorf("Unable to parse ffprobe output: %v", err)
+	}
+	duration, _ := strconv.ParseFloat(result.Format.Duration, 64)
+	if duration <= 0 {
+		return invalidError("Invalid video: no duration")
+	}
+	width, height := item.MediaMetadata.Width, item.MediaMetadata.Height
+	for _, s := range result.Streams {
+		if s.CodecType != "video" {
+			continue
+		}
+		//rotated videos report swapped dimensions
+		if width == 0 || s.Width == width && s.Height == height || s.Width == height && s.Height == width {
+			return nil
+		}
+		return invalidError(fmt.Sprintf("Invalid video: %vx%v, expected %vx%v", s.Width, s.Height, width, height))
+	}
+	return invalidError("Invalid video: no video stream")
+}
@@ -0,0 +1,65 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//progressLine returns the periodic progress log line
+func progressLine() string {
+	s := stats.snapshot()
+	line := fmt.Sprintf("Processed: %v, Downloaded: %v, Skipped: %v, Errors: %v, Total Size: %v",
+		s.Total, s.Downloaded, s.Skipped, s.Errors, humanize.Bytes(s.TotalSize))
+	rate := speedLine()
+	if rate != "" {
+		line += ", " + rate
+	}
+	eta := estimate(s)
+	if eta != "" {
+		line += ", " + eta
+	}
+	if Paused() {
+		line += ", Paused"
+	}
+	return line
+}
+
+//estimate returns the estimated completion time based on the expected item count and the
+//observed throughput, or an empty string if it is not known yet
+func estimate(s Snapshot) string {
+	done := s.Total + s.Skipped
+	if s.Expected <= 0 || done == 0 {
+		return ""
+	}
+	remaining := s.Expected - done
+	if remaining <= 0 {
+		return fmt.Sprintf("%v of ~%v items", done, s.Expected)
+	}
+	elapsed := time.Since(s.Started)
+	left := time.Duration(float64(elapsed) / float64(done) * float64(remaining)).Round(time.Minute)
+	return fmt.Sprintf("%v of ~%v items, ETA: %v (%v)", done, s.Expected, left, time.Now().Add(left).Format("Jan 2 15:04"))
+}
+
+//countItems lists the library (metadata only) to count the items the run will process
+func countItems(svc photos.Library) (int, error) {
+	count := 0
+	req := &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), Filters: searchFilters()}
+	for {
+		time.Sleep(time.Duration(time.Second * time.Duration(Options.Throttle)))
+		items, err := svc.SearchMediaItems(req)
+		if err != nil {
+			return 0, err
+		}
+		count += len(items.MediaItems)
+		req.PageToken = items.NextPageToken
+		if req.PageToken == "" {
+			log.Printf("Counted %v items", count)
+			return count, nil
+		}
+		log.Printf("Counting items: %v", count)
+	}
+}
@@ -0,0 +1,47 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//QuarantineFolder is the sub folder of the backup folder for files that failed validation
+const QuarantineFolder = "quarantine"
+
+//discard removes the broken download of item, or moves it to the quarantine folder with a note
+func discard(item *photos.MediaItem, fileName string, reason error) {
+	if !Options.Quarantine {
+		os.Remove(fileName)
+		return
+	}
+	rel, err := filepath.Rel(Options.BackupFolder, fileName)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(fileName)
+	}
+	target := filepath.Join(Options.BackupFolder, QuarantineFolder, rel)
+	err = MkdirAll(filepath.Dir(target))
+	if err == nil {
+		err = os.Rename(fileName, target)
+	}
+	if err == nil {
+		err = syncDir(filepath.Dir(target))
+	}
+	if err != nil {
+		log.Printf("Unable to quarantine '%v': %v", fileName, err)
+		os.Remove(fileName)
+		return
+	}
+	note := fmt.Sprintf("Item: %v\nFile: %v\nOriginal name: %v\nTime: %v\nReason: %v\n",
+		item.ID, fileName, item.Filename, time.Now().Format(time.RFC3339), reason)
+	err = writeFile(target+".txt", []byte(note))
+	if err != nil {
+		log.Printf("Unable to write quarantine note: %v", err)
+	}
+	log.Printf("Moved '%v' to the quarantine folder", fileName)
+}
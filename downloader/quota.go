@@ -0,0 +1,172 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//quotaName is the state file of the API calls made today
+const quotaName = "quota.json"
+
+//quotaZoneName is the time zone of the day of the API quota, it resets at midnight Pacific time
+const quotaZoneName = "America/Los_Angeles"
+
+//quotaUsage is the number of API calls made in a quota day
+type quotaUsage struct {
+	//Day is the quota day, in the Pacific time zone
+	Day   string `json:"day"`
+	Calls int    `json:"calls"`
+}
+
+//quota counts the API calls of all runs of the day against Options.DailyQuota
+var quota struct {
+	sync.Mutex
+	usage  *quotaUsage
+	loaded bool
+}
+
+//quotaZone returns the time zone of the quota day
+func quotaZone() *time.Location {
+	zone, err := time.LoadLocation(quotaZoneName)
+	if err != nil {
+		//without the zone database, Pacific standard time is close enough
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return zone
+}
+
+//quotaDay returns the quota day of t
+func quotaDay(t time.Time) string {
+	return t.In(quotaZone()).Format("2006-01-02")
+}
+
+//quotaReset returns when the quota day after t starts
+func quotaReset(t time.Time) time.Time {
+	local := t.In(quotaZone())
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())
+}
+
+//resetQuota forgets the usage loaded by a previous run, which may be of another backup folder
+func resetQuota() {
+	quota.Lock()
+	defer quota.Unlock()
+	quota.usage = nil
+	quota.loaded = false
+}
+
+//loadQuota loads the usage, quota must be locked
+func loadQuota() {
+	if quota.loaded {
+		return
+	}
+	quota.loaded = true
+	quota.usage = &quotaUsage{}
+	err := ReadState(quotaName, quota.usage)
+	if err != nil {
+		log.Printf("Unable to read the API calls of the day: %v", err)
+	}
+}
+
+//saveQuota saves the usage, if it was loaded
+func saveQuota() error {
+	quota.Lock()
+	defer quota.Unlock()
+	if !quota.loaded {
+		return nil
+	}
+	return WriteState(quotaName, quota.usage)
+}
+
+//spendQuota counts an API call, when the daily quota is used up it waits for the next quota day
+//with Options.QuotaWait, or returns an error matching ErrQuotaReached
+func spendQuota() error {
+	if Options.DailyQuota <= 0 {
+		return nil
+	}
+	for {
+		quota.Lock()
+		loadQuota()
+		now := time.Now()
+		if quota.usage.Day != quotaDay(now) {
+			quota.usage = &quotaUsage{Day: quotaDay(now)}
+		}
+		if quota.usage.Calls < Options.DailyQuota {
+			quota.usage.Calls++
+			quota.Unlock()
+			return nil
+		}
+		calls := quota.usage.Calls
+		quota.Unlock()
+		reset := quotaReset(now)
+		if !Options.QuotaWait {
+			return fmt.Errorf("%w: %v API calls made today, the quota resets at %v", ErrQuotaReached, calls, reset.Local().Format("Jan 2 15:04"))
+		}
+		log.Printf("Daily quota of %v API calls used up, waiting until %v", Options.DailyQuota, reset.Local().Format("Jan 2 15:04"))
+		err := saveQuota()
+		if err != nil {
+			log.Printf("Unable to save the API calls of the day: %v", err)
+		}
+		select {
+		case <-time.After(time.Until(reset)):
+		case <-stopped():
+			return ErrStopped
+		}
+	}
+}
+
+//quotaLibrary counts the calls to the library against the daily quota
+type quotaLibrary struct {
+	photos.Library
+}
+
+func (q quotaLibrary) SearchMediaItems(req *photos.SearchMediaItemsRequest) (*photos.SearchMediaItemsResponse, error) {
+	err := spendQuota()
+	if err != nil {
+		return nil, err
+	}
+	return q.Library.SearchMediaItems(req)
+}
+
+func (q quotaLibrary) ListMediaItems(pageSize int64, pageToken string) (*photos.ListMediaItemsResponse, error) {
+	err := spendQuota()
+	if err != nil {
+		return nil, err
+	}
+	return q.Library.ListMediaItems(pageSize, pageToken)
+}
+
+func (q quotaLibrary) ListAlbums(pageToken string) (*photos.ListAlbumsResponse, error) {
+	err := spendQuota()
+	if err != nil {
+		return nil, err
+	}
+	return q.Library.ListAlbums(pageToken)
+}
+
+func (q quotaLibrary) GetAlbum(id string) (*photos.Album, error) {
+	err := spendQuota()
+	if err != nil {
+		return nil, err
+	}
+	return q.Library.GetAlbum(id)
+}
+
+func (q quotaLibrary) ListSharedAlbums(pageToken string) (*photos.ListSharedAlbumsResponse, error) {
+	err := spendQuota()
+	if err != nil {
+		return nil, err
+	}
+	return q.Library.ListSharedAlbums(pageToken)
+}
+
+func (q quotaLibrary) BatchGetMediaItems(ids []string) (*photos.BatchGetMediaItemsResponse, error) {
+	err := spendQuota()
+	if err != nil {
+		return nil, err
+	}
+	return q.Library.BatchGetMediaItems(ids)
+}
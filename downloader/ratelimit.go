@@ -0,0 +1,58 @@
+package downloader
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+//rateBurst is how far ahead of the rate limit transfers may get, smoothing out short pauses
+const rateBurst = time.Second
+
+//rateLimiter spaces out transfers to keep them under a number of bytes per second
+type rateLimiter struct {
+	sync.Mutex
+	next time.Time
+}
+
+//diskWrites limits the disk writes to Options.MaxWriteRate
+var diskWrites rateLimiter
+
+//mediaReads limits the media downloads to the rate of the schedule, or Options.MaxRate
+var mediaReads rateLimiter
+
+//wait blocks until n more bytes can be transferred at rate bytes per second, 0 for no limit
+func (l *rateLimiter) wait(rate uint64, n int) {
+	if rate == 0 || n <= 0 {
+		return
+	}
+	l.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	delay := l.next.Sub(now) - rateBurst
+	l.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+//limitedWriter is an io.Writer whose writes are throttled by diskWrites
+type limitedWriter struct {
+	w io.Writer
+}
+
+func (l limitedWriter) Write(p []byte) (int, error) {
+	diskWrites.wait(Options.MaxWriteRate, len(p))
+	return l.w.Write(p)
+}
+
+//limitWrites returns w throttled to Options.MaxWriteRate, or w itself if there is no limit
+func limitWrites(w io.Writer) io.Writer {
+	if Options.MaxWriteRate == 0 {
+		return w
+	}
+	return limitedWriter{w}
+}
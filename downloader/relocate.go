@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//the values of Options.Relocate
+const (
+	//RelocateMove renames the file of an item found at another path
+	RelocateMove = "move"
+	//RelocateLink hard links it, the file stays at its previous path too
+	RelocateLink = "link"
+	//RelocateOff downloads the item again
+	RelocateOff = "off"
+)
+
+//checkRelocate checks Options.Relocate
+func checkRelocate() error {
+	switch Options.Relocate {
+	case "", RelocateMove, RelocateLink, RelocateOff:
+		return nil
+	}
+	return fmt.Errorf("Invalid relocate '%v', use move, link or off", Options.Relocate)
+}
+
+//inFolder checks if fileName is in folder or its sub folders
+func inFolder(folder string, fileName string) bool {
+	rel, err := filepath.Rel(folder, fileName)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+//samePass checks if previous and fileName are both in the partner folder or both out of it. an
+//item shared with the account and in the library is saved by the pass finding it first, which
+//depends on the filters of the run, so it is not moved between the trees of the passes
+func samePass(previous string, fileName string) bool {
+	if Options.PartnerFolder == "" {
+		return true
+	}
+	partner := filepath.Join(Options.BackupFolder, Options.PartnerFolder)
+	return inFolder(partner, previous) == inFolder(partner, fileName)
+}
+
+//previousFile returns where the media of item was saved by an earlier run with another layout:
+//its file in the hash index, or its path in the hash layout of folder. empty if there is none
+func previousFile(item *photos.MediaItem, folder string, fileName string) string {
+	if entry, ok := hashEntry(item.ID); ok {
+		previous := filepath.Join(Options.BackupFolder, filepath.FromSlash(entry.File))
+		if previous == fileName || !samePass(previous, fileName) {
+			return ""
+		}
+		info, err := os.Stat(previous)
+		if err == nil && info.Size() == entry.Size {
+			return previous
+		}
+	}
+	if Options.Layout == LayoutHash {
+		return ""
+	}
+	//the archives of the first versions have no index, and their files no extension
+	name := getFileNameByHash(itemFolder(folder, item), item)
+	for _, previous := range []string{withLegacyExtension(item, name, itemExtension(item)), name} {
+		if previous == fileName {
+			continue
+		}
+		if info, err := os.Stat(previous); err == nil && !info.IsDir() {
+			return previous
+		}
+	}
+	return ""
+}
+
+//relocate moves or links the media of item saved by an earlier run at another path to fileName,
+//so a change of -layout does not download the archive again. returns true if it did
+func relocate(item *photos.MediaItem, folder string, fileName string) bool {
+	mode := Options.Relocate
+	if mode == "" {
+		mode = RelocateMove
+	}
+	if mode == RelocateOff || Options.CAS != "" {
+		return false
+	}
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		return false
+	}
+	previous := previousFile(item, folder, fileName)
+	if previous == "" {
+		return false
+	}
+	err := MkdirAll(filepath.Dir(fileName))
+	if err != nil {
+		log.Printf("Unable to relocate '%v': %v", previous, err)
+		return false
+	}
+	if mode == RelocateLink {
+		err = os.Link(previous, fileName)
+	} else {
+		err = os.Rename(previous, fileName)
+	}
+	if err != nil {
+		log.Printf("Unable to relocate '%v' to '%v', downloading it again: %v", previous, fileName, err)
+		return false
+	}
+	moveHash(item.ID, fileName)
+	markParity(fileName)
+	if mode == RelocateMove {
+		//the sidecar was written at the new path already
+		sidecar := strings.TrimSuffix(previous, filepath.Ext(previous)) + ".json"
+		if sidecar != strings.TrimSuffix(fileName, filepath.Ext(fileName))+".json" {
+			os.Remove(sidecar)
+		}
+		markParity(previous)
+	}
+	err = syncDir(filepath.Dir(fileName))
+	if err != nil {
+		log.Printf("Unable to flush '%v': %v", filepath.Dir(fileName), err)
+	}
+	log.Printf("Relocated '%v' to '%v' (%v)", previous, fileName, mode)
+	return true
+}
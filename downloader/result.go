@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"encoding/json"
+	"time"
+)
+
+//Result is the outcome of DownloadAll
+type Result struct {
+	//Processed is the number of items processed (downloaded, already present or failed)
+	Processed int
+	//Downloaded is the number of files downloaded
+	Downloaded int
+	//Skipped is the number of items left out by the filters
+	Skipped int
+	//Bytes is the number of bytes downloaded
+	Bytes uint64
+	//Duration is how long the run took
+	Duration time.Duration
+	//Failures are the items that failed to download
+	Failures ItemErrors
+	//Albums are the statistics of every album downloaded
+	Albums []AlbumStats
+	//LibraryItems is the number of items returned by the search of the whole library, -1 if
+	//the run did not search all of it
+	LibraryItems int
+}
+
+//newResult returns the result of the run from its statistics
+func newResult(s Snapshot, failures ItemErrors) *Result {
+	return &Result{
+		Processed:    s.Total,
+		Downloaded:   s.Downloaded,
+		Skipped:      s.Skipped,
+		Bytes:        s.TotalSize,
+		Duration:     time.Since(s.Started),
+		Failures:     failures,
+		Albums:       albumResults(),
+		LibraryItems: libraryResult(),
+	}
+}
+
+//reportFailure is a failed item in the JSON report
+type reportFailure struct {
+	ItemID string `json:"itemId"`
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+}
+
+//report is the JSON report of a run
+type report struct {
+	Processed  int             `json:"processed"`
+	Downloaded int             `json:"downloaded"`
+	Skipped    int             `json:"skipped"`
+	Errors     int             `json:"errors"`
+	Bytes      uint64          `json:"bytes"`
+	Seconds    float64         `json:"seconds"`
+	Failures   []reportFailure `json:"failures"`
+	Albums     []AlbumStats    `json:"albums"`
+	//LibraryItems and LibraryTotal are left out when the library was not searched or
+	//-library-total is not set
+	LibraryItems *int `json:"libraryItems,omitempty"`
+	LibraryTotal int  `json:"libraryTotal,omitempty"`
+}
+
+//writeReport writes the result of the run to fileName as JSON
+func writeReport(fileName string, r *Result) error {
+	out := report{
+		Processed:  r.Processed,
+		Downloaded: r.Downloaded,
+		Skipped:    r.Skipped,
+		Errors:     len(r.Failures),
+		Bytes:      r.Bytes,
+		Seconds:    r.Duration.Seconds(),
+		Failures:   make([]reportFailure, 0, len(r.Failures)),
+		Albums:     r.Albums,
+	}
+	if r.LibraryItems >= 0 {
+		out.LibraryItems = &r.LibraryItems
+		out.LibraryTotal = Options.LibraryTotal
+	}
+	for _, f := range r.Failures {
+		out.Failures = append(out.Failures, reportFailure{ItemID: f.ItemID, Path: f.Path, Error: f.Err.Error()})
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(fileName, data)
+}
@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//sampleItems lists the library and picks n random items which pass the filters and are in the
+//slice of this machine (reservoir sampling)
+func sampleItems(svc photos.Library, n int) ([]string, error) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	sample := make([]string, 0, n)
+	count := 0
+	req := &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), Filters: searchFilters()}
+	for {
+		log.Printf("Sampling %v of %v items", len(sample), count)
+		page := <-fetchPage(svc, req)
+		if page.err != nil {
+			return nil, page.err
+		}
+		items := page.items
+		for _, m := range items.MediaItems {
+			if !inSlice(m) || skipReason(m) != "" {
+				continue
+			}
+			count++
+			if len(sample) < n {
+				sample = append(sample, m.ID)
+			} else if i := random.Intn(count); i < n {
+				sample[i] = m.ID
+			}
+		}
+		req.PageToken = items.NextPageToken
+		if req.PageToken == "" {
+			return sample, nil
+		}
+	}
+}
+
+//downloadSample downloads Options.Sample random items. the items are fetched again
+//before downloading, since base URLs expire while listing a large library
+func downloadSample(svc photos.Library) (bool, error) {
+	ids, err := sampleItems(svc, Options.Sample)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Downloading a sample of %v items", len(ids))
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > photos.MaxBatchGet {
+			n = photos.MaxBatchGet
+		}
+		resp, err := svc.BatchGetMediaItems(ids[:n])
+		if err != nil {
+			return false, err
+		}
+		for _, r := range resp.MediaItemResults {
+			if r.MediaItem == nil {
+				continue
+			}
+			if !processItem(svc, r.MediaItem, Options.BackupFolder) {
+				return false, nil
+			}
+		}
+		ids = ids[n:]
+	}
+	return true, nil
+}
@@ -0,0 +1,85 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//target filesystems of file names
+const (
+	//FilesystemWindows keeps names valid on Windows, exFAT and SMB shares
+	FilesystemWindows = "windows"
+	//FilesystemPosix only replaces the characters invalid on Linux and macOS
+	FilesystemPosix = "posix"
+)
+
+//unicode normalization forms of file names
+const (
+	//NormalizeNFC composes accents, the form of Linux and Windows
+	NormalizeNFC = "nfc"
+	//NormalizeNFD decomposes accents, the form of HFS+ on macOS
+	NormalizeNFD = "nfd"
+)
+
+//reservedNames are the device names Windows does not allow as file names, even with an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+//checkFilesystem validates Options.Filesystem
+func checkFilesystem() error {
+	switch Options.Filesystem {
+	case "", FilesystemWindows, FilesystemPosix:
+		return nil
+	}
+	return fmt.Errorf("Unknown filesystem '%v', use %v or %v", Options.Filesystem, FilesystemWindows, FilesystemPosix)
+}
+
+//checkNormalize validates Options.Normalize
+func checkNormalize() error {
+	switch Options.Normalize {
+	case "", NormalizeNFC, NormalizeNFD:
+		return nil
+	}
+	return fmt.Errorf("Unknown unicode normalization '%v', use %v or %v", Options.Normalize, NormalizeNFC, NormalizeNFD)
+}
+
+//normalize returns name in the unicode form of Options.Normalize, so the same accented name
+//written on macOS and on Linux is the same file
+func normalize(name string) string {
+	if Options.Normalize == NormalizeNFD {
+		return norm.NFD.String(name)
+	}
+	return norm.NFC.String(name)
+}
+
+//sanitize makes name, which comes from the library such as an original file name, usable as
+//a single path element on Options.Filesystem
+func sanitize(name string) string {
+	if Options.Filesystem == FilesystemPosix {
+		name = strings.NewReplacer("/", "_", "\x00", "_").Replace(name)
+	} else {
+		name = strings.Map(func(r rune) rune {
+			if r < 32 || strings.ContainsRune(`<>:"/\|?*`, r) {
+				return '_'
+			}
+			return r
+		}, name)
+		name = strings.TrimRight(name, ". ")
+		stem := name
+		if i := strings.Index(stem, "."); i >= 0 {
+			stem = stem[:i]
+		}
+		if reservedNames[strings.ToUpper(strings.TrimSpace(stem))] {
+			name = "_" + name
+		}
+	}
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+//scheduleCheck is how often a worker over the number of workers of the schedule checks again
+const scheduleCheck = 10 * time.Second
+
+//window is a time of the day with its own download rate and number of workers
+type window struct {
+	//start and end are minutes since midnight, local time. end is excluded, and before start
+	//for a window over midnight
+	start int
+	end   int
+	//rate is the download rate in bytes per second, 0 for no limit
+	rate uint64
+	//workers is the number of concurrent downloads, 0 for Options.Workers
+	workers int
+}
+
+//schedule are the windows of Options.Schedule in the current run
+var schedule []window
+
+//parseClock parses a time of the day such as 07:30, to minutes since midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+//parseSchedule parses Options.Schedule, comma separated windows such as 01:00-07:00=0/8
+//(no limit and 8 workers) or 09:00-18:00=500KB
+func parseSchedule() ([]window, error) {
+	if Options.Schedule == "" {
+		return nil, nil
+	}
+	var windows []window
+	for _, part := range strings.Split(Options.Schedule, ",") {
+		invalid := fmt.Errorf("Invalid schedule window '%v', use HH:MM-HH:MM=RATE or HH:MM-HH:MM=RATE/WORKERS such as 01:00-07:00=0/8", part)
+		times := strings.SplitN(part, "=", 2)
+		if len(times) != 2 {
+			return nil, invalid
+		}
+		clock := strings.SplitN(times[0], "-", 2)
+		if len(clock) != 2 {
+			return nil, invalid
+		}
+		var w window
+		var err error
+		w.start, err = parseClock(clock[0])
+		if err != nil {
+			return nil, invalid
+		}
+		w.end, err = parseClock(clock[1])
+		if err != nil || w.end == w.start {
+			return nil, invalid
+		}
+		limits := strings.SplitN(times[1], "/", 2)
+		rate := strings.TrimSpace(limits[0])
+		if rate != "0" && rate != "unlimited" {
+			w.rate, err = humanize.ParseBytes(rate)
+			if err != nil {
+				return nil, invalid
+			}
+		}
+		if len(limits) == 2 {
+			w.workers, err = strconv.Atoi(strings.TrimSpace(limits[1]))
+			if err != nil || w.workers < 1 {
+				return nil, invalid
+			}
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+//contains checks if the window includes the time of the day of t
+func (w window) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+//currentWindow returns the first window of the schedule including now, nil if there is none
+func currentWindow() *window {
+	now := time.Now()
+	for i := range schedule {
+		if schedule[i].contains(now) {
+			return &schedule[i]
+		}
+	}
+	return nil
+}
+
+//downloadRate returns the current limit of the media downloads in bytes per second, 0 for no limit
+func downloadRate() uint64 {
+	if w := currentWindow(); w != nil {
+		return w.rate
+	}
+	return Options.MaxRate
+}
+
+//scheduledWorkers returns the current number of concurrent downloads
+func scheduledWorkers() int {
+	if w := currentWindow(); w != nil && w.workers > 0 {
+		return w.workers
+	}
+	return Options.Workers
+}
+
+//maxWorkers returns the largest number of concurrent downloads of the schedule, within the
+//limit of Options.LowMemory
+func maxWorkers() int {
+	workers := Options.Workers
+	for _, w := range schedule {
+		if w.workers > workers {
+			workers = w.workers
+		}
+	}
+	return limitWorkers(workers)
+}
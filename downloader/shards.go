@@ -0,0 +1,91 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//Shard values
+const (
+	//ShardYear searches the library one year at a time
+	ShardYear = "year"
+	//ShardMonth searches the library one month at a time
+	ShardMonth = "month"
+)
+
+//checkShards validates Options.Shards, the shards are date filters of searches of the whole library
+func checkShards() error {
+	switch Options.Shards {
+	case "":
+		return nil
+	case ShardYear, ShardMonth:
+	default:
+		return fmt.Errorf("Invalid shards '%v', use %v or %v", Options.Shards, ShardYear, ShardMonth)
+	}
+	if Options.Order != "" {
+		return fmt.Errorf("The order (-order) can not be used with -shards, the shards are searched at the same time")
+	}
+	if Options.Enumerate == EnumerateList {
+		return fmt.Errorf("-enumerate %v can not be used with -shards, it has no date filters", EnumerateList)
+	}
+	return nil
+}
+
+//monthBuckets returns monthly date ranges covering the whole library, items older than
+//firstBucketYear are in one range
+func monthBuckets() []*photos.DateRange {
+	buckets := []*photos.DateRange{{
+		StartDate: &photos.Date{Year: 1, Month: 1, Day: 1},
+		EndDate:   &photos.Date{Year: firstBucketYear - 1, Month: 12, Day: 31},
+	}}
+	for year := firstBucketYear; year <= time.Now().Year()+1; year++ {
+		for month := 1; month <= 12; month++ {
+			last := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+			buckets = append(buckets, &photos.DateRange{
+				StartDate: &photos.Date{Year: year, Month: month, Day: 1},
+				EndDate:   &photos.Date{Year: year, Month: month, Day: last},
+			})
+		}
+	}
+	return buckets
+}
+
+//downloadSharded searches the library in date shards, Options.ShardWorkers shards at a time
+func downloadSharded(svc photos.Library, seen map[string]bool) (bool, error) {
+	buckets := dateBuckets()
+	if Options.Shards == ShardMonth {
+		buckets = monthBuckets()
+	}
+	passes := make([]*pass, len(buckets))
+	more, err := parallel(limitWorkers(Options.ShardWorkers), len(buckets), func(i int) (bool, error) {
+		if !bucketInSlice(buckets[i]) {
+			return true, nil
+		}
+		filters := searchFilters()
+		if filters == nil {
+			filters = &photos.Filters{}
+		}
+		filters.DateFilter = &photos.DateFilter{Ranges: []*photos.DateRange{buckets[i]}}
+		req := &photos.SearchMediaItemsRequest{PageSize: int64(Options.PageSize), Filters: filters}
+		_, n, _ := parseSlice()
+		passes[i] = &pass{folder: Options.BackupFolder, sliced: n > 1 && Options.ShardBy == ShardByDate && bucketMonth(buckets[i])}
+		return downloadSearch(svc, req, passes[i], seen)
+	})
+	_, n, _ := parseSlice()
+	if err != nil || !more || searchFilters() != nil || n > 1 {
+		return more, err
+	}
+	count := 0
+	for _, p := range passes {
+		if p == nil || !p.complete {
+			return more, nil
+		}
+		count += p.count
+	}
+	log.Printf("Searched %v shards", len(buckets))
+	tallyLibrary(count)
+	return more, nil
+}
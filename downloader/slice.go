@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//ShardBy values
+const (
+	//ShardByID splits the library by a hash of the item IDs
+	ShardByID = "id"
+	//ShardByDate splits the library by the month of creation of the items
+	ShardByDate = "date"
+)
+
+//parseSlice parses Options.Shard, such as 2/4 for the second of 4 machines. it returns 0, 0
+//when the option is not set
+func parseSlice() (int, int, error) {
+	if Options.Shard == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(Options.Shard, "/", 2)
+	invalid := fmt.Errorf("Invalid shard '%v', use i/N such as 2/4 for the second of 4 machines", Options.Shard)
+	if len(parts) != 2 {
+		return 0, 0, invalid
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, invalid
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || n < 1 || i < 1 || i > n {
+		return 0, 0, invalid
+	}
+	return i, n, nil
+}
+
+//checkSlice validates Options.Shard and Options.ShardBy
+func checkSlice() error {
+	_, _, err := parseSlice()
+	if err != nil {
+		return err
+	}
+	switch Options.ShardBy {
+	case "", ShardByID, ShardByDate:
+		return nil
+	}
+	return fmt.Errorf("Invalid shard-by '%v', use %v or %v", Options.ShardBy, ShardByID, ShardByDate)
+}
+
+//sliceFolder returns the sub folder of the state folder of this machine, every machine has its
+//own state so they do not overwrite the state of the others. empty without Options.Shard
+func sliceFolder() string {
+	i, n, err := parseSlice()
+	if err != nil || n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("shard-%v-of-%v", i, n)
+}
+
+//monthSlice returns the machine, from 1 to n, of the items created in the month of t
+func monthSlice(t time.Time, n int) int {
+	return (t.Year()*12+int(t.Month())-1)%n + 1
+}
+
+//inSlice checks if item is in the slice of the library of this machine
+func inSlice(item *photos.MediaItem) bool {
+	i, n, err := parseSlice()
+	if err != nil || n <= 1 {
+		return true
+	}
+	if Options.ShardBy == ShardByDate {
+		if item.MediaMetadata == nil {
+			return i == 1
+		}
+		t, err := time.Parse(time.RFC3339, item.MediaMetadata.CreationTime)
+		if err != nil {
+			return i == 1
+		}
+		return monthSlice(t.UTC(), n) == i
+	}
+	h := fnv.New32a()
+	h.Write([]byte(item.ID))
+	return int(h.Sum32()%uint32(n))+1 == i
+}
+
+//bucketMonth checks if the date range is within a month
+func bucketMonth(bucket *photos.DateRange) bool {
+	return bucket.StartDate.Year == bucket.EndDate.Year && bucket.StartDate.Month == bucket.EndDate.Month
+}
+
+//bucketInSlice checks if the items of the date range may be in the slice of this machine, only
+//ranges within a month can be left out
+func bucketInSlice(bucket *photos.DateRange) bool {
+	i, n, err := parseSlice()
+	if err != nil || n <= 1 || Options.ShardBy != ShardByDate {
+		return true
+	}
+	if !bucketMonth(bucket) {
+		return true
+	}
+	start := bucket.StartDate
+	return monthSlice(time.Date(start.Year, time.Month(start.Month), 1, 0, 0, 0, 0, time.UTC), n) == i
+}
@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+//StateFolder is the sub folder of the backup folder holding what is kept between runs
+const StateFolder = ".gitmoo"
+
+//StateFileName returns a file of the state folder, of the machine with Options.Shard
+func StateFileName(name string) string {
+	return filepath.Join(Options.BackupFolder, StateFolder, sliceFolder(), name)
+}
+
+//resetState forgets the state loaded by a previous run, which may be of another backup folder
+func resetState() {
+	resetCaptureTimes()
+	resetEdited()
+	resetHashes()
+	resetQuota()
+	resetExtensions()
+	resetFeed()
+	resetParity()
+	resetPathDB()
+	resetMetadata()
+	resetFailures()
+}
+
+//saveState saves the state files changed during the run
+func saveState() {
+	err := saveCaptureTimes()
+	if err != nil {
+		log.Printf("Unable to save the capture times: %v", err)
+	}
+	err = saveEdited()
+	if err != nil {
+		log.Printf("Unable to save the sizes of edited files: %v", err)
+	}
+	err = saveHashes()
+	if err != nil {
+		log.Printf("Unable to save the hash index: %v", err)
+	}
+	err = savePathDB()
+	if err != nil {
+		log.Printf("Unable to save the paths of the object store: %v", err)
+	}
+	err = saveMetadata()
+	if err != nil {
+		log.Printf("Unable to save the fingerprints of the sidecars: %v", err)
+	}
+	err = saveFailures()
+	if err != nil {
+		log.Printf("Unable to save the pending failures: %v", err)
+	}
+	err = saveExtensions()
+	if err != nil {
+		log.Printf("Unable to save the extensions of the files: %v", err)
+	}
+	err = saveQuota()
+	if err != nil {
+		log.Printf("Unable to save the API calls of the day: %v", err)
+	}
+	err = saveFeed()
+	if err != nil {
+		log.Printf("Unable to write the feed '%v': %v", Options.Feed, err)
+	}
+}
+
+//ReadState reads a state file into v, a missing file leaves v unchanged
+func ReadState(name string, v interface{}) error {
+	data, err := ioutil.ReadFile(StateFileName(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//WriteState saves v in a state file
+func WriteState(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fileName := StateFileName(name)
+	err = MkdirAll(filepath.Dir(fileName))
+	if err != nil {
+		return err
+	}
+	return writeFile(fileName, data)
+}
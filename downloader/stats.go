@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+//counters are the statistics of a run, updated concurrently by the searches and the workers
+type counters struct {
+	total      atomic.Int64
+	skipped    atomic.Int64
+	errors     atomic.Int64
+	downloaded atomic.Int64
+	totalsize  atomic.Uint64
+	//expected is the estimated number of items in the run, 0 if unknown
+	expected atomic.Int64
+	started  atomic.Int64
+}
+
+//Snapshot is a consistent copy of the statistics of a run
+type Snapshot struct {
+	//Total is the number of items processed (downloaded, already present or failed)
+	Total int
+	//Skipped is the number of items left out by the filters
+	Skipped int
+	//Errors is the number of items that failed to download
+	Errors int
+	//Downloaded is the number of files downloaded
+	Downloaded int
+	//TotalSize is the number of bytes downloaded
+	TotalSize uint64
+	//Expected is the estimated number of items in the run, 0 if unknown
+	Expected int
+	//Started is when the run started
+	Started time.Time
+}
+
+var stats counters
+
+//reset starts the statistics of a new run
+func (c *counters) reset() {
+	c.total.Store(0)
+	c.skipped.Store(0)
+	c.errors.Store(0)
+	c.downloaded.Store(0)
+	c.totalsize.Store(0)
+	c.expected.Store(0)
+	c.started.Store(time.Now().UnixNano())
+}
+
+//snapshot returns a copy of the counters
+func (c *counters) snapshot() Snapshot {
+	return Snapshot{
+		Total:      int(c.total.Load()),
+		Skipped:    int(c.skipped.Load()),
+		Errors:     int(c.errors.Load()),
+		Downloaded: int(c.downloaded.Load()),
+		TotalSize:  c.totalsize.Load(),
+		Expected:   int(c.expected.Load()),
+		Started:    time.Unix(0, c.started.Load()),
+	}
+}
+
+//Stats returns the statistics of the current (or last) run
+func Stats() Snapshot {
+	return stats.snapshot()
+}
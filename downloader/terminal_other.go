@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package downloader
+
+import "os"
+
+//enableANSI returns true, terminals interpret ANSI escape sequences
+func enableANSI(f *os.File) bool {
+	return true
+}
@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package downloader
+
+import (
+	"os"
+	"syscall"
+)
+
+//enableVirtualTerminal is the console mode interpreting ANSI escape sequences
+const enableVirtualTerminal = 0x0004
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+//enableANSI turns on the ANSI escape sequences of the console of f, returns false if the
+//console does not support them (before Windows 10)
+func enableANSI(f *os.File) bool {
+	var mode uint32
+	err := syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode)
+	if err != nil {
+		return false
+	}
+	r, _, _ := procSetConsoleMode.Call(f.Fd(), uintptr(mode|enableVirtualTerminal))
+	return r != 0
+}
@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//thumbnailExtension is the extension of the thumbnails, the API returns them as JPEG
+const thumbnailExtension = ".jpg"
+
+//checkThumbnails checks the thumbnail options
+func checkThumbnails() error {
+	if Options.ThumbnailsOnly && Options.Thumbnails == "" {
+		return fmt.Errorf("Thumbnails only needs the thumbnail folder (-thumbnails)")
+	}
+	if Options.Thumbnails != "" && Options.ThumbnailSize <= 0 {
+		return fmt.Errorf("Invalid thumbnail size %v", Options.ThumbnailSize)
+	}
+	return nil
+}
+
+//ThumbnailName returns the thumbnail of the media file imageName, at the same path in the
+//thumbnail folder as in the backup folder
+func ThumbnailName(imageName string) string {
+	rel, err := filepath.Rel(Options.BackupFolder, imageName)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(imageName)
+	}
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + thumbnailExtension
+	return filepath.Join(Options.Thumbnails, rel)
+}
+
+//createThumbnail downloads the thumbnail of item for the media file imageName, it returns false
+//if it was already downloaded. thumbnails of videos are a frame of the video
+func createThumbnail(item *photos.MediaItem, imageName string) (bool, error) {
+	fileName := ThumbnailName(imageName)
+	_, err := os.Stat(fileName)
+	if err == nil {
+		return false, nil
+	}
+	if !os.IsNotExist(err) {
+		return false, err
+	}
+	response, err := startTransfer(fmt.Sprintf("%v=w%v-h%v", item.BaseURL, Options.ThumbnailSize, Options.ThumbnailSize))
+	if err != nil {
+		return false, err
+	}
+	defer response.Close()
+	err = MkdirAll(filepath.Dir(fileName))
+	if err != nil {
+		return false, err
+	}
+	output, err := createPart(fileName)
+	if err != nil {
+		return false, err
+	}
+	n, err := io.Copy(limitWrites(output), response.Body)
+	err = response.err(err)
+	if err == nil && response.Length >= 0 && n != response.Length {
+		err = fmt.Errorf("%w: received %v of %v bytes", errTruncated, n, response.Length)
+	}
+	if err != nil {
+		abortFile(output, fileName)
+	} else {
+		err = commitFile(output, fileName)
+	}
+	if err != nil {
+		os.Remove(fileName)
+		return false, err
+	}
+	log.Printf("Downloaded thumbnail '%v' (%v)", fileName, humanize.Bytes(uint64(n)))
+	stats.totalsize.Add(uint64(n))
+	tallyBytes(item.ID, n)
+	return true, nil
+}
+
+//mirrorThumbnail downloads the thumbnail of item when Options.Thumbnails is set, a failure is
+//logged as the media file was saved
+func mirrorThumbnail(item *photos.MediaItem, imageName string) {
+	if Options.Thumbnails == "" {
+		return
+	}
+	_, err := createThumbnail(item, imageName)
+	if err != nil {
+		log.Printf("Unable to download the thumbnail of %v: %v", item.ID, err)
+	}
+}
@@ -0,0 +1,39 @@
+package downloader
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//folderZone is the time zone of the dates in file names, see Options.Timezone
+var folderZone = time.UTC
+
+//checkTimezone parses Options.Timezone: utc, local, a zone name such as Europe/Paris or a fixed
+//offset such as +05:30
+func checkTimezone() error {
+	zone := Options.Timezone
+	switch strings.ToLower(zone) {
+	case "", "utc":
+		folderZone = time.UTC
+		return nil
+	case "local":
+		folderZone = time.Local
+		return nil
+	}
+	if strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-") {
+		t, err := time.Parse("-07:00", zone)
+		if err != nil {
+			return fmt.Errorf("Invalid time zone offset '%v', use a value such as +05:30", zone)
+		}
+		_, offset := t.Zone()
+		folderZone = time.FixedZone("UTC"+zone, offset)
+		return nil
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return fmt.Errorf("Unknown time zone '%v': %v", zone, err)
+	}
+	folderZone = loc
+	return nil
+}
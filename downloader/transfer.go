@@ -0,0 +1,186 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"golang.org/x/net/context"
+)
+
+//speedWindow is the period the rolling download speed is measured over
+const speedWindow = 30 * time.Second
+
+//errStalled is returned when a transfer makes no progress for Options.StallTimeout
+var errStalled = errors.New("transfer stalled")
+
+//errTimedOut is returned when a transfer took longer than Options.ItemTimeout
+var errTimedOut = errors.New("transfer timed out")
+
+//errTruncated is returned when a transfer ended before the announced Content-Length
+var errTruncated = errors.New("transfer truncated")
+
+//meter measures the rolling download speed in one second buckets
+type meter struct {
+	sync.Mutex
+	buckets [int(speedWindow / time.Second)]uint64
+	stamps  [int(speedWindow / time.Second)]int64
+}
+
+var speed meter
+
+func (m *meter) add(n int) {
+	now := time.Now().Unix()
+	m.Lock()
+	i := now % int64(len(m.buckets))
+	if m.stamps[i] != now {
+		m.stamps[i] = now
+		m.buckets[i] = 0
+	}
+	m.buckets[i] += uint64(n)
+	m.Unlock()
+}
+
+//rate returns the bytes per second over the last speedWindow
+func (m *meter) rate() uint64 {
+	now := time.Now().Unix()
+	total := uint64(0)
+	m.Lock()
+	for i, stamp := range m.stamps {
+		if now-stamp < int64(len(m.buckets)) {
+			total += m.buckets[i]
+		}
+	}
+	m.Unlock()
+	return total / uint64(len(m.buckets))
+}
+
+//speedLine returns the rolling download speed for the progress line, or an empty string if idle
+func speedLine() string {
+	rate := speed.rate()
+	if rate == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Speed: %v/s", humanize.Bytes(rate))
+}
+
+//watchedReader records the time of the last read that made progress
+type watchedReader struct {
+	r    io.Reader
+	last int64
+}
+
+func (w *watchedReader) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	if n > 0 {
+		//the time waiting for the rate limit is not a stall
+		mediaReads.wait(downloadRate(), n)
+		atomic.StoreInt64(&w.last, time.Now().UnixNano())
+		speed.add(n)
+	}
+	return n, err
+}
+
+//transfer is an in flight media download that is aborted if it stalls
+type transfer struct {
+	Body    io.Reader
+	Header  http.Header
+	Length  int64
+	body    io.ReadCloser
+	watched *watchedReader
+	cancel  context.CancelFunc
+	started time.Time
+	//aborted is the error of a transfer aborted by watch, nil otherwise
+	aborted atomic.Value
+	done    chan struct{}
+}
+
+//mediaClient returns the client for media (base URL) downloads, which are not authenticated
+func mediaClient() *http.Client {
+	if Options.Transport == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: Options.Transport}
+}
+
+//startTransfer requests url and watches the response body for stalls
+func startTransfer(url string) (*transfer, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	response, err := mediaClient().Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		cancel()
+		return nil, mediaError(response.StatusCode, response.Status)
+	}
+	t := &transfer{
+		Header:  response.Header,
+		Length:  response.ContentLength,
+		body:    response.Body,
+		watched: &watchedReader{r: response.Body, last: time.Now().UnixNano()},
+		cancel:  cancel,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	t.Body = t.watched
+	if Options.StallTimeout > 0 || Options.ItemTimeout > 0 {
+		go t.watch()
+	}
+	return t, nil
+}
+
+//watch cancels the request when no data arrived for Options.StallTimeout, or when it took
+//longer than Options.ItemTimeout
+func (t *transfer) watch() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			last := time.Unix(0, atomic.LoadInt64(&t.watched.last))
+			if Options.StallTimeout > 0 && time.Since(last) > Options.StallTimeout {
+				log.Printf("No data received for %v, aborting transfer", time.Since(last).Round(time.Second))
+				t.aborted.Store(errStalled)
+				t.cancel()
+				return
+			}
+			if Options.ItemTimeout > 0 && time.Since(t.started) > Options.ItemTimeout {
+				log.Printf("Transfer still running after %v, aborting it", Options.ItemTimeout)
+				t.aborted.Store(errTimedOut)
+				t.cancel()
+				return
+			}
+		}
+	}
+}
+
+//err maps a read error caused by watch to errStalled or errTimedOut
+func (t *transfer) err(err error) error {
+	if aborted, ok := t.aborted.Load().(error); ok && err != nil {
+		return aborted
+	}
+	return err
+}
+
+//Close stops watching and releases the connection
+func (t *transfer) Close() error {
+	close(t.done)
+	err := t.body.Close()
+	t.cancel()
+	return err
+}
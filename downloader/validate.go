@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+
+	//decoders used by image.DecodeConfig and image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+//validation modes
+const (
+	//ValidateHeader decodes the image header
+	ValidateHeader = "header"
+	//ValidateFull decodes the whole image (the header only for HEIC)
+	ValidateFull = "full"
+)
+
+//heifBrands are the ftyp brands of HEIC/HEIF photos
+var heifBrands = []string{"heic", "heix", "heim", "heis", "mif1", "msf1"}
+
+func checkValidate() error {
+	switch Options.Validate {
+	case "", ValidateHeader, ValidateFull:
+		return nil
+	}
+	return fmt.Errorf("Unknown validation '%v', use %v or %v", Options.Validate, ValidateHeader, ValidateFull)
+}
+
+//isHEIFHeader checks if header starts with the ftyp box of a HEIC/HEIF photo
+func isHEIFHeader(header []byte) bool {
+	if len(header) < 12 || string(header[4:8]) != "ftyp" {
+		return false
+	}
+	for _, brand := range heifBrands {
+		if string(header[8:12]) == brand {
+			return true
+		}
+	}
+	return false
+}
+
+//decodableTypes are the mime types with a decoder
+var decodableTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+//validateImage checks that the photo in fileName (of mimeType) can be decoded, formats without
+//a decoder (RAW, WebP...) are not checked
+func validateImage(fileName string, mimeType string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	header, _ := r.Peek(12)
+	if isHEIFHeader(header) {
+		//there is no HEIC decoder, the ftyp box is the header check
+		return nil
+	}
+	decodable := bytes.HasPrefix(header, []byte("\xff\xd8\xff")) || bytes.HasPrefix(header, []byte("\x89PNG")) || bytes.HasPrefix(header, []byte("GIF8"))
+	if !decodable {
+		for _, t := range decodableTypes {
+			if strings.EqualFold(mimeType, t) {
+				return invalidError(fmt.Sprintf("Invalid image: not a %v file", t))
+			}
+		}
+		return nil
+	}
+	if Options.Validate == ValidateFull {
+		_, _, err = image.Decode(r)
+	} else {
+		_, _, err = image.DecodeConfig(r)
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return invalidError("Invalid image: truncated file")
+	}
+	if err != nil {
+		return invalidError(fmt.Sprintf("Invalid image: %v", err))
+	}
+	return nil
+}
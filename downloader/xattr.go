@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//extended attributes set on the archive files with Options.Xattr
+const (
+	//XattrID is the media item ID
+	XattrID = "user.gitmoo.id"
+	//XattrCreated is the creation time of the item, RFC 3339
+	XattrCreated = "user.gitmoo.created"
+	//XattrAlbums are the titles of the albums of the item, one per line
+	XattrAlbums = "user.gitmoo.albums"
+)
+
+//errXattrUnsupported is returned by setXattr on platforms without extended attributes
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+//xattrFailed stops tagging after the first failure, the filesystem is unlikely to support them later
+var xattrFailed atomic.Bool
+
+//tag sets an extended attribute on fileName, a failure is logged once and disables tagging
+func tag(fileName string, name string, value string) {
+	if xattrFailed.Load() {
+		return
+	}
+	err := setXattr(fileName, name, value)
+	if err != nil && xattrFailed.CompareAndSwap(false, true) {
+		log.Printf("Unable to set extended attributes on '%v', not tagging files: %v", fileName, err)
+	}
+}
+
+//tagItem stores the ID and the creation time of item on its files which exist
+func tagItem(item *photos.MediaItem, fileNames ...string) {
+	for _, fileName := range fileNames {
+		if _, err := os.Stat(fileName); err != nil {
+			continue
+		}
+		tag(fileName, XattrID, item.ID)
+		tag(fileName, XattrCreated, item.MediaMetadata.CreationTime)
+	}
+}
+
+//tagAlbums stores the titles of the albums in the manifests on the media files of their items
+func tagAlbums() {
+	manifests, err := ReadManifests()
+	if err != nil {
+		log.Printf("Unable to tag album files: %v", err)
+		return
+	}
+	albums := make(map[string][]string)
+	for _, m := range manifests {
+		for _, item := range m.Items {
+			albums[item.File] = append(albums[item.File], m.Title)
+		}
+	}
+	for file, titles := range albums {
+		fileName := filepath.Join(Options.BackupFolder, filepath.FromSlash(file))
+		if _, err := os.Stat(fileName); err != nil {
+			continue
+		}
+		sort.Strings(titles)
+		tag(fileName, XattrAlbums, strings.Join(titles, "\n"))
+	}
+}
@@ -0,0 +1,19 @@
+//go:build darwin
+// +build darwin
+
+package downloader
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+//setXattr uses the xattr command, the syscall package has no extended attributes on macOS
+func setXattr(fileName string, name string, value string) error {
+	output, err := exec.Command("xattr", "-w", name, value, fileName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %v", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build linux
+// +build linux
+
+package downloader
+
+import "syscall"
+
+func setXattr(fileName string, name string, value string) error {
+	return syscall.Setxattr(fileName, name, []byte(value), 0)
+}
@@ -0,0 +1,8 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package downloader
+
+func setXattr(fileName string, name string, value string) error {
+	return errXattrUnsupported
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package downloader
+
+import "io/ioutil"
+
+//setXattr stores the attribute in an NTFS alternate data stream of the file
+func setXattr(fileName string, name string, value string) error {
+	return ioutil.WriteFile(fileName+":"+name, []byte(value), 0644)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//eventSource is the source of the events in the Application log
+const eventSource = "gitmoo-goog"
+
+//the event IDs, 1000 and the exit code of the run, for monitoring rules
+const (
+	eventRunCompleted uint32 = 1000
+	eventRunFailed    uint32 = 1001
+	eventItemErrors   uint32 = 1002
+	eventAuthRequired uint32 = 1003
+)
+
+//the event types of ReportEvent
+const (
+	eventError       uint16 = 1
+	eventWarning     uint16 = 2
+	eventInformation uint16 = 4
+)
+
+const (
+	//eventFailures is the number of failed items listed in an event
+	eventFailures = 20
+	//eventMaxLength is below the 31839 characters an event message can have
+	eventMaxLength = 30000
+)
+
+//events is the Windows Event Log of -event-log, nil when the events are not written
+var events *eventLog
+
+//reportRun writes the outcome of a run, its summary and its errors, to the event log
+func reportRun(result *downloader.Result, err error) {
+	if events == nil {
+		return
+	}
+	kind, id := eventInformation, eventRunCompleted
+	switch exitCode(err) {
+	case exitItemErrors:
+		kind, id = eventWarning, eventItemErrors
+	case exitAuthRequired:
+		kind, id = eventError, eventAuthRequired
+	case exitFatal:
+		kind, id = eventError, eventRunFailed
+	}
+	var lines []string
+	if result != nil {
+		lines = append(lines, fmt.Sprintf("Processed: %v, Downloaded: %v, Skipped: %v, Errors: %v, Total Size: %v, Time: %v",
+			result.Processed, result.Downloaded, result.Skipped, len(result.Failures), humanize.Bytes(result.Bytes), result.Duration.Round(time.Second)))
+	}
+	var failed downloader.ItemErrors
+	if err != nil && !errors.As(err, &failed) {
+		lines = append(lines, err.Error())
+	}
+	if result != nil {
+		for i, f := range result.Failures {
+			if i == eventFailures {
+				lines = append(lines, fmt.Sprintf("and %v more failed items", len(result.Failures)-i))
+				break
+			}
+			lines = append(lines, f.Error())
+		}
+	}
+	message := strings.Join(lines, "\r\n")
+	if len(message) > eventMaxLength {
+		message = message[:eventMaxLength]
+	}
+	reportErr := events.report(kind, id, message)
+	if reportErr != nil {
+		log.Printf("Unable to write to the event log: %v", reportErr)
+	}
+}
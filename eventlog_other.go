@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+//eventLog is the Windows Event Log, not available on other systems
+type eventLog struct{}
+
+//openEventLog returns an error, use the log or syslog on this system
+func openEventLog(source string) (*eventLog, error) {
+	return nil, errors.New("The event log is only available on Windows")
+}
+
+func (l *eventLog) report(kind uint16, id uint32, message string) error {
+	return nil
+}
+
+func (l *eventLog) close() {
+}
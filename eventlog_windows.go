@@ -0,0 +1,53 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+//advapi32 is loaded by keyring_windows.go
+var (
+	procRegisterEventSource   = advapi32.NewProc("RegisterEventSourceW")
+	procReportEvent           = advapi32.NewProc("ReportEventW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+)
+
+//eventLog writes events to the Application log of Windows
+type eventLog struct {
+	handle uintptr
+}
+
+//openEventLog opens the Application log for the events of source
+func openEventLog(source string) (*eventLog, error) {
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := procRegisterEventSource.Call(0, uintptr(unsafe.Pointer(name)))
+	if h == 0 {
+		return nil, err
+	}
+	return &eventLog{handle: h}, nil
+}
+
+//report writes an event of kind with the event ID id
+func (l *eventLog) report(kind uint16, id uint32, message string) error {
+	text, err := syscall.UTF16PtrFromString(message)
+	if err != nil {
+		return err
+	}
+	messages := []*uint16{text}
+	r, _, err := procReportEvent.Call(l.handle, uintptr(kind), 0, uintptr(id), 0, 1, 0, uintptr(unsafe.Pointer(&messages[0])), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+//close closes the event log
+func (l *eventLog) close() {
+	procDeregisterEventSource.Call(l.handle)
+}
@@ -0,0 +1,414 @@
+//Package exif reads and edits the EXIF metadata of JPEG files, only the few tags the downloader uses
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//ErrNoExif is returned for files without EXIF metadata
+var ErrNoExif = errors.New("no EXIF metadata")
+
+//tags used by the package
+const (
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+)
+
+//exifHeader starts the APP1 segment of EXIF metadata
+var exifHeader = []byte("Exif\x00\x00")
+
+//typeSizes are the sizes of the TIFF field types, by type
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4}
+
+//segment returns the offsets of the TIFF data of the EXIF segment of a JPEG file
+func segment(data []byte) (int, int, error) {
+	return app1(data, exifHeader)
+}
+
+//app1 returns the offsets of the data after header of the first APP1 segment starting with header
+func app1(data []byte, header []byte) (int, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, 0, fmt.Errorf("not a JPEG file")
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 0, 0, ErrNoExif
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 || marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			//the image data starts, metadata is before it
+			return 0, 0, ErrNoExif
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 0, 0, ErrNoExif
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], header) {
+			return i + 4 + len(header), end, nil
+		}
+		i = end
+	}
+	return 0, 0, ErrNoExif
+}
+
+//tiff is the TIFF structure holding EXIF metadata
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+//entry is a field of an IFD
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	//value are the bytes of the value, in the TIFF data
+	value []byte
+}
+
+func parseTIFF(data []byte) (*tiff, error) {
+	if len(data) < 8 {
+		return nil, ErrNoExif
+	}
+	t := &tiff{data: data}
+	switch string(data[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid EXIF header")
+	}
+	return t, nil
+}
+
+//ifd0 returns the offset of the first IFD
+func (t *tiff) ifd0() uint32 {
+	return t.order.Uint32(t.data[4:])
+}
+
+//ifd reads the entries of the IFD at offset
+func (t *tiff) ifd(offset uint32) ([]entry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("invalid IFD offset %v", offset)
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(t.data) {
+		return nil, fmt.Errorf("truncated IFD at %v", offset)
+	}
+	entries := make([]entry, 0, count)
+	for i := 0; i < count; i++ {
+		pos := start + i*12
+		e := entry{
+			tag:   t.order.Uint16(t.data[pos:]),
+			typ:   t.order.Uint16(t.data[pos+2:]),
+			count: t.order.Uint32(t.data[pos+4:]),
+		}
+		size := uint64(typeSizes[e.typ]) * uint64(e.count)
+		if size <= 4 {
+			e.value = t.data[pos+8 : pos+8+int(size)]
+		} else {
+			at := uint64(t.order.Uint32(t.data[pos+8:]))
+			if at+size > uint64(len(t.data)) {
+				//a broken entry, it is skipped rather than failing the whole IFD
+				continue
+			}
+			e.value = t.data[at : at+size]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+//fields returns the 12 byte fields of the IFD at offset as they are, including the broken ones
+//ifd skips, and the offset of the next IFD
+func (t *tiff) fields(offset uint32) ([][]byte, uint32, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, 0, fmt.Errorf("invalid IFD offset %v", offset)
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(t.data) {
+		return nil, 0, fmt.Errorf("truncated IFD at %v", offset)
+	}
+	fields := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		pos := start + i*12
+		fields = append(fields, t.data[pos:pos+12])
+	}
+	next := uint32(0)
+	if pos := start + count*12; pos+4 <= len(t.data) {
+		next = t.order.Uint32(t.data[pos:])
+	}
+	return fields, next, nil
+}
+
+//find returns the entry with tag, or nil
+func find(entries []entry, tag uint16) *entry {
+	for i := range entries {
+		if entries[i].tag == tag {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+//offset returns the value of a LONG entry pointing to another IFD
+func (t *tiff) offset(e *entry) (uint32, bool) {
+	if e == nil || e.typ != 4 && e.typ != 13 || e.count != 1 {
+		return 0, false
+	}
+	return t.order.Uint32(e.value), true
+}
+
+//text returns the value of an ASCII entry
+func text(e *entry) string {
+	if e == nil || e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+//CaptureTime returns the DateTimeOriginal of a JPEG file (or DateTime when it is missing), in
+//its OffsetTimeOriginal time zone or, as EXIF times usually have none, in loc
+func CaptureTime(data []byte, loc *time.Location) (time.Time, error) {
+	start, end, err := segment(data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := parseTIFF(data[start:end])
+	if err != nil {
+		return time.Time{}, err
+	}
+	ifd0, err := t.ifd(t.ifd0())
+	if err != nil {
+		return time.Time{}, err
+	}
+	value, zone := "", ""
+	if offset, ok := t.offset(find(ifd0, tagExifIFD)); ok {
+		exif, err := t.ifd(offset)
+		if err == nil {
+			value = text(find(exif, tagDateTimeOriginal))
+			zone = text(find(exif, tagOffsetTimeOriginal))
+		}
+	}
+	if value == "" {
+		value = text(find(ifd0, tagDateTime))
+	}
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return time.Time{}, ErrNoExif
+	}
+	if zone != "" {
+		return time.Parse("2006:01:02 15:04:05-07:00", value+zone)
+	}
+	return time.ParseInLocation("2006:01:02 15:04:05", value, loc)
+}
+
+//tagImageDescription is the title or caption of the image, in IFD0
+const tagImageDescription = 0x010E
+
+//maxSegment is the largest size of a JPEG segment, without its marker
+const maxSegment = 0xFFFF
+
+//SetDescription sets the EXIF ImageDescription of a JPEG file and returns the new file data, the
+//IPTC and XMP metadata are not changed. the first IFD is rewritten at the end of the EXIF data
+//with the new entry and the other entries copied as they are, so their offsets, which may point
+//anywhere (maker notes...), stay valid
+func SetDescription(data []byte, description string) ([]byte, error) {
+	value := append([]byte(description), 0)
+	start, end, err := segment(data)
+	if err == ErrNoExif {
+		return insertSegment(data, newTIFF(value))
+	}
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseTIFF(data[start:end])
+	if err != nil {
+		return nil, err
+	}
+	fields, next, err := t.fields(t.ifd0())
+	if err != nil {
+		return nil, err
+	}
+	tiff := append([]byte{}, t.data...)
+	for len(tiff)%2 != 0 {
+		tiff = append(tiff, 0)
+	}
+	valueAt := uint32(len(tiff))
+	tiff = append(tiff, value...)
+	for len(tiff)%2 != 0 {
+		tiff = append(tiff, 0)
+	}
+	ifdAt := uint32(len(tiff))
+	kept := make([][]byte, 0, len(fields)+1)
+	added := false
+	field := make([]byte, 12)
+	t.order.PutUint16(field, tagImageDescription)
+	t.order.PutUint16(field[2:], 2)
+	t.order.PutUint32(field[4:], uint32(len(value)))
+	if len(value) <= 4 {
+		copy(field[8:], value)
+	} else {
+		t.order.PutUint32(field[8:], valueAt)
+	}
+	for _, f := range fields {
+		tag := t.order.Uint16(f)
+		if tag == tagImageDescription {
+			continue
+		}
+		if !added && tag > tagImageDescription {
+			kept = append(kept, field)
+			added = true
+		}
+		kept = append(kept, f)
+	}
+	if !added {
+		kept = append(kept, field)
+	}
+	ifd := make([]byte, 2, 2+len(kept)*12+4)
+	t.order.PutUint16(ifd, uint16(len(kept)))
+	for _, e := range kept {
+		ifd = append(ifd, e...)
+	}
+	ifd = append(ifd, 0, 0, 0, 0)
+	t.order.PutUint32(ifd[len(ifd)-4:], next)
+	tiff = append(tiff, ifd...)
+	t.order.PutUint32(tiff[4:], ifdAt)
+	return replaceSegment(data, start, end, tiff)
+}
+
+//newTIFF returns EXIF data with only an ImageDescription
+func newTIFF(value []byte) []byte {
+	o := binary.BigEndian
+	tiff := []byte("MM\x00*\x00\x00\x00\x08")
+	ifd := make([]byte, 2+12+4)
+	o.PutUint16(ifd, 1)
+	o.PutUint16(ifd[2:], tagImageDescription)
+	o.PutUint16(ifd[4:], 2)
+	o.PutUint32(ifd[6:], uint32(len(value)))
+	if len(value) <= 4 {
+		copy(ifd[10:], value)
+	} else {
+		o.PutUint32(ifd[10:], uint32(8+len(ifd)))
+	}
+	tiff = append(tiff, ifd...)
+	if len(value) > 4 {
+		tiff = append(tiff, value...)
+	}
+	return tiff
+}
+
+//replaceSegment replaces the TIFF data of the EXIF segment between start and end
+func replaceSegment(data []byte, start int, end int, tiff []byte) ([]byte, error) {
+	size := 2 + len(exifHeader) + len(tiff)
+	if size > maxSegment {
+		return nil, fmt.Errorf("EXIF metadata too large")
+	}
+	header := start - len(exifHeader) - 2
+	out := make([]byte, 0, len(data)-(end-start)+len(tiff))
+	out = append(out, data[:header]...)
+	out = append(out, byte(size>>8), byte(size))
+	out = append(out, exifHeader...)
+	out = append(out, tiff...)
+	return append(out, data[end:]...), nil
+}
+
+//insertSegment adds an EXIF segment to a JPEG file without one, after the JFIF segment if any
+func insertSegment(data []byte, tiff []byte) ([]byte, error) {
+	size := 2 + len(exifHeader) + len(tiff)
+	if size > maxSegment {
+		return nil, fmt.Errorf("EXIF metadata too large")
+	}
+	at := 2
+	if len(data) >= 6 && data[2] == 0xFF && data[3] == 0xE0 {
+		at = 4 + int(binary.BigEndian.Uint16(data[4:]))
+		if at > len(data) {
+			return nil, fmt.Errorf("invalid JFIF segment")
+		}
+	}
+	out := make([]byte, 0, len(data)+size+2)
+	out = append(out, data[:at]...)
+	out = append(out, 0xFF, 0xE1, byte(size>>8), byte(size))
+	out = append(out, exifHeader...)
+	out = append(out, tiff...)
+	return append(out, data[at:]...), nil
+}
+
+//tagGPSIFD points to the IFD of the GPS tags, in IFD0
+const tagGPSIFD = 0x8825
+
+//xmpHeader starts the APP1 segment of XMP metadata
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+//xmpGPS matches the GPS properties of XMP metadata, as attributes or elements
+var xmpGPS = regexp.MustCompile(`exif:GPS[A-Za-z]+="[^"]*"|(?s)<exif:GPS[A-Za-z]+>.*?</exif:GPS[A-Za-z]+>`)
+
+//StripGPS erases the GPS metadata of a JPEG file in place: the GPS IFD of the EXIF metadata is
+//emptied and the GPS properties of the XMP metadata are blanked out. the size of the file does
+//not change. it reports whether there was anything to erase
+func StripGPS(data []byte) bool {
+	stripped := false
+	start, end, err := segment(data)
+	if err == nil {
+		stripped = stripGPSIFD(data[start:end])
+	}
+	start, end, err = app1(data, xmpHeader)
+	if err == nil {
+		xmp := data[start:end]
+		for _, m := range xmpGPS.FindAllIndex(xmp, -1) {
+			for i := m[0]; i < m[1]; i++ {
+				xmp[i] = ' '
+			}
+			stripped = true
+		}
+	}
+	return stripped
+}
+
+//stripGPSIFD zeroes the values and the entries of the GPS IFD, leaving an empty IFD
+func stripGPSIFD(data []byte) bool {
+	t, err := parseTIFF(data)
+	if err != nil {
+		return false
+	}
+	ifd0, err := t.ifd(t.ifd0())
+	if err != nil {
+		return false
+	}
+	offset, ok := t.offset(find(ifd0, tagGPSIFD))
+	if !ok {
+		return false
+	}
+	gps, err := t.ifd(offset)
+	if err != nil || len(gps) == 0 {
+		return false
+	}
+	for _, e := range gps {
+		for i := range e.value {
+			e.value[i] = 0
+		}
+	}
+	end := int(offset) + 2 + int(t.order.Uint16(t.data[offset:]))*12 + 4
+	if end > len(t.data) {
+		end = len(t.data)
+	}
+	for i := int(offset); i < end; i++ {
+		t.data[i] = 0
+	}
+	return true
+}
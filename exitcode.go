@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//exit codes, so wrappers can tell a partial failure from a failed run
+const (
+	//exitOK is returned when the command succeeded
+	exitOK = 0
+	//exitFatal is returned when the command failed
+	exitFatal = 1
+	//exitItemErrors is returned when the run completed but some items failed to download
+	exitItemErrors = 2
+	//exitAuthRequired is returned when the user must authorize (again) interactively
+	exitAuthRequired = 3
+	//exitStopped is returned when the run was stopped by the stop command before it completed
+	exitStopped = 4
+)
+
+//errAuthRequired is returned when there is no valid token and no terminal to authorize on
+var errAuthRequired = errors.New("Authorization required, run 'gitmoo-goog auth' in a terminal to authorize")
+
+//exitCode returns the exit code of the outcome of a command
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var failed downloader.ItemErrors
+	if errors.As(err, &failed) {
+		return exitItemErrors
+	}
+	if errors.Is(err, downloader.ErrStopped) {
+		return exitStopped
+	}
+	var apiErr *photos.Error
+	if errors.Is(err, errAuthRequired) || errors.As(err, &apiErr) && apiErr.Code == http.StatusUnauthorized {
+		return exitAuthRequired
+	}
+	return exitFatal
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+//byteSize is a flag.Value of a size in bytes, such as 2GB or 500MiB
+type byteSize struct {
+	value *uint64
+}
+
+func (b byteSize) String() string {
+	if b.value == nil || *b.value == 0 {
+		return ""
+	}
+	return humanize.Bytes(*b.value)
+}
+
+//reset sets the size to 0, the default of a flag without one
+func (b byteSize) reset() {
+	*b.value = 0
+}
+
+func (b byteSize) Set(s string) error {
+	v, err := humanize.ParseBytes(s)
+	if err != nil {
+		return err
+	}
+	*b.value = v
+	return nil
+}
+
+//fileMode is a flag.Value of an octal file mode, such as 0755
+type fileMode struct {
+	value *os.FileMode
+}
+
+func (m fileMode) String() string {
+	if m.value == nil || *m.value == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04o", uint32(*m.value))
+}
+
+//reset sets the mode to 0, the default of a flag without one
+func (m fileMode) reset() {
+	*m.value = 0
+}
+
+func (m fileMode) Set(s string) error {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0777 {
+		return fmt.Errorf("invalid mode '%v', use an octal mode such as 0755", s)
+	}
+	*m.value = os.FileMode(v)
+	return nil
+}
+
+//stringList is a flag.Value of a comma separated list, the flag can also be repeated
+type stringList struct {
+	value *[]string
+}
+
+func (l stringList) String() string {
+	if l.value == nil {
+		return ""
+	}
+	return strings.Join(*l.value, ",")
+}
+
+//reset clears the list, Set appends to it
+func (l stringList) reset() {
+	*l.value = nil
+}
+
+func (l stringList) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			*l.value = append(*l.value, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+)
+
+//keyringService is the service name credentials are stored under in the OS keyring
+const keyringService = "gitmoo-goog"
+
+var (
+	//errKeyringUnavailable is returned when the platform has no usable keyring
+	errKeyringUnavailable = errors.New("OS keyring is not available")
+	//errKeyNotFound is returned when the keyring has no entry for the requested name
+	errKeyNotFound = errors.New("not found in OS keyring")
+)
+
+//readSecret reads a secret from the OS keyring when enabled, falling back to file
+func readSecret(name string, file string) ([]byte, error) {
+	if options.keyring {
+		data, err := keyringGet(name)
+		if err == nil {
+			return data, nil
+		}
+		if err != errKeyNotFound {
+			log.Printf("Unable to read %v from keyring: %v, using %v", name, err, file)
+		}
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if options.keyring {
+		if keyringSet(name, data) == nil {
+			log.Printf("Stored %v in the OS keyring, '%v' is no longer needed", name, file)
+		}
+	}
+	return data, nil
+}
+
+//writeSecret writes a secret to the OS keyring when enabled, falling back to file
+func writeSecret(name string, file string, data []byte) error {
+	if options.keyring {
+		err := keyringSet(name, data)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Unable to store %v in keyring: %v, using %v", name, err, file)
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+//keyringGet reads name from the macOS Keychain
+func keyringGet(name string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 44 {
+			return nil, errKeyNotFound
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, errKeyringUnavailable
+		}
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+//keyringSet writes name to the macOS Keychain. the command is written to security on stdin,
+//so the secret is not in its arguments, visible to every user with ps
+func keyringSet(name string, data []byte) error {
+	if strings.ContainsAny(name, " \"\\\n") {
+		return fmt.Errorf("Invalid keyring name '%v'", name)
+	}
+	secret := base64.StdEncoding.EncodeToString(data)
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %v -a %v -w %v\n", keyringService, name, secret))
+	out, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		return errKeyringUnavailable
+	}
+	if err != nil {
+		return err
+	}
+	//security -i exits with 0 when a command fails, and prints the error after its prompt
+	if msg := strings.TrimSpace(strings.Replace(string(out), "security> ", "", -1)); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
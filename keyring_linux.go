@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os/exec"
+	"strings"
+)
+
+//keyringGet reads name from the Secret Service (GNOME Keyring, KWallet) using secret-tool
+func keyringGet(name string) ([]byte, error) {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, errKeyringUnavailable
+	}
+	out, err := exec.Command(path, "lookup", "service", keyringService, "account", name).Output()
+	if err != nil || len(out) == 0 {
+		return nil, errKeyNotFound
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+}
+
+//keyringSet writes name to the Secret Service using secret-tool
+func keyringSet(name string, data []byte) error {
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return errKeyringUnavailable
+	}
+	cmd := exec.Command(path, "store", "--label", keyringService+" "+name, "service", keyringService, "account", name)
+	cmd.Stdin = bytes.NewBufferString(base64.StdEncoding.EncodeToString(data))
+	return cmd.Run()
+}
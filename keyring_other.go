@@ -0,0 +1,12 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package main
+
+func keyringGet(name string) ([]byte, error) {
+	return nil, errKeyringUnavailable
+}
+
+func keyringSet(name string, data []byte) error {
+	return errKeyringUnavailable
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = 1168
+)
+
+var (
+	advapi32      = syscall.NewLazyDLL("advapi32.dll")
+	procCredRead  = advapi32.NewProc("CredReadW")
+	procCredWrite = advapi32.NewProc("CredWriteW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+//credential mirrors the Win32 CREDENTIALW structure
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+func credTarget(name string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(keyringService + ":" + name)
+}
+
+//keyringGet reads name from the Windows Credential Manager
+func keyringGet(name string) ([]byte, error) {
+	target, err := credTarget(name)
+	if err != nil {
+		return nil, err
+	}
+	var cred *credential
+	r, _, err := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if errno, ok := err.(syscall.Errno); ok && errno == errorNotFound {
+			return nil, errKeyNotFound
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	data := make([]byte, cred.CredentialBlobSize)
+	copy(data, unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	return data, nil
+}
+
+//keyringSet writes name to the Windows Credential Manager
+func keyringSet(name string, data []byte) error {
+	target, err := credTarget(name)
+	if err != nil {
+		return err
+	}
+	user, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(data)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(data) > 0 {
+		cred.CredentialBlob = &data[0]
+	}
+	r, _, err := procCredWrite.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+)
+
+//redirectHost returns the host to use in the redirect URL for a listener on addr
+func redirectHost(addr *net.TCPAddr) string {
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		return fmt.Sprintf("localhost:%v", addr.Port)
+	}
+	return addr.String()
+}
+
+// Request a token using a local redirect listener, the browser is redirected back with the code.
+func getTokenFromLocal(config *oauth2.Config) *oauth2.Token {
+	listener, err := net.Listen("tcp", options.oauthListen)
+	if err != nil {
+		log.Fatalf("Unable to listen on %v for the OAuth redirect: %v", options.oauthListen, err)
+	}
+	defer listener.Close()
+
+	state := make([]byte, 16)
+	rand.Read(state)
+	stateToken := hex.EncodeToString(state)
+
+	redirect := *config
+	redirect.RedirectURL = fmt.Sprintf("http://%v/", redirectHost(listener.Addr().(*net.TCPAddr)))
+	authURL := redirect.AuthCodeURL(stateToken, oauth2.AccessTypeOffline)
+	fmt.Printf("Go to the following link in your browser, you will be redirected to %v: \n%v\n", redirect.RedirectURL, authURL)
+
+	codes := make(chan string, 1)
+	deliver := func(code string) {
+		select {
+		case codes <- code:
+		default:
+		}
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != stateToken {
+			http.Error(w, "Invalid state", http.StatusBadRequest)
+			return
+		}
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			http.Error(w, "Authorization failed: "+r.URL.Query().Get("error"), http.StatusBadRequest)
+			deliver("")
+			return
+		}
+		fmt.Fprintln(w, "gitmoo-goog is authorized, you can close this window.")
+		deliver(code)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	code := <-codes
+	if code == "" {
+		log.Println("Authorization was not granted")
+		os.Exit(exitAuthRequired)
+	}
+	tok, err := redirect.Exchange(oauth2.NoContext, code)
+	if err != nil {
+		log.Fatalf("Unable to retrieve token from web: %v", err)
+	}
+	return tok
+}
@@ -2,19 +2,25 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"sort"
+	"time"
 
+	"github.com/stevedenman/gitmoo-goog/audit"
+	"github.com/stevedenman/gitmoo-goog/cassette"
+	"github.com/stevedenman/gitmoo-goog/control"
 	"github.com/stevedenman/gitmoo-goog/downloader"
+	"github.com/stevedenman/gitmoo-goog/photos"
+	"github.com/stevedenman/gitmoo-goog/restore"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
-	photoslibrary "google.golang.org/api/photoslibrary/v1"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
 
@@ -22,20 +28,63 @@ import (
 const Version = "0.23"
 
 var options struct {
-	loop         bool
-	logfile      string
-	ignoreerrors bool
+	loop            bool
+	logfile         string
+	ignoreerrors    bool
+	auth            string
+	tokenKeyFile    string
+	tokenPassphrase bool
+	keyring         bool
+	tokenFile       string
+	uploadScope     bool
+	oauthListen     string
+	record          string
+	replay          string
+	dumpDir         string
+	traceHTTP       bool
+	dryRun          bool
+	similarity      int
+	controlListen   string
+	configFile      string
+	pidFile         string
+	console         string
+	eventLog        bool
 }
 
 // Retrieve a token, saves the token, then returns the generated client.
-func getClient(config *oauth2.Config) *http.Client {
-	tokFile := "token.json"
+func getClient(config *oauth2.Config) (*http.Client, error) {
+	tokFile := options.tokenFile
 	tok, err := tokenFromFile(tokFile)
-	if err != nil {
-		tok = getTokenFromWeb(config)
+	if err == nil {
+		secret, _ := tokenSecret()
+		if secret != nil && !tokenIsSealed(tokFile) {
+			log.Println("Encrypting existing token cache")
+			saveToken(tokFile, tok)
+		}
+	} else if !isInteractive() {
+		return nil, errAuthRequired
+	} else {
+		tok = getToken(config)
 		saveToken(tokFile, tok)
 	}
-	return config.Client(context.Background(), tok)
+	src := newReauthTokenSource(config, tok)
+	_, err = src.Token()
+	if err != nil {
+		log.Printf("Unable to refresh oauth token: %v", err)
+	}
+	return oauth2.NewClient(context.Background(), src), nil
+}
+
+// Request a new token using the configured authorization flow.
+func getToken(config *oauth2.Config) *oauth2.Token {
+	switch options.auth {
+	case "device":
+		return getTokenFromDevice(config)
+	case "local":
+		return getTokenFromLocal(config)
+	default:
+		return getTokenFromWeb(config)
+	}
 }
 
 // Request a token from the web, then returns the retrieved token.
@@ -46,7 +95,8 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+		log.Printf("Unable to read authorization code: %v", err)
+		os.Exit(exitAuthRequired)
 	}
 
 	tok, err := config.Exchange(oauth2.NoContext, authCode)
@@ -58,57 +108,266 @@ func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
 
 // Retrieves a token from a local file.
 func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
-	defer f.Close()
+	data, err := readSecret("token", file)
 	if err != nil {
 		return nil, err
 	}
+	data, err = openToken(data)
+	if err != nil {
+		log.Fatalf("Unable to read oauth token: %v", err)
+	}
 	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
+	err = json.Unmarshal(data, tok)
 	return tok, err
 }
 
 // Saves a token to a file path.
 func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	defer f.Close()
+	if options.keyring {
+		fmt.Println("Saving credential to the OS keyring")
+	} else {
+		fmt.Printf("Saving credential file to: %s\n", path)
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		log.Fatalf("Unable to cache oauth token: %v", err)
+	}
+	secret, err := tokenSecret()
+	if err != nil {
+		log.Fatalf("Unable to cache oauth token: %v", err)
+	}
+	if secret != nil {
+		data, err = sealToken(secret, data)
+		if err != nil {
+			log.Fatalf("Unable to encrypt oauth token: %v", err)
+		}
+	}
+	err = writeSecret("token", path, data)
 	if err != nil {
 		log.Fatalf("Unable to cache oauth token: %v", err)
 	}
-	json.NewEncoder(f).Encode(token)
 }
 
-func process() error {
-	b, err := ioutil.ReadFile("credentials.json")
+// Creates an authorized photos client with the requested scopes.
+func connect(scopes ...string) (*photos.Client, error) {
+	client, err := apiClient(scopes...)
+	if err != nil {
+		return nil, err
+	}
+	if options.traceHTTP {
+		client.Transport = traceTransport("api", client.Transport)
+		downloader.Options.Transport = traceTransport("media", downloader.Options.Transport)
+	}
+	log.Printf("Connecting ...")
+	srv := photos.New(client)
+	srv.DumpDir = options.dumpDir
+	return srv, nil
+}
+
+//scopes returns the OAuth scopes to request: viewing the library, and adding to it with -upload-scope
+func scopes() []string {
+	if options.uploadScope {
+		return []string{photos.ReadonlyScope, photos.AppendonlyScope}
+	}
+	return []string{photos.ReadonlyScope}
+}
+
+//authorize runs the authorization flow when the token is missing or no longer valid, and saves
+//the token without backing up. a daemon waiting for re-authorization resumes with it
+func authorize() error {
+	_, err := apiClient(scopes()...)
+	if err != nil {
+		return err
+	}
+	log.Printf("Authorized, the token is in '%v'", options.tokenFile)
+	return nil
+}
+
+//apiClient returns the HTTP client of the API calls, authorized for scopes or replaying a recording
+func apiClient(scopes ...string) (*http.Client, error) {
+	if options.replay != "" {
+		tape, err := cassette.Replay(options.replay)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open the recording: %v", err)
+		}
+		log.Printf("Replaying the recording in '%v'", options.replay)
+		downloader.Options.Transport = tape.Transport(nil)
+		return &http.Client{Transport: tape.Transport(nil)}, nil
+	}
+	b, err := readSecret("credentials", "credentials.json")
 	if err != nil {
 		log.Println("Enable photos API here: https://developers.google.com/photos/library/guides/get-started#enable-the-api")
-		return fmt.Errorf("Unable to read client secret file: %v", err)
+		return nil, fmt.Errorf("Unable to read client secret file: %v", err)
 	}
 
-	//request photos readonly access
-	config, err := google.ConfigFromJSON(b, "https://www.googleapis.com/auth/photoslibrary.readonly")
+	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
-		return fmt.Errorf("Unable to parse client secret file to config: %v", err)
+		return nil, fmt.Errorf("Unable to parse client secret file to config: %v", err)
 	}
-	client := getClient(config)
-	log.Printf("Connecting ...")
-	srv, err := photoslibrary.New(client)
+	client, err := getClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if options.record != "" {
+		tape, err := cassette.Record(options.record)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to start recording: %v", err)
+		}
+		log.Printf("Recording the API and media traffic to '%v'", options.record)
+		client.Transport = tape.Transport(client.Transport)
+		downloader.Options.Transport = tape.Transport(downloader.Options.Transport)
+	}
+	return client, nil
+}
+
+func process() error {
+	var err error
+	if options.eventLog {
+		events, err = openEventLog(eventSource)
+		if err != nil {
+			return fmt.Errorf("Unable to open the event log: %v", err)
+		}
+		defer events.close()
+	}
+	srv, err := connect(scopes()...)
+	if err != nil {
+		reportRun(nil, err)
+		return err
+	}
+	//taken once authorized, an instance authorizing does not hold it
+	removePIDFile, err := writePIDFile()
 	if err != nil {
-		return fmt.Errorf("Unable to retrieve client: %v", err)
+		return err
+	}
+	defer removePIDFile()
+	stopped := handleStopSignal()
+	handlePauseSignals()
+	handleReloadSignal()
+	if options.controlListen != "" {
+		err = control.Serve(options.controlListen)
+		if err != nil {
+			return fmt.Errorf("Unable to start the control service: %v", err)
+		}
 	}
 	for true {
-		err := downloader.DownloadAll(srv)
+		reloadConfig()
+		control.SetRunning(true)
+		result, err := downloader.DownloadAll(srv)
+		control.SetRunning(false)
+		reportRun(result, err)
+		if errors.Is(err, downloader.ErrStopped) {
+			return err
+		}
+		var failed downloader.ItemErrors
+		if errors.As(err, &failed) {
+			if !options.loop {
+				return err
+			}
+			//item errors were logged and counted, the next run retries them
+			err = nil
+		}
 		if err != nil {
-			if options.ignoreerrors {
+			if options.ignoreerrors && !downloader.IsDiskFull(err) {
 				log.Println(err)
 			} else {
 				return err
 			}
 		}
 		if !options.loop {
+			if options.controlListen == "" {
+				break
+			}
+			log.Println("Waiting for a Start request of the control service")
+			select {
+			case <-control.Starts():
+			case <-stopped:
+				return downloader.ErrStopped
+			}
+		}
+	}
+	return nil
+}
+
+// Uploads the backup folder, or the given sub folders, back to Google Photos.
+func restoreArchive(folders []string) error {
+	if !options.uploadScope {
+		return fmt.Errorf("Restore uploads to the library, run it with -upload-scope to authorize it (delete '%v' if it was authorized read-only)", options.tokenFile)
+	}
+	srv, err := connect(scopes()...)
+	if err != nil {
+		return err
+	}
+	restore.Options.BackupFolder = downloader.Options.BackupFolder
+	restore.Options.Throttle = downloader.Options.Throttle
+	err = restore.Restore(srv, folders)
+	var apiErr *photos.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+		log.Printf("The token in '%v' may not allow uploads, delete it and authorize again with -upload-scope", options.tokenFile)
+	}
+	return err
+}
+
+//auditArchive checks the backup folder, offline
+func auditArchive() error {
+	audit.Options.BackupFolder = downloader.Options.BackupFolder
+	report, err := audit.Audit()
+	if err != nil {
+		return err
+	}
+	report.Log()
+	return nil
+}
+
+func planBackup() error {
+	srv, err := connect(scopes()...)
+	if err != nil {
+		return err
+	}
+	report, err := downloader.Plan(srv)
+	if err != nil {
+		return err
+	}
+	report.Log()
+	return nil
+}
+
+//statusFailures is the number of pending failures listed by status
+const statusFailures = 20
+
+func showStatus() error {
+	lifetime, err := downloader.ReadLifetime()
+	if err != nil {
+		return err
+	}
+	lifetime.Log()
+	catalog, err := downloader.ReadCatalog()
+	if err != nil {
+		return err
+	}
+	catalog.Log()
+	failures, err := downloader.ReadFailures()
+	if err != nil {
+		return err
+	}
+	if len(failures) == 0 {
+		log.Println("Pending failures: none")
+		return nil
+	}
+	ids := make([]string, 0, len(failures))
+	for id := range failures {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return failures[ids[i]].Since.Before(failures[ids[j]].Since)
+	})
+	log.Printf("Pending failures: %v items, retried by the next runs", len(failures))
+	for i, id := range ids {
+		if i == statusFailures {
+			log.Printf("  and %v more", len(ids)-i)
 			break
 		}
+		f := failures[id]
+		log.Printf("  %v '%v', failing since %v (%v runs): %v", id, f.Path, f.Since.Format("2 Jan 2006"), f.Attempts, f.Error)
 	}
 	return nil
 }
@@ -116,15 +375,114 @@ func process() error {
 func main() {
 	log.Println("This is gitmoo-goog ver", Version)
 	flag.BoolVar(&options.loop, "loop", false, "loops forever (use as daemon)")
+	flag.StringVar(&options.configFile, "config", "", "read the options from this file, one 'name = value' per line, the command line takes precedence. reloaded on SIGHUP between runs")
+	flag.StringVar(&options.console, "console", downloader.ConsoleAuto, "log to the terminal in colors with aligned columns: auto (when the output is a terminal), rich or plain")
+	flag.StringVar(&options.controlListen, "control-listen", "", "serve the gRPC control service (start, pause, progress) on this address, such as 127.0.0.1:9090")
+	flag.BoolVar(&options.eventLog, "event-log", false, "on Windows, also write the summary and the errors of every run to the Application event log, for monitoring")
 	flag.BoolVar(&options.ignoreerrors, "force", false, "ignore errors, and force working")
+	flag.StringVar(&options.pidFile, "pid-file", "", "write the PID of the running instance to this file, used by stop and reload (default [folder]/.gitmoo/gitmoo.pid)")
 	flag.StringVar(&options.logfile, "logfile", "", "log to this file")
+	flag.IntVar(&options.similarity, "similarity", audit.DefaultSimilarity, "with similar, how many bits (of 64) the perceptual hashes of similar photos can differ by")
+	flag.BoolVar(&options.dryRun, "dry-run", false, "with clean, only list what would be removed; with reorganize, hard link the new layout in [folder]-preview")
+	flag.StringVar(&options.tokenKeyFile, "token-keyfile", "", "encrypt the token cache with the contents of this file")
+	flag.BoolVar(&options.tokenPassphrase, "token-passphrase", false, "encrypt the token cache with a passphrase (prompted, or from $"+passphraseEnv+")")
+	flag.BoolVar(&options.keyring, "keyring", false, "keep credentials and token in the OS keyring when available")
+	flag.StringVar(&options.auth, "auth", "web", "authorization flow: 'web' (paste code from browser), 'local' (redirect to a local listener) or 'device' (enter code on another device, Google may refuse the Google Photos scopes: use 'local')")
+	flag.StringVar(&options.oauthListen, "oauth-listen", "127.0.0.1:8085", "interface and port of the local OAuth redirect listener (-auth local)")
+	flag.StringVar(&options.tokenFile, "token", "token.json", "OAuth token file")
+	flag.BoolVar(&options.uploadScope, "upload-scope", false, "also request permission to add to the library, needed by restore. without it, only read-only access is requested")
+	flag.StringVar(&options.dumpDir, "debug-dump-dir", "", "write the raw response of every API call to this folder")
+	flag.BoolVar(&options.traceHTTP, "trace-http", false, "log every API and media request: method, URL (redacted), status and latency")
+	flag.StringVar(&options.record, "record", "", "record the API and media traffic to this folder, for -replay")
+	flag.StringVar(&options.replay, "replay", "", "replay the traffic recorded with -record in this folder, offline and without credentials")
 	flag.StringVar(&downloader.Options.BackupFolder, "folder", "", "backup folder")
-	flag.StringVar(&downloader.Options.AlbumID, "album", "", "download only from this album (use google album id)")
+	flag.Var(stringList{&downloader.Options.AlbumIDs}, "album", "download only from these albums (comma separated google album ids)")
+	flag.IntVar(&downloader.Options.AlbumMax, "album-max", 0, "max items to process per album")
+	flag.IntVar(&downloader.Options.AlbumWorkers, "album-workers", 1, "number of albums searched at the same time")
 	flag.IntVar(&downloader.Options.MaxItems, "max", math.MaxInt32, "max items to download")
+	flag.IntVar(&downloader.Options.Workers, "workers", 1, "number of concurrent downloads")
+	flag.BoolVar(&downloader.Options.LowMemory, "low-memory", false, "use as little memory as possible, for a Raspberry Pi or a small NAS: one download at a time, smaller buffers and the hash index on disk")
+	flag.BoolVar(&downloader.Options.AutoWorkers, "auto-workers", false, "tune the number of concurrent downloads (up to -workers) from the throughput, halving it when downloads are rate limited")
 	flag.IntVar(&downloader.Options.PageSize, "pagesize", 50, "number of items to download on per API call")
 	flag.IntVar(&downloader.Options.Throttle, "throttle", 5, "Time, in seconds, to wait between API calls")
+	flag.StringVar(&downloader.Options.Quality, "quality", "original", "photo quality: original, high, or wNNNN to limit width and height to NNNN pixels")
+	flag.StringVar(&downloader.Options.Raw, "raw", "include", "camera RAW files (DNG, CR2, NEF...): include, skip or only")
+	flag.StringVar(&downloader.Options.RawFolder, "raw-folder", "", "sub folder for camera RAW files")
+	flag.BoolVar(&downloader.Options.HTMLReport, "html-report", false, "write a status page of the run and of the past runs to [folder]/report.html, for people who do not read logs")
+	flag.StringVar(&downloader.Options.Report, "report", "", "write the result of the run (totals, failures and per album statistics) to this file as JSON")
+	flag.BoolVar(&downloader.Options.ConvertHEIC, "heic-to-jpeg", false, "convert HEIC/HEIF photos to JPEG (requires heif-convert, ImageMagick or sips)")
+	flag.BoolVar(&downloader.Options.KeepHEIC, "keep-heic", false, "keep the original HEIC file when converting to JPEG")
+	flag.StringVar(&downloader.Options.Validate, "validate", "", "check downloaded photos are valid images: 'header' or 'full' (decode the whole image)")
+	flag.BoolVar(&downloader.Options.Probe, "ffprobe", false, "check downloaded videos with ffprobe (FFmpeg), when it is installed")
+	flag.BoolVar(&downloader.Options.Quarantine, "quarantine", true, "move downloads failing validation to [folder]/quarantine instead of deleting them")
+	flag.StringVar(&downloader.Options.Relocate, "relocate", downloader.RelocateMove, "what to do with a file saved at another path by an earlier run, such as with another -layout: move it, link it (hard link) or off to download it again")
+	flag.StringVar(&downloader.Options.Layout, "layout", "date", "file layout: 'date', 'hash' (legacy) or a template of {year} {month} {mm} {day} {dd} {id} {id8} {filename}")
+	flag.Var(fileMode{&downloader.Options.DirMode}, "dir-mode", "mode of the created folders, such as 0755 (default 0700 with the umask)")
+	flag.Var(fileMode{&downloader.Options.FileMode}, "file-mode", "mode of the created files, such as 0644 (default 0644 with the umask)")
+	flag.BoolVar(&downloader.Options.Fsync, "fsync", false, "flush every file to the disk once written, for removable and network drives")
+	flag.BoolVar(&downloader.Options.StripGPS, "strip-gps", false, "erase the location from the metadata of downloaded photos (JPEG and converted HEIC)")
+	flag.BoolVar(&downloader.Options.WriteDescription, "write-description", false, "write the descriptions of photos in their EXIF ImageDescription (JPEG only, not the IPTC caption)")
+	flag.BoolVar(&downloader.Options.Xattr, "xattr", false, "store the item id, creation time and albums in extended attributes of the files")
+	flag.StringVar(&downloader.Options.Owner, "owner", "", "give the created files and folders to uid:gid, such as 1000:1000 (needs root)")
+	flag.BoolVar(&downloader.Options.ExifTime, "exif-time", false, "name photos after their EXIF capture time when the creation time is missing or more than 2 days off")
+	flag.StringVar(&downloader.Options.Timezone, "timezone", "utc", "time zone of the dates in file names: 'utc', 'local', a zone such as 'Europe/Paris' or an offset such as '+05:30'")
+	flag.StringVar(&downloader.Options.Normalize, "normalize", "nfc", "unicode normalization of file names: 'nfc', or 'nfd' for archives kept on macOS HFS+")
+	flag.StringVar(&downloader.Options.Filesystem, "filesystem", "windows", "target filesystem of names from the library: 'windows' (also valid on SMB and exFAT) or 'posix'")
+	flag.BoolVar(&downloader.Options.Motion, "motion", false, "also save the video part of motion photos and live photos")
+	flag.StringVar(&downloader.Options.MediaType, "type", "all", "media to download: all, photo or video")
+	flag.StringVar(&downloader.Options.Shards, "shards", "", "search the library by 'year' or 'month', several shards at a time")
+	flag.StringVar(&downloader.Options.Shard, "shard", "", "back up the slice i/N of the library, such as 2/4 on the second of 4 machines sharing the backup folder")
+	flag.StringVar(&downloader.Options.ShardBy, "shard-by", "id", "split the library for -shard by item 'id' or by month of creation 'date'")
+	flag.IntVar(&downloader.Options.ShardWorkers, "shard-workers", 4, "number of shards searched at the same time, with -shards")
+	flag.StringVar(&downloader.Options.Enumerate, "enumerate", "search", "API call listing the whole library: 'search' (mediaItems.search) or 'list' (mediaItems.list)")
+	flag.Var(byteSize{&downloader.Options.MaxFileSize}, "max-file-size", "skip files larger than this size (e.g. 2GB)")
+	flag.IntVar(&downloader.Options.MinWidth, "min-width", 0, "skip photos narrower than this (pixels)")
+	flag.IntVar(&downloader.Options.MinHeight, "min-height", 0, "skip photos lower than this (pixels)")
+	flag.DurationVar(&downloader.Options.MinDuration, "min-duration", 0, "skip videos shorter than this (e.g. 3s)")
+	flag.DurationVar(&downloader.Options.MaxDuration, "max-duration", 0, "skip videos longer than this (e.g. 1h)")
+	flag.Var(stringList{&downloader.Options.Cameras}, "camera", "download only media from these cameras, comma separated 'make model' patterns (e.g. 'Canon*')")
+	flag.Var(stringList{&downloader.Options.ExcludeCameras}, "exclude-camera", "skip media from these cameras, comma separated 'make model' patterns")
+	flag.Var(stringList{&downloader.Options.IncludeMime}, "include-mime", "download only these mime types, comma separated patterns (e.g. 'image/*')")
+	flag.Var(stringList{&downloader.Options.ExcludeMime}, "exclude-mime", "skip these mime types, comma separated patterns (e.g. 'image/gif')")
+	flag.StringVar(&downloader.Options.Order, "order", "", "process the library 'newest' or 'oldest' first (searching year by year)")
+	flag.IntVar(&downloader.Options.Sample, "sample", 0, "download only this many items, picked at random across the library")
+	flag.BoolVar(&downloader.Options.CheckRemote, "check-remote", false, "request the media of every item, even when the hash index shows it is downloaded, to detect changed files")
+	flag.BoolVar(&downloader.Options.VerifyHash, "verify-hash", false, "check existing files against their hash in the index (reading them), to download again damaged files of the same size")
+	flag.BoolVar(&downloader.Options.CountFirst, "count", false, "count the library items first, to show an estimated completion time")
+	flag.IntVar(&downloader.Options.LibraryTotal, "library-total", 0, "the number of items Google Photos shows for the library, to report how many the API did not return")
+	flag.IntVar(&downloader.Options.Parity, "parity", 0, "create par2 parity files of this percentage of the size of every folder, to repair damaged files (requires par2cmdline), 0 for none")
+	flag.StringVar(&downloader.Options.CAS, "cas", "", "keep the media files once by content in this object store folder, the materialize command links them back in a tree")
+	flag.Var(stringList{&downloader.Options.Mirrors}, "mirror", "also copy the downloaded files to these folders (comma separated), a file is downloaded once for all of them")
+	flag.StringVar(&downloader.Options.Feed, "feed", "", "write the items downloaded by the last runs to this file as an Atom feed, for feed readers")
+	flag.BoolVar(&downloader.Options.Dashboard, "dashboard", false, "show a full screen view of the run (throughput, workers, errors) instead of the log, in a terminal")
+	flag.BoolVar(&downloader.Options.IncludePartner, "partner", false, "also download the media of the albums shared with you (the API does not return partner sharing)")
+	flag.BoolVar(&downloader.Options.AlbumManifests, "album-manifests", false, "write a manifest of every album, used to recreate albums on restore")
+	flag.BoolVar(&downloader.Options.AlbumOrder, "album-order", false, "link the files of every album in [folder]-albums/[title], prefixed with their position in the album")
+	flag.StringVar(&downloader.Options.PartnerFolder, "partner-folder", "", "sub folder (of the backup folder) for shared media")
+	flag.DurationVar(&downloader.Options.StallTimeout, "stall-timeout", time.Minute, "abort a download that received no data for this long, 0 to wait forever")
+	flag.IntVar(&downloader.Options.DailyQuota, "daily-quota", 0, "API calls allowed per day (the quota resets at midnight Pacific time), the run stops when they are used up, 0 for no limit")
+	flag.BoolVar(&downloader.Options.QuotaWait, "quota-wait", false, "with -daily-quota, wait for the quota to reset instead of stopping the run")
+	flag.IntVar(&downloader.Options.Breaker, "breaker", 10, "pause (from 1 minute, doubled up to 30 minutes) after this many failed downloads or API calls in a row, 0 to never pause")
+	flag.StringVar(&downloader.Options.MaxErrors, "max-errors", "", "stop the run after this many failed items, or this percentage of the processed items (e.g. 5%)")
+	flag.DurationVar(&downloader.Options.ItemTimeout, "item-timeout", 0, "abort a download taking longer than this (e.g. 2h), the item is retried by the next run, 0 for no limit")
+	flag.StringVar(&downloader.Options.Thumbnails, "thumbnails", "", "also download thumbnails of the items into this folder, in the same tree as the backup folder")
+	flag.IntVar(&downloader.Options.ThumbnailSize, "thumbnail-size", 512, "max width and height of the thumbnails (pixels)")
+	flag.BoolVar(&downloader.Options.ThumbnailsOnly, "thumbnails-only", false, "with -thumbnails, download only the thumbnails and the metadata, not the full size media")
+	flag.IntVar(&downloader.Options.StallRetries, "stall-retries", 3, "how many times to retry a stalled, truncated or invalid download")
+	downloader.Options.DiskReserve = 1e9
+	flag.Var(byteSize{&downloader.Options.MaxRate}, "max-rate", "limit the downloads to this many bytes per second (e.g. 1MB) outside the windows of -schedule")
+	flag.StringVar(&downloader.Options.Schedule, "schedule", "", "comma separated windows of the day (local time) with their own download rate and workers, such as 01:00-07:00=0/8,09:00-18:00=500KB/1")
+	flag.Var(byteSize{&downloader.Options.MaxWriteRate}, "max-write-rate", "limit disk writes to this many bytes per second (e.g. 20MB), separate from the network speed")
+	flag.Var(byteSize{&downloader.Options.DiskReserve}, "disk-reserve", "free space to keep on the backup disk, the run stops before going below it, 0 to disable")
 
 	flag.Parse()
+	if options.configFile != "" {
+		err := applyConfig(options.configFile)
+		if err != nil {
+			log.Println(err)
+			os.Exit(exitFatal)
+		}
+	}
 	if options.logfile != "" {
 		log.SetOutput(&lumberjack.Logger{
 			Filename:   options.logfile,
@@ -134,11 +492,78 @@ func main() {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Println(r)
+				os.Exit(exitFatal)
 			}
 		}()
+	} else {
+		out, err := downloader.NewConsole(options.console, os.Stderr)
+		if err != nil {
+			log.Println(err)
+			os.Exit(exitFatal)
+		}
+		log.SetOutput(out)
+	}
+	var err error
+	switch flag.Arg(0) {
+	case "restore":
+		err = restoreArchive(flag.Args()[1:])
+	case "audit":
+		err = auditArchive()
+	case "status":
+		err = showStatus()
+	case "plan":
+		err = planBackup()
+	case "auth":
+		err = authorize()
+	case "doctor":
+		err = runDoctor()
+	case "dupes":
+		audit.Options.BackupFolder = downloader.Options.BackupFolder
+		var report *audit.DupesReport
+		report, err = audit.Dupes()
+		if err == nil {
+			report.Log()
+		}
+	case "similar":
+		audit.Options.BackupFolder = downloader.Options.BackupFolder
+		audit.Options.Similarity = options.similarity
+		var report *audit.SimilarReport
+		report, err = audit.Similar()
+		if err == nil {
+			report.Log()
+		}
+	case "clean":
+		audit.Options.BackupFolder = downloader.Options.BackupFolder
+		audit.Options.DryRun = options.dryRun
+		err = audit.Clean()
+	case "materialize":
+		target := flag.Arg(1)
+		if target == "" {
+			target = downloader.Options.BackupFolder + "-tree"
+		}
+		err = downloader.Materialize(target)
+	case "verify-parity":
+		_, err = downloader.VerifyParity()
+	case "contact-sheets":
+		audit.Options.BackupFolder = downloader.Options.BackupFolder
+		var report *audit.SheetsReport
+		report, err = audit.Sheets()
+		if err == nil {
+			report.Log()
+		}
+	case "reorganize":
+		audit.Options.BackupFolder = downloader.Options.BackupFolder
+		audit.Options.DryRun = options.dryRun
+		err = audit.Reorganize()
+	case "stop", "reload":
+		err = signalDaemon(flag.Arg(0))
+	case "":
+		err = process()
+	default:
+		err = fmt.Errorf("Unknown command '%v'", flag.Arg(0))
 	}
-	err := process()
 	if err != nil {
 		log.Println(err)
 	}
+	os.Exit(exitCode(err))
 }
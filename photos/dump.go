@@ -0,0 +1,37 @@
+package photos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//dumpSeq numbers the dumped responses, keeping them in order
+var dumpSeq int64
+
+//dump writes the raw request and response bodies of an API call to c.DumpDir
+func (c *Client) dump(method string, path string, request []byte, status int, response []byte) {
+	err := os.MkdirAll(c.DumpDir, 0700)
+	if err != nil {
+		log.Printf("Unable to create dump folder: %v", err)
+		return
+	}
+	endpoint := strings.NewReplacer("/", "-", ":", "-").Replace(path)
+	name := fmt.Sprintf("%v-%06d-%v-%v-%v", time.Now().Format("20060102-150405"), atomic.AddInt64(&dumpSeq, 1), method, endpoint, status)
+	name = filepath.Join(c.DumpDir, name)
+	if len(request) > 0 {
+		err = ioutil.WriteFile(name+".request.json", request, 0600)
+		if err != nil {
+			log.Printf("Unable to dump request: %v", err)
+		}
+	}
+	err = ioutil.WriteFile(name+".json", response, 0600)
+	if err != nil {
+		log.Printf("Unable to dump response: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+//Package photos is a small client for the Google Photos Library REST API (v1).
+//
+//It covers only the calls gitmoo-goog needs, and replaces the generated
+//google.golang.org/api/photoslibrary/v1 package that is no longer published.
+package photos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+//BasePath is the API endpoint base URL
+const BasePath = "https://photoslibrary.googleapis.com/v1/"
+
+//OAuth2 scopes used by the Photos Library API
+const (
+	//ReadonlyScope views the Google Photos library
+	ReadonlyScope = "https://www.googleapis.com/auth/photoslibrary.readonly"
+	//AppendonlyScope adds to the Google Photos library
+	AppendonlyScope = "https://www.googleapis.com/auth/photoslibrary.appendonly"
+	//SharingScope manages and adds to shared albums
+	SharingScope = "https://www.googleapis.com/auth/photoslibrary.sharing"
+)
+
+//Library is the part of the Photos Library API used by the downloader
+type Library interface {
+	//SearchMediaItems searches for media items in the library or an album
+	SearchMediaItems(req *SearchMediaItemsRequest) (*SearchMediaItemsResponse, error)
+	//ListMediaItems lists all media items of the library, without filters
+	ListMediaItems(pageSize int64, pageToken string) (*ListMediaItemsResponse, error)
+	//ListAlbums lists albums shown in the Albums tab
+	ListAlbums(pageToken string) (*ListAlbumsResponse, error)
+	//GetAlbum returns an album by ID
+	GetAlbum(id string) (*Album, error)
+	//ListSharedAlbums lists albums shared with the user
+	ListSharedAlbums(pageToken string) (*ListSharedAlbumsResponse, error)
+	//BatchGetMediaItems returns up to MaxBatchGet media items by ID
+	BatchGetMediaItems(ids []string) (*BatchGetMediaItemsResponse, error)
+}
+
+//Client calls the Photos Library API over HTTP, it implements Library and Uploader
+type Client struct {
+	client *http.Client
+	//BasePath is the API endpoint base URL
+	BasePath string
+	//DumpDir is a folder where the raw bodies of every API call are written, empty to disable
+	DumpDir string
+}
+
+//New creates a client, client should add OAuth2 credentials to requests
+func New(client *http.Client) *Client {
+	return &Client{client: client, BasePath: BasePath}
+}
+
+//Error is an error returned by the API
+type Error struct {
+	//Code is the HTTP status code
+	Code int `json:"code"`
+	//Message describes the error
+	Message string `json:"message"`
+	//Status is the canonical error status, such as RESOURCE_EXHAUSTED
+	Status string `json:"status"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("photos: Error %v: %v", e.Code, e.Message)
+}
+
+//ErrRateLimited matches (with errors.Is) API errors caused by exceeding the request quota
+var ErrRateLimited = errors.New("photos: rate limited")
+
+//Is reports whether the error is in the class of target, such as ErrRateLimited
+func (e *Error) Is(target error) bool {
+	return target == ErrRateLimited && (e.Code == http.StatusTooManyRequests || e.Status == "RESOURCE_EXHAUSTED")
+}
+
+func (c *Client) do(method string, path string, query url.Values, body interface{}, out interface{}) error {
+	u := c.BasePath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if c.DumpDir != "" {
+		c.dump(method, path, b, resp.StatusCode, data)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := struct {
+			Error *Error `json:"error"`
+		}{}
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == nil {
+			return &Error{Code: resp.StatusCode, Message: resp.Status}
+		}
+		apiErr.Error.Code = resp.StatusCode
+		return apiErr.Error
+	}
+	return json.Unmarshal(data, out)
+}
+
+//SearchMediaItems implements Library
+func (c *Client) SearchMediaItems(req *SearchMediaItemsRequest) (*SearchMediaItemsResponse, error) {
+	resp := &SearchMediaItemsResponse{}
+	err := c.do("POST", "mediaItems:search", nil, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+//ListMediaItems implements Library
+func (c *Client) ListMediaItems(pageSize int64, pageToken string) (*ListMediaItemsResponse, error) {
+	query := url.Values{"pageSize": {strconv.FormatInt(pageSize, 10)}}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	resp := &ListMediaItemsResponse{}
+	err := c.do("GET", "mediaItems", query, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func pageQuery(pageToken string) url.Values {
+	query := url.Values{"pageSize": {strconv.Itoa(50)}}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	return query
+}
+
+//ListAlbums implements Library
+func (c *Client) ListAlbums(pageToken string) (*ListAlbumsResponse, error) {
+	resp := &ListAlbumsResponse{}
+	err := c.do("GET", "albums", pageQuery(pageToken), nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+//GetAlbum implements Library
+func (c *Client) GetAlbum(id string) (*Album, error) {
+	album := &Album{}
+	err := c.do("GET", "albums/"+id, nil, nil, album)
+	if err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+//ListSharedAlbums implements Library
+func (c *Client) ListSharedAlbums(pageToken string) (*ListSharedAlbumsResponse, error) {
+	resp := &ListSharedAlbumsResponse{}
+	err := c.do("GET", "sharedAlbums", pageQuery(pageToken), nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,268 @@
+//Package photostest provides an in memory photos.Library, so code using the library can be
+//exercised against fixtures without credentials or network access
+package photostest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//Library is a fake photos.Library serving the items and albums of a fixture.
+//it is safe for concurrent use
+type Library struct {
+	//Items are the library items, in the order returned by an unfiltered search
+	Items []*photos.MediaItem `json:"items"`
+	//Albums are the albums of the library
+	Albums []*photos.Album `json:"albums,omitempty"`
+	//SharedAlbums are the albums shared with the account
+	SharedAlbums []*photos.Album `json:"sharedAlbums,omitempty"`
+	//AlbumItems are the item IDs of every album, by album ID
+	AlbumItems map[string][]string `json:"albumItems,omitempty"`
+	//Shared are items only visible through a shared album, returned when searching the album
+	Shared []*photos.MediaItem `json:"shared,omitempty"`
+
+	mu sync.Mutex
+	//Calls counts the calls of every method, by method name
+	Calls map[string]int `json:"-"`
+}
+
+var _ photos.Library = (*Library)(nil)
+
+//Load reads a fixture saved by Save
+func Load(fileName string) (*Library, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	l := &Library{}
+	err = json.Unmarshal(data, l)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse fixture %v: %v", fileName, err)
+	}
+	return l, nil
+}
+
+//Save writes the library as a fixture
+func (l *Library) Save(fileName string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+func (l *Library) called(method string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.Calls == nil {
+		l.Calls = make(map[string]int)
+	}
+	l.Calls[method]++
+}
+
+//item returns an item of the library or of a shared album by ID
+func (l *Library) item(id string) *photos.MediaItem {
+	for _, items := range [][]*photos.MediaItem{l.Items, l.Shared} {
+		for _, m := range items {
+			if m.ID == id {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+//page returns the page of items starting at the offset in pageToken
+func page(items []*photos.MediaItem, pageSize int64, pageToken string) ([]*photos.MediaItem, string, error) {
+	start := 0
+	if pageToken != "" {
+		var err error
+		start, err = strconv.Atoi(pageToken)
+		if err != nil || start < 0 || start > len(items) {
+			return nil, "", &photos.Error{Code: 400, Message: "invalid page token", Status: "INVALID_ARGUMENT"}
+		}
+	}
+	if pageSize <= 0 {
+		pageSize = 25
+	}
+	end := start + int(pageSize)
+	if end >= len(items) {
+		return items[start:], "", nil
+	}
+	return items[start:end], strconv.Itoa(end), nil
+}
+
+//SearchMediaItems implements photos.Library, with the album, media type and date filters and the order
+func (l *Library) SearchMediaItems(req *photos.SearchMediaItemsRequest) (*photos.SearchMediaItemsResponse, error) {
+	l.called("SearchMediaItems")
+	var items []*photos.MediaItem
+	if req.AlbumID != "" {
+		if req.Filters != nil {
+			return nil, &photos.Error{Code: 400, Message: "filters can not be set with an album id", Status: "INVALID_ARGUMENT"}
+		}
+		for _, id := range l.AlbumItems[req.AlbumID] {
+			m := l.item(id)
+			if m != nil {
+				items = append(items, m)
+			}
+		}
+	} else {
+		for _, m := range l.Items {
+			if matches(m, req.Filters) {
+				items = append(items, m)
+			}
+		}
+	}
+	if req.OrderBy != "" {
+		if req.Filters == nil || req.Filters.DateFilter == nil {
+			return nil, &photos.Error{Code: 400, Message: "orderBy requires a date filter", Status: "INVALID_ARGUMENT"}
+		}
+		desc := strings.HasSuffix(req.OrderBy, " desc")
+		sort.SliceStable(items, func(i, j int) bool {
+			if desc {
+				return items[i].MediaMetadata.CreationTime > items[j].MediaMetadata.CreationTime
+			}
+			return items[i].MediaMetadata.CreationTime < items[j].MediaMetadata.CreationTime
+		})
+	}
+	result, next, err := page(items, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &photos.SearchMediaItemsResponse{MediaItems: result, NextPageToken: next}, nil
+}
+
+//matches reports whether m passes the media type and date filters
+func matches(m *photos.MediaItem, f *photos.Filters) bool {
+	if f == nil {
+		return true
+	}
+	if f.MediaTypeFilter != nil {
+		for _, t := range f.MediaTypeFilter.MediaTypes {
+			if t == "PHOTO" && m.MediaMetadata.Photo == nil || t == "VIDEO" && m.MediaMetadata.Video == nil {
+				return false
+			}
+		}
+	}
+	if f.DateFilter != nil {
+		t, err := time.Parse(time.RFC3339, m.MediaMetadata.CreationTime)
+		if err != nil {
+			return false
+		}
+		for _, d := range f.DateFilter.Dates {
+			if onDate(t, d) {
+				return true
+			}
+		}
+		for _, r := range f.DateFilter.Ranges {
+			if (r.StartDate == nil || !t.Before(firstInstant(r.StartDate))) && (r.EndDate == nil || t.Before(firstInstant(r.EndDate).AddDate(0, 0, 1))) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+//onDate reports whether t is on d, zero fields of d match any value
+func onDate(t time.Time, d *photos.Date) bool {
+	return (d.Year == 0 || t.Year() == d.Year) && (d.Month == 0 || int(t.Month()) == d.Month) && (d.Day == 0 || t.Day() == d.Day)
+}
+
+//firstInstant returns the first instant of d
+func firstInstant(d *photos.Date) time.Time {
+	month, day := d.Month, d.Day
+	if month == 0 {
+		month = 1
+	}
+	if day == 0 {
+		day = 1
+	}
+	return time.Date(d.Year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+//ListMediaItems implements photos.Library, the items are in the order of an unfiltered search
+func (l *Library) ListMediaItems(pageSize int64, pageToken string) (*photos.ListMediaItemsResponse, error) {
+	l.called("ListMediaItems")
+	items, next, err := page(l.Items, pageSize, pageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &photos.ListMediaItemsResponse{MediaItems: items, NextPageToken: next}, nil
+}
+
+//ListAlbums implements photos.Library
+func (l *Library) ListAlbums(pageToken string) (*photos.ListAlbumsResponse, error) {
+	l.called("ListAlbums")
+	albums, next, err := albumPage(l.Albums, pageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &photos.ListAlbumsResponse{Albums: albums, NextPageToken: next}, nil
+}
+
+//ListSharedAlbums implements photos.Library
+func (l *Library) ListSharedAlbums(pageToken string) (*photos.ListSharedAlbumsResponse, error) {
+	l.called("ListSharedAlbums")
+	albums, next, err := albumPage(l.SharedAlbums, pageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &photos.ListSharedAlbumsResponse{SharedAlbums: albums, NextPageToken: next}, nil
+}
+
+//albumPage returns a page of 50 albums, like the API
+func albumPage(albums []*photos.Album, pageToken string) ([]*photos.Album, string, error) {
+	start := 0
+	if pageToken != "" {
+		var err error
+		start, err = strconv.Atoi(pageToken)
+		if err != nil || start < 0 || start > len(albums) {
+			return nil, "", &photos.Error{Code: 400, Message: "invalid page token", Status: "INVALID_ARGUMENT"}
+		}
+	}
+	end := start + 50
+	if end >= len(albums) {
+		return albums[start:], "", nil
+	}
+	return albums[start:end], strconv.Itoa(end), nil
+}
+
+//GetAlbum implements photos.Library
+func (l *Library) GetAlbum(id string) (*photos.Album, error) {
+	l.called("GetAlbum")
+	for _, albums := range [][]*photos.Album{l.Albums, l.SharedAlbums} {
+		for _, a := range albums {
+			if a.ID == id {
+				return a, nil
+			}
+		}
+	}
+	return nil, &photos.Error{Code: 404, Message: "album not found", Status: "NOT_FOUND"}
+}
+
+//BatchGetMediaItems implements photos.Library
+func (l *Library) BatchGetMediaItems(ids []string) (*photos.BatchGetMediaItemsResponse, error) {
+	l.called("BatchGetMediaItems")
+	if len(ids) > photos.MaxBatchGet {
+		return nil, &photos.Error{Code: 400, Message: "too many media items", Status: "INVALID_ARGUMENT"}
+	}
+	resp := &photos.BatchGetMediaItemsResponse{}
+	for _, id := range ids {
+		m := l.item(id)
+		if m == nil {
+			resp.MediaItemResults = append(resp.MediaItemResults, &photos.MediaItemResult{Status: &photos.Status{Code: 5, Message: "not found"}})
+			continue
+		}
+		resp.MediaItemResults = append(resp.MediaItemResults, &photos.MediaItemResult{MediaItem: m})
+	}
+	return resp, nil
+}
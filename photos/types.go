@@ -0,0 +1,163 @@
+package photos
+
+//MediaItem is a photo or video in Google Photos
+type MediaItem struct {
+	//ID identifies the media item
+	ID string `json:"id,omitempty"`
+	//Description of the media item, shown in the info section of the Google Photos app
+	Description string `json:"description,omitempty"`
+	//ProductURL opens the item in Google Photos
+	ProductURL string `json:"productUrl,omitempty"`
+	//BaseURL is used to download the bytes, it is valid for 60 minutes
+	BaseURL string `json:"baseUrl,omitempty"`
+	//MimeType of the media item, for example image/jpeg
+	MimeType string `json:"mimeType,omitempty"`
+	//MediaMetadata describes the item, such as its size and creation time
+	MediaMetadata *MediaMetadata `json:"mediaMetadata,omitempty"`
+	//ContributorInfo is set for items added to a shared album by others
+	ContributorInfo *ContributorInfo `json:"contributorInfo,omitempty"`
+	//Filename of the item as it was uploaded
+	Filename string `json:"filename,omitempty"`
+}
+
+//MediaMetadata is the metadata of a media item
+type MediaMetadata struct {
+	//CreationTime is the time the item was first created, RFC3339 in UTC
+	CreationTime string `json:"creationTime,omitempty"`
+	//Width in pixels
+	Width int64 `json:"width,omitempty,string"`
+	//Height in pixels
+	Height int64 `json:"height,omitempty,string"`
+	//Photo is set for photos
+	Photo *Photo `json:"photo,omitempty"`
+	//Video is set for videos
+	Video *Video `json:"video,omitempty"`
+}
+
+//Photo is the metadata of a photo
+type Photo struct {
+	CameraMake      string  `json:"cameraMake,omitempty"`
+	CameraModel     string  `json:"cameraModel,omitempty"`
+	FocalLength     float64 `json:"focalLength,omitempty"`
+	ApertureFNumber float64 `json:"apertureFNumber,omitempty"`
+	IsoEquivalent   int64   `json:"isoEquivalent,omitempty"`
+	ExposureTime    string  `json:"exposureTime,omitempty"`
+}
+
+//Video is the metadata of a video
+type Video struct {
+	CameraMake  string  `json:"cameraMake,omitempty"`
+	CameraModel string  `json:"cameraModel,omitempty"`
+	Fps         float64 `json:"fps,omitempty"`
+	//Status is the processing status, READY when it can be downloaded
+	Status string `json:"status,omitempty"`
+}
+
+//ContributorInfo is the user who added a media item to a shared album
+type ContributorInfo struct {
+	ProfilePictureBaseURL string `json:"profilePictureBaseUrl,omitempty"`
+	DisplayName           string `json:"displayName,omitempty"`
+}
+
+//Album is a collection of media items
+type Album struct {
+	ID                    string     `json:"id,omitempty"`
+	Title                 string     `json:"title,omitempty"`
+	ProductURL            string     `json:"productUrl,omitempty"`
+	IsWriteable           bool       `json:"isWriteable,omitempty"`
+	ShareInfo             *ShareInfo `json:"shareInfo,omitempty"`
+	MediaItemsCount       int64      `json:"mediaItemsCount,omitempty,string"`
+	CoverPhotoBaseURL     string     `json:"coverPhotoBaseUrl,omitempty"`
+	CoverPhotoMediaItemID string     `json:"coverPhotoMediaItemId,omitempty"`
+}
+
+//ShareInfo is set for shared albums
+type ShareInfo struct {
+	ShareableURL string `json:"shareableUrl,omitempty"`
+	ShareToken   string `json:"shareToken,omitempty"`
+	IsJoined     bool   `json:"isJoined,omitempty"`
+	IsOwned      bool   `json:"isOwned,omitempty"`
+}
+
+//Date is a calendar date, zero fields are wildcards
+type Date struct {
+	Year  int `json:"year,omitempty"`
+	Month int `json:"month,omitempty"`
+	Day   int `json:"day,omitempty"`
+}
+
+//DateRange is an inclusive range of dates
+type DateRange struct {
+	StartDate *Date `json:"startDate,omitempty"`
+	EndDate   *Date `json:"endDate,omitempty"`
+}
+
+//DateFilter matches items created on the dates or in the ranges
+type DateFilter struct {
+	Dates  []*Date      `json:"dates,omitempty"`
+	Ranges []*DateRange `json:"ranges,omitempty"`
+}
+
+//ContentFilter matches items by content categories, such as LANDSCAPES
+type ContentFilter struct {
+	IncludedContentCategories []string `json:"includedContentCategories,omitempty"`
+	ExcludedContentCategories []string `json:"excludedContentCategories,omitempty"`
+}
+
+//MediaTypeFilter matches items by type: ALL_MEDIA, PHOTO or VIDEO
+type MediaTypeFilter struct {
+	MediaTypes []string `json:"mediaTypes,omitempty"`
+}
+
+//Filters narrow a search, they can not be combined with an album ID
+type Filters struct {
+	DateFilter           *DateFilter      `json:"dateFilter,omitempty"`
+	ContentFilter        *ContentFilter   `json:"contentFilter,omitempty"`
+	MediaTypeFilter      *MediaTypeFilter `json:"mediaTypeFilter,omitempty"`
+	IncludeArchivedMedia bool             `json:"includeArchivedMedia,omitempty"`
+}
+
+//SearchMediaItemsRequest is the body of mediaItems:search
+type SearchMediaItemsRequest struct {
+	AlbumID   string   `json:"albumId,omitempty"`
+	PageSize  int64    `json:"pageSize,omitempty"`
+	PageToken string   `json:"pageToken,omitempty"`
+	Filters   *Filters `json:"filters,omitempty"`
+	//OrderBy sorts date filtered results, "MediaMetadata.creation_time desc" or empty for oldest first
+	OrderBy string `json:"orderBy,omitempty"`
+}
+
+//SearchMediaItemsResponse is a page of search results
+type SearchMediaItemsResponse struct {
+	MediaItems    []*MediaItem `json:"mediaItems,omitempty"`
+	NextPageToken string       `json:"nextPageToken,omitempty"`
+}
+
+//ListMediaItemsResponse is a page of the media items of the library
+type ListMediaItemsResponse struct {
+	MediaItems    []*MediaItem `json:"mediaItems,omitempty"`
+	NextPageToken string       `json:"nextPageToken,omitempty"`
+}
+
+//ListAlbumsResponse is a page of albums
+type ListAlbumsResponse struct {
+	Albums        []*Album `json:"albums,omitempty"`
+	NextPageToken string   `json:"nextPageToken,omitempty"`
+}
+
+//ListSharedAlbumsResponse is a page of shared albums
+type ListSharedAlbumsResponse struct {
+	SharedAlbums  []*Album `json:"sharedAlbums,omitempty"`
+	NextPageToken string   `json:"nextPageToken,omitempty"`
+}
+
+//MediaItemResult is the result of getting one media item in a batch
+type MediaItemResult struct {
+	MediaItem *MediaItem `json:"mediaItem,omitempty"`
+	Status    *Status    `json:"status,omitempty"`
+}
+
+//BatchGetMediaItemsResponse is the result of mediaItems:batchGet
+type BatchGetMediaItemsResponse struct {
+	MediaItemResults []*MediaItemResult `json:"mediaItemResults,omitempty"`
+}
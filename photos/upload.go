@@ -0,0 +1,199 @@
+package photos
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//Uploader is the part of the API used to add media to the library
+type Uploader interface {
+	//BatchGetMediaItems returns up to MaxBatchGet media items by ID
+	BatchGetMediaItems(ids []string) (*BatchGetMediaItemsResponse, error)
+	//StartUpload starts a resumable upload session, it returns the session URL
+	StartUpload(fileName string, mimeType string, size int64) (string, error)
+	//QueryUpload returns how many bytes of an upload session were received, and if it is still active
+	QueryUpload(uploadURL string) (int64, bool, error)
+	//ResumeUpload sends the rest of the file from offset and finalizes the upload, returning an upload token
+	ResumeUpload(uploadURL string, offset int64, r io.Reader) (string, error)
+	//BatchCreateMediaItems creates media items from upload tokens
+	BatchCreateMediaItems(req *BatchCreateMediaItemsRequest) (*BatchCreateMediaItemsResponse, error)
+	//CreateAlbum creates an album
+	CreateAlbum(title string) (*Album, error)
+	//BatchAddMediaItems adds up to MaxBatchAdd media items created by the app to an album created by the app
+	BatchAddMediaItems(albumID string, ids []string) error
+}
+
+//MaxBatchAdd is the maximum number of items in one BatchAddMediaItems call
+const MaxBatchAdd = 50
+
+//MaxBatchGet is the maximum number of IDs in one BatchGetMediaItems call
+const MaxBatchGet = 50
+
+//MaxBatchCreate is the maximum number of items in one BatchCreateMediaItems call
+const MaxBatchCreate = 50
+
+//SimpleMediaItem is an uploaded file
+type SimpleMediaItem struct {
+	UploadToken string `json:"uploadToken,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+}
+
+//NewMediaItem is a media item to create from an upload
+type NewMediaItem struct {
+	Description     string           `json:"description,omitempty"`
+	SimpleMediaItem *SimpleMediaItem `json:"simpleMediaItem,omitempty"`
+}
+
+//BatchCreateMediaItemsRequest is the body of mediaItems:batchCreate
+type BatchCreateMediaItemsRequest struct {
+	//AlbumID adds the items to this album, it must be created by the app
+	AlbumID       string          `json:"albumId,omitempty"`
+	NewMediaItems []*NewMediaItem `json:"newMediaItems,omitempty"`
+}
+
+//Status is the result status of an operation
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+//NewMediaItemResult is the result of creating one media item
+type NewMediaItemResult struct {
+	UploadToken string     `json:"uploadToken,omitempty"`
+	Status      *Status    `json:"status,omitempty"`
+	MediaItem   *MediaItem `json:"mediaItem,omitempty"`
+}
+
+//BatchCreateMediaItemsResponse is the result of mediaItems:batchCreate
+type BatchCreateMediaItemsResponse struct {
+	NewMediaItemResults []*NewMediaItemResult `json:"newMediaItemResults,omitempty"`
+}
+
+//BatchGetMediaItems implements Library and Uploader
+func (c *Client) BatchGetMediaItems(ids []string) (*BatchGetMediaItemsResponse, error) {
+	resp := &BatchGetMediaItemsResponse{}
+	err := c.do("GET", "mediaItems:batchGet", url.Values{"mediaItemIds": ids}, nil, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+//BatchCreateMediaItems implements Uploader
+func (c *Client) BatchCreateMediaItems(req *BatchCreateMediaItemsRequest) (*BatchCreateMediaItemsResponse, error) {
+	resp := &BatchCreateMediaItemsResponse{}
+	err := c.do("POST", "mediaItems:batchCreate", nil, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func checkUpload(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &Error{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+//StartUpload implements Uploader
+func (c *Client) StartUpload(fileName string, mimeType string, size int64) (string, error) {
+	req, err := http.NewRequest("POST", c.BasePath+"uploads", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Command", "start")
+	req.Header.Set("X-Goog-Upload-File-Name", fileName)
+	req.Header.Set("X-Goog-Upload-Raw-Size", strconv.FormatInt(size, 10))
+	if mimeType != "" {
+		req.Header.Set("X-Goog-Upload-Content-Type", mimeType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	err = checkUpload(resp)
+	if err != nil {
+		return "", err
+	}
+	uploadURL := resp.Header.Get("X-Goog-Upload-URL")
+	if uploadURL == "" {
+		return "", fmt.Errorf("photos: upload session was not started")
+	}
+	return uploadURL, nil
+}
+
+//QueryUpload implements Uploader
+func (c *Client) QueryUpload(uploadURL string) (int64, bool, error) {
+	req, err := http.NewRequest("POST", uploadURL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Command", "query")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+	err = checkUpload(resp)
+	if err != nil {
+		return 0, false, err
+	}
+	received, _ := strconv.ParseInt(resp.Header.Get("X-Goog-Upload-Size-Received"), 10, 64)
+	return received, resp.Header.Get("X-Goog-Upload-Status") == "active", nil
+}
+
+//ResumeUpload implements Uploader
+func (c *Client) ResumeUpload(uploadURL string, offset int64, r io.Reader) (string, error) {
+	req, err := http.NewRequest("POST", uploadURL, r)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Goog-Upload-Protocol", "resumable")
+	req.Header.Set("X-Goog-Upload-Command", "upload, finalize")
+	req.Header.Set("X-Goog-Upload-Offset", strconv.FormatInt(offset, 10))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	err = checkUpload(resp)
+	if err != nil {
+		return "", err
+	}
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+//CreateAlbum implements Uploader
+func (c *Client) CreateAlbum(title string) (*Album, error) {
+	album := &Album{}
+	req := struct {
+		Album *Album `json:"album"`
+	}{&Album{Title: title}}
+	err := c.do("POST", "albums", nil, req, album)
+	if err != nil {
+		return nil, err
+	}
+	return album, nil
+}
+
+//BatchAddMediaItems implements Uploader
+func (c *Client) BatchAddMediaItems(albumID string, ids []string) error {
+	req := struct {
+		MediaItemIds []string `json:"mediaItemIds"`
+	}{ids}
+	return c.do("POST", "albums/"+albumID+":batchAddMediaItems", nil, req, &struct{}{})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//stopTimeout is how long stop waits for the daemon to exit, it finishes the items being
+//downloaded first
+const stopTimeout = 10 * time.Minute
+
+//pidFileName returns the PID file of -pid-file, by default in the state folder of the backup
+//folder so one daemon runs per backup folder (and per machine with -shard)
+func pidFileName() string {
+	if options.pidFile != "" {
+		return options.pidFile
+	}
+	return downloader.StateFileName("gitmoo.pid")
+}
+
+//readPIDFile returns the PID of the running daemon, 0 if there is no PID file or the process
+//of the file is gone
+func readPIDFile() (int, error) {
+	data, err := ioutil.ReadFile(pidFileName())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid PID file '%v': %v", pidFileName(), err)
+	}
+	if !processAlive(pid) {
+		return 0, nil
+	}
+	return pid, nil
+}
+
+//writePIDFile writes the PID file, or returns an error if another instance is running. the
+//returned function removes the file
+func writePIDFile() (func(), error) {
+	pid, err := readPIDFile()
+	if err != nil {
+		return nil, err
+	}
+	if pid != 0 && pid != os.Getpid() {
+		return nil, fmt.Errorf("Another instance is running with PID %v ('%v'), stop it first", pid, pidFileName())
+	}
+	fileName := pidFileName()
+	err = downloader.MkdirAll(filepath.Dir(fileName))
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(fileName, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to write the PID file '%v': %v", fileName, err)
+	}
+	return func() {
+		err := os.Remove(fileName)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Unable to remove the PID file '%v': %v", fileName, err)
+		}
+	}, nil
+}
+
+//signalDaemon sends command, stop or reload, to the daemon of the PID file
+func signalDaemon(command string) error {
+	pid, err := readPIDFile()
+	if err != nil {
+		return err
+	}
+	if pid == 0 {
+		return fmt.Errorf("No running instance, '%v' is missing or stale", pidFileName())
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if command == "reload" {
+		err = reloadProcess(p)
+		if err != nil {
+			return fmt.Errorf("Unable to reload PID %v: %v", pid, err)
+		}
+		log.Printf("Asked PID %v to reload its configuration", pid)
+		return nil
+	}
+	err = stopProcess(p)
+	if err != nil {
+		return fmt.Errorf("Unable to stop PID %v: %v", pid, err)
+	}
+	log.Printf("Asked PID %v to stop, waiting for the items being downloaded", pid)
+	for start := time.Now(); time.Since(start) < stopTimeout; time.Sleep(100 * time.Millisecond) {
+		if !processAlive(pid) {
+			log.Printf("Stopped PID %v", pid)
+			return nil
+		}
+	}
+	return fmt.Errorf("PID %v is still running after %v", pid, stopTimeout)
+}
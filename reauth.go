@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+//reauthPollInterval is how often the token cache is checked for a new token while waiting for re-authorization
+const reauthPollInterval = 30 * time.Second
+
+//reauthTokenSource refreshes tokens, and when the refresh token was revoked or has expired
+//it pauses until the user re-authorizes instead of failing every API call
+type reauthTokenSource struct {
+	config *oauth2.Config
+	mu     sync.Mutex
+	tok    *oauth2.Token
+	src    oauth2.TokenSource
+}
+
+func newReauthTokenSource(config *oauth2.Config, tok *oauth2.Token) *reauthTokenSource {
+	return &reauthTokenSource{
+		config: config,
+		tok:    tok,
+		src:    config.TokenSource(context.Background(), tok),
+	}
+}
+
+//isRevoked checks if a token refresh failed because the refresh token is no longer valid
+func isRevoked(err error) bool {
+	return strings.Contains(err.Error(), "invalid_grant")
+}
+
+//isInteractive checks if stdin is a terminal the user can type into
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+//Token implements oauth2.TokenSource
+func (s *reauthTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, err := s.src.Token()
+	if err == nil || !isRevoked(err) {
+		return tok, err
+	}
+	log.Println("The OAuth refresh token was revoked or has expired.")
+	log.Println("Tokens of apps in 'Testing' publishing status expire after 7 days, publish the app in the Google API console to avoid this.")
+	tok = s.waitForToken()
+	s.tok = tok
+	s.src = s.config.TokenSource(context.Background(), tok)
+	return s.src.Token()
+}
+
+//waitForToken blocks until a new token is available, either by running the authorization
+//flow on an interactive terminal, or by waiting for the token cache to be replaced
+func (s *reauthTokenSource) waitForToken() *oauth2.Token {
+	if isInteractive() {
+		log.Println("Re-authorization is required")
+		tok := getToken(s.config)
+		saveToken(options.tokenFile, tok)
+		return tok
+	}
+	tokenFile, err := filepath.Abs(options.tokenFile)
+	if err != nil {
+		tokenFile = options.tokenFile
+	}
+	log.Printf("Re-authorize by running 'gitmoo-goog -token %v auth' in a terminal, with the -keyring or -token-keyfile options of this instance", tokenFile)
+	log.Printf("Paused, waiting for a new token in '%v'", options.tokenFile)
+	for {
+		time.Sleep(reauthPollInterval)
+		tok, err := tokenFromFile(options.tokenFile)
+		if err != nil || tok.RefreshToken == s.tok.RefreshToken {
+			continue
+		}
+		_, err = s.config.TokenSource(context.Background(), tok).Token()
+		if err != nil {
+			continue
+		}
+		log.Println("New token found, resuming")
+		return tok
+	}
+}
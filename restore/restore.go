@@ -0,0 +1,468 @@
+package restore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/stevedenman/gitmoo-goog/downloader"
+	"github.com/stevedenman/gitmoo-goog/photos"
+)
+
+//Options defines restore options
+var Options struct {
+	//BackupFolder is the archive to restore from
+	BackupFolder string
+	//Throttle is time to wait between API calls
+	Throttle int
+}
+
+//JournalName is the file in the backup folder that tracks restore progress
+const JournalName = "restore.json"
+
+//uploadTokenTTL is how long an upload token can be used to create a media item
+const uploadTokenTTL = 23 * time.Hour
+
+//entry is the restore state of one local file
+type entry struct {
+	Size        int64     `json:"size"`
+	UploadURL   string    `json:"upload_url,omitempty"`
+	UploadToken string    `json:"upload_token,omitempty"`
+	Uploaded    time.Time `json:"uploaded,omitempty"`
+	MediaItemID string    `json:"media_item_id,omitempty"`
+	Existing    bool      `json:"existing,omitempty"`
+}
+
+//albumEntry is the restore state of an album
+type albumEntry struct {
+	//AlbumID is the ID of the recreated album
+	AlbumID string `json:"album_id"`
+	//Added are media items already added to the album
+	Added map[string]bool `json:"added"`
+}
+
+//journal persists restore progress, so an interrupted restore continues where it stopped
+type journal struct {
+	fileName string
+	//Items by path relative to the backup folder
+	Items map[string]*entry `json:"items"`
+	//Albums by original album ID
+	Albums map[string]*albumEntry `json:"albums,omitempty"`
+}
+
+var stats struct {
+	total     int
+	existing  int
+	uploaded  int
+	errors    int
+	totalsize uint64
+}
+
+func loadJournal() (*journal, error) {
+	j := &journal{
+		fileName: filepath.Join(Options.BackupFolder, JournalName),
+		Items:    make(map[string]*entry),
+		Albums:   make(map[string]*albumEntry),
+	}
+	data, err := ioutil.ReadFile(j.fileName)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, j)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read restore journal '%v': %v", j.fileName, err)
+	}
+	if j.Albums == nil {
+		j.Albums = make(map[string]*albumEntry)
+	}
+	return j, nil
+}
+
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.fileName + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.fileName)
+}
+
+//file is a local media file to restore
+type file struct {
+	path  string
+	rel   string
+	size  int64
+	entry *entry
+	//item is the sidecar metadata, nil if there is none
+	item *photos.MediaItem
+}
+
+//sidecarName returns the metadata file written next to a media file by the downloader
+func sidecarName(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+func readSidecar(path string) *photos.MediaItem {
+	data, err := ioutil.ReadFile(sidecarName(path))
+	if err != nil {
+		return nil
+	}
+	item := &photos.MediaItem{}
+	if json.Unmarshal(data, item) != nil {
+		return nil
+	}
+	return item
+}
+
+//isMedia checks if path is a photo or video
+func isMedia(path string) bool {
+	if strings.HasSuffix(path, downloader.MotionSuffix) {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".json" || ext == ".tmp" || ext == "" {
+		return false
+	}
+	mimeType := mime.TypeByExtension(ext)
+	if strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/") {
+		return true
+	}
+	_, err := os.Stat(sidecarName(path))
+	return err == nil
+}
+
+//isQuarantine checks if path is the folder of broken downloads
+func isQuarantine(path string) bool {
+	rel, err := filepath.Rel(Options.BackupFolder, path)
+	return err == nil && rel == downloader.QuarantineFolder
+}
+
+//findMedia lists media files under folders
+func findMedia(folders []string, j *journal) ([]*file, error) {
+	files := make([]*file, 0)
+	for _, folder := range folders {
+		err := filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && isQuarantine(path) {
+				return filepath.SkipDir
+			}
+			if info.IsDir() || !isMedia(path) {
+				return nil
+			}
+			rel, err := filepath.Rel(Options.BackupFolder, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			e := j.Items[rel]
+			if e == nil || e.Size != info.Size() {
+				e = &entry{Size: info.Size()}
+				j.Items[rel] = e
+			}
+			files = append(files, &file{path: path, rel: rel, size: info.Size(), entry: e, item: readSidecar(path)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func throttle() {
+	time.Sleep(time.Duration(time.Second * time.Duration(Options.Throttle)))
+}
+
+//markExisting looks up the original media items of files, and marks those still in the library
+func markExisting(svc photos.Uploader, files []*file) error {
+	byID := make(map[string]*file)
+	ids := make([]string, 0)
+	for _, f := range files {
+		if f.entry.MediaItemID != "" || f.item == nil || f.item.ID == "" {
+			continue
+		}
+		byID[f.item.ID] = f
+		ids = append(ids, f.item.ID)
+	}
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > photos.MaxBatchGet {
+			n = photos.MaxBatchGet
+		}
+		throttle()
+		resp, err := svc.BatchGetMediaItems(ids[:n])
+		if err != nil {
+			return err
+		}
+		for _, r := range resp.MediaItemResults {
+			if r.MediaItem == nil {
+				continue
+			}
+			f := byID[r.MediaItem.ID]
+			if f != nil {
+				f.entry.MediaItemID = r.MediaItem.ID
+				f.entry.Existing = true
+			}
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+//upload uploads a file, resuming an interrupted upload session if possible
+func upload(svc photos.Uploader, f *file) error {
+	input, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	var offset int64
+	if f.entry.UploadURL != "" {
+		received, active, err := svc.QueryUpload(f.entry.UploadURL)
+		if err == nil && active {
+			offset = received
+			log.Printf("Resuming upload of '%v' at %v", f.rel, humanize.Bytes(uint64(offset)))
+		} else {
+			f.entry.UploadURL = ""
+		}
+	}
+	if f.entry.UploadURL == "" {
+		mimeType := mime.TypeByExtension(filepath.Ext(f.path))
+		if f.item != nil && f.item.MimeType != "" {
+			mimeType = f.item.MimeType
+		}
+		f.entry.UploadURL, err = svc.StartUpload(filepath.Base(f.path), mimeType, f.size)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = input.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	token, err := svc.ResumeUpload(f.entry.UploadURL, offset, input)
+	if err != nil {
+		return err
+	}
+	f.entry.UploadURL = ""
+	f.entry.UploadToken = token
+	f.entry.Uploaded = time.Now()
+	stats.totalsize += uint64(f.size - offset)
+	return nil
+}
+
+//create creates media items from uploaded files
+func create(svc photos.Uploader, batch []*file) error {
+	req := &photos.BatchCreateMediaItemsRequest{}
+	byToken := make(map[string]*file)
+	for _, f := range batch {
+		item := &photos.NewMediaItem{SimpleMediaItem: &photos.SimpleMediaItem{
+			UploadToken: f.entry.UploadToken,
+			FileName:    filepath.Base(f.path),
+		}}
+		if f.item != nil {
+			item.Description = f.item.Description
+			if f.item.Filename != "" {
+				item.SimpleMediaItem.FileName = f.item.Filename
+			}
+		}
+		req.NewMediaItems = append(req.NewMediaItems, item)
+		byToken[f.entry.UploadToken] = f
+	}
+	throttle()
+	resp, err := svc.BatchCreateMediaItems(req)
+	if err != nil {
+		return err
+	}
+	for _, r := range resp.NewMediaItemResults {
+		f := byToken[r.UploadToken]
+		if f == nil {
+			continue
+		}
+		if r.MediaItem == nil {
+			msg := "unknown error"
+			if r.Status != nil {
+				msg = r.Status.Message
+			}
+			log.Printf("Failed to restore '%v': %v", f.rel, msg)
+			stats.errors++
+			f.entry.UploadToken = ""
+			continue
+		}
+		log.Printf("Restored '%v'", f.rel)
+		f.entry.MediaItemID = r.MediaItem.ID
+		f.entry.UploadToken = ""
+		stats.uploaded++
+	}
+	return nil
+}
+
+//Restore uploads media files found under folders (or the whole backup folder) back to Google Photos.
+//Files whose original media item is still in the library are not uploaded again.
+func Restore(svc photos.Uploader, folders []string) error {
+	stats.total = 0
+	stats.existing = 0
+	stats.uploaded = 0
+	stats.errors = 0
+	stats.totalsize = 0
+	if len(folders) == 0 {
+		folders = []string{Options.BackupFolder}
+	}
+	j, err := loadJournal()
+	if err != nil {
+		return err
+	}
+	files, err := findMedia(folders, j)
+	if err != nil {
+		return err
+	}
+	log.Printf("Found %v media files", len(files))
+	err = markExisting(svc, files)
+	if err != nil {
+		return err
+	}
+	err = j.save()
+	if err != nil {
+		return err
+	}
+
+	batch := make([]*file, 0, photos.MaxBatchCreate)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := create(svc, batch)
+		batch = batch[:0]
+		if err != nil {
+			return err
+		}
+		return j.save()
+	}
+	for _, f := range files {
+		stats.total++
+		if f.entry.MediaItemID != "" {
+			if f.entry.Existing {
+				stats.existing++
+			}
+			continue
+		}
+		if f.entry.UploadToken == "" || time.Since(f.entry.Uploaded) > uploadTokenTTL {
+			err = upload(svc, f)
+			if err != nil {
+				log.Printf("Failed to upload '%v': %v", f.rel, err)
+				stats.errors++
+				j.save()
+				continue
+			}
+		}
+		batch = append(batch, f)
+		if len(batch) == photos.MaxBatchCreate {
+			err = flush()
+			if err != nil {
+				return err
+			}
+			log.Printf("Processed: %v, Restored: %v, Still in library: %v, Errors: %v, Uploaded: %v",
+				stats.total, stats.uploaded, stats.existing, stats.errors, humanize.Bytes(stats.totalsize))
+		}
+	}
+	err = flush()
+	if err != nil {
+		return err
+	}
+	err = restoreAlbums(svc, j)
+	if err != nil {
+		return err
+	}
+	log.Printf("Processed: %v, Restored: %v, Still in library: %v, Errors: %v, Uploaded: %v",
+		stats.total, stats.uploaded, stats.existing, stats.errors, humanize.Bytes(stats.totalsize))
+	return nil
+}
+
+//restoreAlbums recreates albums from the album manifests and adds the restored items to them.
+//Only items uploaded by the restore can be added, the API does not allow adding other items.
+func restoreAlbums(svc photos.Uploader, j *journal) error {
+	manifests, err := downloader.ReadManifests()
+	if err != nil {
+		return err
+	}
+	for _, m := range manifests {
+		ids := make([]string, 0)
+		existing := 0
+		a := j.Albums[m.ID]
+		for _, item := range m.Items {
+			e := j.Items[item.File]
+			if e == nil || e.MediaItemID == "" {
+				continue
+			}
+			if e.Existing {
+				existing++
+				continue
+			}
+			if a == nil || !a.Added[e.MediaItemID] {
+				ids = append(ids, e.MediaItemID)
+			}
+		}
+		if m.Truncated {
+			log.Printf("Album '%v': the manifest has only the first items of the album, it was written with -album-max", m.Title)
+		}
+		if existing > 0 {
+			log.Printf("Album '%v': %v items are still in the library and can not be added by the restore", m.Title, existing)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if a == nil {
+			throttle()
+			album, err := svc.CreateAlbum(m.Title)
+			if err != nil {
+				return err
+			}
+			log.Printf("Created album '%v'", m.Title)
+			a = &albumEntry{AlbumID: album.ID, Added: make(map[string]bool)}
+			j.Albums[m.ID] = a
+			err = j.save()
+			if err != nil {
+				return err
+			}
+		}
+		for len(ids) > 0 {
+			n := len(ids)
+			if n > photos.MaxBatchAdd {
+				n = photos.MaxBatchAdd
+			}
+			throttle()
+			err = svc.BatchAddMediaItems(a.AlbumID, ids[:n])
+			if err != nil {
+				return err
+			}
+			for _, id := range ids[:n] {
+				a.Added[id] = true
+			}
+			err = j.save()
+			if err != nil {
+				return err
+			}
+			ids = ids[n:]
+		}
+		log.Printf("Album '%v': %v items restored", m.Title, len(a.Added))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/stevedenman/gitmoo-goog/downloader"
+)
+
+//handlePauseSignals pauses the downloads on SIGUSR1 and resumes them on SIGUSR2
+func handlePauseSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range c {
+			if sig == syscall.SIGUSR1 {
+				downloader.Pause()
+			} else {
+				downloader.Resume()
+			}
+		}
+	}()
+}
+
+//handleReloadSignal reloads the config file on SIGHUP, before the next run
+func handleReloadSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			if options.configFile == "" {
+				log.Println("Received SIGHUP without -config, nothing to reload")
+				continue
+			}
+			log.Printf("Received SIGHUP, '%v' is reloaded before the next run", options.configFile)
+			reloadPending.Store(true)
+		}
+	}()
+}
+
+//handleStopSignal stops the run in progress on SIGTERM, sent by the stop command, so it saves
+//its state. the returned channel is closed then, to stop waiting between runs
+func handleStopSignal() <-chan struct{} {
+	stopped := make(chan struct{})
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM)
+	go func() {
+		<-c
+		log.Println("Received SIGTERM, stopping")
+		downloader.Stop()
+		close(stopped)
+	}()
+	return stopped
+}
+
+//processAlive checks if the process pid exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+//stopProcess asks p to stop
+func stopProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
+
+//reloadProcess asks p to reload its config file
+func reloadProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGHUP)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+//handlePauseSignals does nothing, Windows has no user signals. use the dashboard or the
+//control service to pause
+func handlePauseSignals() {
+}
+
+//handleReloadSignal does nothing, Windows has no SIGHUP. restart to apply the config file
+func handleReloadSignal() {
+}
+
+//handleStopSignal returns a channel that is never closed, the stop command terminates the
+//process and the stale PID file is ignored by the next run
+func handleStopSignal() <-chan struct{} {
+	return nil
+}
+
+//processAlive checks if the process pid exists
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+//stopProcess terminates p, Windows has no SIGTERM
+func stopProcess(p *os.Process) error {
+	return p.Kill()
+}
+
+//reloadProcess returns an error, Windows has no SIGHUP
+func reloadProcess(p *os.Process) error {
+	return errors.New("reload is not available on Windows, restart the daemon")
+}
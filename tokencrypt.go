@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//passphraseEnv can hold the token passphrase when running unattended
+const passphraseEnv = "GITMOO_TOKEN_PASSPHRASE"
+
+const tokenKeyIterations = 100000
+
+//sealedToken is the on-disk format of an encrypted token cache
+type sealedToken struct {
+	Version int    `json:"gitmoo_sealed"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+var cachedSecret []byte
+
+//tokenSecret returns the secret used to encrypt the token cache, or nil if encryption is disabled
+func tokenSecret() ([]byte, error) {
+	if cachedSecret != nil {
+		return cachedSecret, nil
+	}
+	if options.tokenKeyFile != "" {
+		key, err := ioutil.ReadFile(options.tokenKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read token key file: %v", err)
+		}
+		cachedSecret = key
+	} else if options.tokenPassphrase {
+		pass := os.Getenv(passphraseEnv)
+		if pass == "" {
+			fmt.Print("Token passphrase: ")
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, fmt.Errorf("Unable to read passphrase: %v", err)
+			}
+			pass = strings.TrimRight(line, "\r\n")
+		}
+		if pass == "" {
+			return nil, errors.New("Empty token passphrase")
+		}
+		cachedSecret = []byte(pass)
+	}
+	return cachedSecret, nil
+}
+
+func tokenCipher(secret []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(secret), salt, tokenKeyIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//sealToken encrypts the token cache contents with secret
+func sealToken(secret []byte, data []byte) ([]byte, error) {
+	sealed := sealedToken{Version: 1, Salt: make([]byte, 16)}
+	_, err := rand.Read(sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := tokenCipher(secret, sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(sealed.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	sealed.Data = aead.Seal(nil, sealed.Nonce, data, nil)
+	return json.Marshal(sealed)
+}
+
+//openToken decrypts the token cache contents, plain text caches are returned as is
+func openToken(data []byte) ([]byte, error) {
+	sealed := sealedToken{}
+	if json.Unmarshal(data, &sealed) != nil || sealed.Version == 0 {
+		return data, nil
+	}
+	secret, err := tokenSecret()
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("Token cache is encrypted, use -token-keyfile or -token-passphrase")
+	}
+	aead, err := tokenCipher(secret, sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, sealed.Nonce, sealed.Data, nil)
+	if err != nil {
+		return nil, errors.New("Unable to decrypt token cache, wrong passphrase or key file?")
+	}
+	return plain, nil
+}
+
+//tokenIsSealed checks if the token cache is encrypted
+func tokenIsSealed(file string) bool {
+	data, err := readSecret("token", file)
+	if err != nil {
+		return false
+	}
+	sealed := sealedToken{}
+	return json.Unmarshal(data, &sealed) == nil && sealed.Version != 0
+}
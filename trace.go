@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//sensitiveParams are query parameters whose values are left out of traces
+var sensitiveParams = []string{"access_token", "key", "signature", "sig", "token", "code"}
+
+//maxTracedURLs bounds the URLs remembered to number retry attempts
+const maxTracedURLs = 10000
+
+//tracer logs the requests of its transport
+type tracer struct {
+	name  string
+	inner http.RoundTripper
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+//traceTransport returns a transport logging the requests of inner (nil for http.DefaultTransport)
+func traceTransport(name string, inner http.RoundTripper) http.RoundTripper {
+	if inner == nil {
+		inner = http.DefaultTransport
+	}
+	return &tracer{name: name, inner: inner, attempts: make(map[string]int)}
+}
+
+//attempt returns how many times the same request was made
+func (t *tracer) attempt(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.attempts) >= maxTracedURLs {
+		t.attempts = make(map[string]int)
+	}
+	t.attempts[key]++
+	return t.attempts[key]
+}
+
+func (t *tracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := redactURL(req.URL)
+	attempt := ""
+	if n := t.attempt(req.Method + " " + req.URL.String() + " " + req.Header.Get("Range")); n > 1 {
+		attempt = fmt.Sprintf(" (attempt %v)", n)
+	}
+	start := time.Now()
+	resp, err := t.inner.RoundTrip(req)
+	latency := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("[%v] %v %v%v: %v, %v", t.name, req.Method, u, attempt, err, latency)
+		return nil, err
+	}
+	log.Printf("[%v] %v %v%v: %v, %v", t.name, req.Method, u, attempt, resp.Status, latency)
+	return resp, nil
+}
+
+//redactURL returns u without the signatures of media URLs and the secrets of query parameters
+func redactURL(u *url.URL) string {
+	r := *u
+	if strings.HasSuffix(r.Host, "googleusercontent.com") {
+		segments := strings.Split(r.Path, "/")
+		for i, s := range segments {
+			if len(s) <= 16 {
+				continue
+			}
+			//keep the size/download parameters after '='
+			suffix := ""
+			if eq := strings.LastIndex(s, "="); eq > 0 {
+				suffix = s[eq:]
+			}
+			segments[i] = s[:6] + "..." + suffix
+		}
+		r.Path = strings.Join(segments, "/")
+		r.RawPath = ""
+	}
+	query := r.Query()
+	for _, p := range sensitiveParams {
+		if query.Get(p) != "" {
+			query.Set(p, "REDACTED")
+		}
+	}
+	r.RawQuery = query.Encode()
+	return r.String()
+}